@@ -0,0 +1,83 @@
+// Package browsercookies reads a site's cookies straight out of a browser profile,
+// so users don't have to export them by hand.
+package browsercookies
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type cookie struct {
+	host  string
+	name  string
+	value string
+}
+
+// Load returns a Cookie header with every cookie the browser has for domain and its subdomains
+func Load(browser string, domain string) (string, error) {
+	var cookies []cookie
+	var err error
+
+	switch strings.ToLower(browser) {
+	case "firefox":
+		cookies, err = firefoxCookies(domain)
+	case "chrome", "chromium":
+		cookies, err = chromeCookies(strings.ToLower(browser), domain)
+	default:
+		return "", fmt.Errorf("Unsupported browser %q, expected firefox, chrome or chromium", browser)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(cookies) == 0 {
+		return "", fmt.Errorf("No %s cookies found in %s, are you logged in?", domain, browser)
+	}
+
+	pairs := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		pairs = append(pairs, c.name+"="+c.value)
+	}
+
+	return strings.Join(pairs, "; "), nil
+}
+
+func matchesDomain(host string, domain string) bool {
+	host = strings.TrimPrefix(host, ".")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// newestFile picks the most recently used of the files matching the patterns, for users with several profiles
+func newestFile(patterns ...string) (string, error) {
+	var matches []string
+	for _, pattern := range patterns {
+		found, _ := filepath.Glob(pattern)
+		matches = append(matches, found...)
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("No browser profile found (looked in %s)", strings.Join(patterns, ", "))
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, errA := os.Stat(matches[i])
+		b, errB := os.Stat(matches[j])
+		return errA == nil && errB == nil && a.ModTime().After(b.ModTime())
+	})
+
+	return matches[0], nil
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
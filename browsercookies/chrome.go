@@ -0,0 +1,124 @@
+package browsercookies
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// decrypter turns a Chrome encrypted_value back into the cookie value
+type decrypter func(encrypted []byte) ([]byte, error)
+
+func chromeUserData(browser string) string {
+	home, _ := os.UserHomeDir()
+
+	vendor := []string{"Google", "Chrome"}
+	if browser == "chromium" {
+		vendor = []string{"Chromium"}
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(append(append([]string{os.Getenv("LOCALAPPDATA")}, vendor...), "User Data")...)
+	case "darwin":
+		return filepath.Join(append([]string{home, "Library", "Application Support"}, vendor...)...)
+	default:
+		if browser == "chromium" {
+			return filepath.Join(home, ".config", "chromium")
+		}
+		return filepath.Join(home, ".config", "google-chrome")
+	}
+}
+
+func chromeCookies(browser string, domain string) ([]cookie, error) {
+	userData := chromeUserData(browser)
+
+	file, err := newestFile(filepath.Join(userData, "*", "Network", "Cookies"), filepath.Join(userData, "*", "Cookies"))
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDatabase(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newer versions prefix the decrypted value with a hash of the host
+	version := 0
+	if meta, err := db.table("meta"); err == nil {
+		for _, row := range meta {
+			if row["key"] == "version" {
+				version, _ = strconv.Atoi(stringValue(row["value"]))
+			}
+		}
+	}
+
+	rows, err := db.table("cookies")
+	if err != nil {
+		return nil, err
+	}
+
+	// Getting the key can mean a keychain prompt, so only do it if we need it
+	var decrypt decrypter
+
+	var cookies []cookie
+	for _, row := range rows {
+		host := stringValue(row["host_key"])
+		if !matchesDomain(host, domain) {
+			continue
+		}
+
+		value := stringValue(row["value"])
+		encrypted, _ := row["encrypted_value"].([]byte)
+
+		if value == "" && len(encrypted) > 0 {
+			if decrypt == nil {
+				decrypt, err = newChromeDecrypter(browser, userData)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to get the %s cookie key: %w", browser, err)
+				}
+			}
+
+			plaintext, err := decrypt(encrypted)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to decrypt %s cookie %s: %w", browser, stringValue(row["name"]), err)
+			}
+
+			if version >= 24 && len(plaintext) >= sha256.Size {
+				plaintext = plaintext[sha256.Size:]
+			}
+			value = string(plaintext)
+		}
+
+		cookies = append(cookies, cookie{host, stringValue(row["name"]), value})
+	}
+
+	return cookies, nil
+}
+
+// pbkdf2SHA1 derives a key of at most one SHA-1 block, which is all Chrome needs
+func pbkdf2SHA1(password []byte, salt []byte, iterations int, keyLen int) []byte {
+	mac := hmac.New(sha1.New, password)
+
+	mac.Write(salt)
+	mac.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := mac.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+
+	return key[:keyLen]
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+
+package browsercookies
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+)
+
+// On Linux and macOS, cookies are AES-128-CBC encrypted with a key derived from a password in the OS keyring
+func newChromeDecrypter(browser string, userData string) (decrypter, error) {
+	keys := map[string][]byte{
+		// Used when Chrome couldn't reach a keyring
+		"v10": pbkdf2SHA1([]byte("peanuts"), []byte("saltysalt"), 1, 16),
+	}
+
+	password, iterations, err := chromeKeyringPassword(browser)
+	if err == nil {
+		key := pbkdf2SHA1(password, []byte("saltysalt"), iterations, 16)
+		keys["v11"] = key
+		// macOS uses the keychain key for v10
+		if iterations > 1 {
+			keys["v10"] = key
+		}
+	}
+
+	return func(encrypted []byte) ([]byte, error) {
+		if len(encrypted) < 3 {
+			return nil, errors.New("Value too short")
+		}
+
+		key, ok := keys[string(encrypted[:3])]
+		if !ok {
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("Unsupported encryption version %q", encrypted[:3])
+		}
+
+		return decryptCBC(key, encrypted[3:])
+	}, nil
+}
+
+func decryptCBC(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("Ciphertext is not a whole number of blocks")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, bytes.Repeat([]byte{' '}, aes.BlockSize)).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding < 1 || padding > aes.BlockSize {
+		return nil, errors.New("Wrong key or corrupt value")
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
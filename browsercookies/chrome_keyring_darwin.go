@@ -0,0 +1,22 @@
+//go:build darwin
+
+package browsercookies
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+func chromeKeyringPassword(browser string) ([]byte, int, error) {
+	service := "Chrome Safe Storage"
+	if browser == "chromium" {
+		service = "Chromium Safe Storage"
+	}
+
+	out, err := exec.Command("security", "find-generic-password", "-w", "-s", service).Output()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return bytes.TrimSpace(out), 1003, nil
+}
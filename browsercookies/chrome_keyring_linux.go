@@ -0,0 +1,24 @@
+//go:build !darwin && !windows
+
+package browsercookies
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+)
+
+// The password is in the Secret Service keyring (GNOME Keyring, KeePassXC etc.), which secret-tool can read
+func chromeKeyringPassword(browser string) ([]byte, int, error) {
+	out, err := exec.Command("secret-tool", "lookup", "application", browser).Output()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	password := bytes.TrimSpace(out)
+	if len(password) == 0 {
+		return nil, 0, errors.New("No password found in the keyring")
+	}
+
+	return password, 1, nil
+}
@@ -0,0 +1,90 @@
+//go:build windows
+
+package browsercookies
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// On Windows, cookies are AES-256-GCM encrypted with a key kept in Local State, itself protected with DPAPI
+func newChromeDecrypter(browser string, userData string) (decrypter, error) {
+	data, err := os.ReadFile(filepath.Join(userData, "Local State"))
+	if err != nil {
+		return nil, err
+	}
+
+	var localState struct {
+		OSCrypt struct {
+			EncryptedKey string `json:"encrypted_key"`
+		} `json:"os_crypt"`
+	}
+	err = json.Unmarshal(data, &localState)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := base64.StdEncoding.DecodeString(localState.OSCrypt.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := unprotect([]byte(strings.TrimPrefix(string(encryptedKey), "DPAPI")))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(encrypted []byte) ([]byte, error) {
+		switch {
+		case len(encrypted) < 3:
+			return nil, errors.New("Value too short")
+		case string(encrypted[:3]) == "v20":
+			return nil, errors.New("Chrome's app-bound encryption (v20) can't be read by other programs, export cookies.txt with a browser extension instead")
+		case string(encrypted[:3]) != "v10":
+			// Very old versions used DPAPI directly on each value
+			return unprotect(encrypted)
+		}
+
+		encrypted = encrypted[3:]
+		if len(encrypted) < gcm.NonceSize() {
+			return nil, errors.New("Value too short")
+		}
+
+		return gcm.Open(nil, encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():], nil)
+	}, nil
+}
+
+func unprotect(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("Nothing to decrypt")
+	}
+
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+
+	err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, 0, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
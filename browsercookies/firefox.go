@@ -0,0 +1,51 @@
+package browsercookies
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+func firefoxProfiles() []string {
+	home, _ := os.UserHomeDir()
+
+	switch runtime.GOOS {
+	case "windows":
+		return []string{filepath.Join(os.Getenv("APPDATA"), "Mozilla", "Firefox", "Profiles", "*", "cookies.sqlite")}
+	case "darwin":
+		return []string{filepath.Join(home, "Library", "Application Support", "Firefox", "Profiles", "*", "cookies.sqlite")}
+	default:
+		return []string{
+			filepath.Join(home, ".mozilla", "firefox", "*", "cookies.sqlite"),
+			filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox", "*", "cookies.sqlite"),
+			filepath.Join(home, ".var", "app", "org.mozilla.firefox", ".mozilla", "firefox", "*", "cookies.sqlite"),
+		}
+	}
+}
+
+func firefoxCookies(domain string) ([]cookie, error) {
+	file, err := newestFile(firefoxProfiles()...)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDatabase(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.table("moz_cookies")
+	if err != nil {
+		return nil, err
+	}
+
+	var cookies []cookie
+	for _, row := range rows {
+		host := stringValue(row["host"])
+		if matchesDomain(host, domain) {
+			cookies = append(cookies, cookie{host, stringValue(row["name"]), stringValue(row["value"])})
+		}
+	}
+
+	return cookies, nil
+}
@@ -0,0 +1,349 @@
+package browsercookies
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// database is just enough of a read-only SQLite reader to pull rows out of the cookie tables
+// browsers keep, without linking a whole SQLite implementation into the binary.
+type database struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+	// Pages from the write-ahead log that are newer than the ones in the main file
+	walPages map[uint32][]byte
+}
+
+const sqliteMagic = "SQLite format 3\x00"
+
+func openDatabase(file string) (*database, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 100 || string(data[:16]) != sqliteMagic {
+		return nil, fmt.Errorf("%s is not an SQLite database", file)
+	}
+
+	db := &database{data: data}
+
+	db.pageSize = int(binary.BigEndian.Uint16(data[16:18]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	db.usableSize = db.pageSize - int(data[20])
+
+	// Browsers keep the database open, so recent changes are often still only in the WAL
+	if wal, err := os.ReadFile(file + "-wal"); err == nil {
+		db.walPages = readWAL(wal, db.pageSize)
+	}
+
+	return db, nil
+}
+
+// readWAL returns the latest committed version of every page in a write-ahead log
+func readWAL(wal []byte, pageSize int) map[uint32][]byte {
+	const headerSize, frameHeaderSize = 32, 24
+
+	if len(wal) < headerSize || int(binary.BigEndian.Uint32(wal[8:12])) != pageSize {
+		return nil
+	}
+	salt1, salt2 := binary.BigEndian.Uint32(wal[16:20]), binary.BigEndian.Uint32(wal[20:24])
+
+	committed := make(map[uint32][]byte)
+	pending := make(map[uint32][]byte)
+
+	for offset := headerSize; offset+frameHeaderSize+pageSize <= len(wal); offset += frameHeaderSize + pageSize {
+		frame := wal[offset : offset+frameHeaderSize]
+
+		// Frames with other salts are left over from before the log was last reset
+		if binary.BigEndian.Uint32(frame[8:12]) != salt1 || binary.BigEndian.Uint32(frame[12:16]) != salt2 {
+			break
+		}
+
+		pageNumber := binary.BigEndian.Uint32(frame[0:4])
+		pending[pageNumber] = wal[offset+frameHeaderSize : offset+frameHeaderSize+pageSize]
+
+		// Only frames up to a commit are part of the database
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 {
+			for number, page := range pending {
+				committed[number] = page
+			}
+			pending = make(map[uint32][]byte)
+		}
+	}
+
+	return committed
+}
+
+func (db *database) page(number uint32) ([]byte, error) {
+	if page, ok := db.walPages[number]; ok {
+		return page, nil
+	}
+
+	start := int(number-1) * db.pageSize
+	if number == 0 || start+db.pageSize > len(db.data) {
+		return nil, fmt.Errorf("Page %d is out of range", number)
+	}
+
+	return db.data[start : start+db.pageSize], nil
+}
+
+func readVarint(buf []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9 && i < len(buf); i++ {
+		if i == 8 {
+			return value<<8 | uint64(buf[i]), 9
+		}
+		value = value<<7 | uint64(buf[i]&0x7f)
+		if buf[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return value, len(buf)
+}
+
+// walkTable calls fn with the decoded columns of every row in the table b-tree rooted at root
+func (db *database) walkTable(root uint32, fn func(rowid int64, values []any)) error {
+	page, err := db.page(root)
+	if err != nil {
+		return err
+	}
+
+	// Page 1 starts with the database header
+	header := 0
+	if root == 1 {
+		header = 100
+	}
+
+	pageType := page[header]
+	cellCount := int(binary.BigEndian.Uint16(page[header+3 : header+5]))
+
+	switch pageType {
+	case 0x05: // Interior table page
+		cellPointers := header + 12
+		for i := 0; i < cellCount; i++ {
+			cell := int(binary.BigEndian.Uint16(page[cellPointers+2*i:]))
+			err = db.walkTable(binary.BigEndian.Uint32(page[cell:cell+4]), fn)
+			if err != nil {
+				return err
+			}
+		}
+		return db.walkTable(binary.BigEndian.Uint32(page[header+8:header+12]), fn)
+
+	case 0x0d: // Leaf table page
+		cellPointers := header + 8
+		for i := 0; i < cellCount; i++ {
+			cell := int(binary.BigEndian.Uint16(page[cellPointers+2*i:]))
+
+			payloadSize, n := readVarint(page[cell:])
+			cell += n
+			rowid, n := readVarint(page[cell:])
+			cell += n
+
+			payload, err := db.payload(page, cell, int(payloadSize))
+			if err != nil {
+				return err
+			}
+
+			values, err := decodeRecord(payload)
+			if err != nil {
+				return err
+			}
+
+			fn(int64(rowid), values)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("Unexpected b-tree page type %#x", pageType)
+	}
+}
+
+// payload reassembles a cell's record, following overflow pages if it didn't fit on the page
+func (db *database) payload(page []byte, start int, size int) ([]byte, error) {
+	maxLocal := db.usableSize - 35
+	if size <= maxLocal {
+		return page[start : start+size], nil
+	}
+
+	minLocal := (db.usableSize-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(db.usableSize-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+
+	payload := make([]byte, 0, size)
+	payload = append(payload, page[start:start+local]...)
+
+	overflow := binary.BigEndian.Uint32(page[start+local:])
+	for len(payload) < size {
+		if overflow == 0 {
+			return nil, errors.New("Record overflow chain ended early")
+		}
+
+		overflowPage, err := db.page(overflow)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := min(size-len(payload), db.usableSize-4)
+		payload = append(payload, overflowPage[4:4+chunk]...)
+		overflow = binary.BigEndian.Uint32(overflowPage[0:4])
+	}
+
+	return payload, nil
+}
+
+func decodeRecord(record []byte) ([]any, error) {
+	headerSize, n := readVarint(record)
+	if int(headerSize) > len(record) {
+		return nil, errors.New("Corrupt record header")
+	}
+
+	var serialTypes []uint64
+	for offset := n; offset < int(headerSize); {
+		serialType, n := readVarint(record[offset:])
+		serialTypes = append(serialTypes, serialType)
+		offset += n
+	}
+
+	values := make([]any, 0, len(serialTypes))
+	body := record[headerSize:]
+
+	for _, serialType := range serialTypes {
+		var size int
+		switch {
+		case serialType == 0, serialType == 8, serialType == 9:
+			size = 0
+		case serialType <= 4:
+			size = int(serialType)
+		case serialType == 5:
+			size = 6
+		case serialType == 6, serialType == 7:
+			size = 8
+		case serialType >= 12:
+			size = int(serialType-12) / 2
+		default:
+			return nil, fmt.Errorf("Unknown serial type %d", serialType)
+		}
+
+		if size > len(body) {
+			return nil, errors.New("Corrupt record body")
+		}
+		field := body[:size]
+		body = body[size:]
+
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType <= 6:
+			// Big-endian two's complement of any width
+			var value int64
+			if field[0]&0x80 != 0 {
+				value = -1
+			}
+			for _, b := range field {
+				value = value<<8 | int64(b)
+			}
+			values = append(values, value)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(field)))
+		case serialType%2 == 0:
+			values = append(values, append([]byte(nil), field...))
+		default:
+			values = append(values, string(field))
+		}
+	}
+
+	return values, nil
+}
+
+// table is a table's rows as column name to value
+func (db *database) table(name string) ([]map[string]any, error) {
+	var root uint32
+	var columns []string
+
+	// The schema lives in sqlite_master, rooted on page 1: type, name, tbl_name, rootpage, sql
+	err := db.walkTable(1, func(rowid int64, values []any) {
+		if len(values) < 5 || values[0] != "table" || values[1] != name {
+			return
+		}
+		if rootpage, ok := values[3].(int64); ok {
+			root = uint32(rootpage)
+		}
+		if sql, ok := values[4].(string); ok {
+			columns = parseColumns(sql)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if root == 0 {
+		return nil, fmt.Errorf("Table %s not found", name)
+	}
+
+	var rows []map[string]any
+	err = db.walkTable(root, func(rowid int64, values []any) {
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			// Rows written before an ALTER TABLE ADD COLUMN are shorter
+			if i < len(values) {
+				row[column] = values[i]
+			}
+		}
+		rows = append(rows, row)
+	})
+
+	return rows, err
+}
+
+// parseColumns gets the column names out of a CREATE TABLE statement
+func parseColumns(sql string) []string {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var columns []string
+	depth, defStart := 0, start+1
+	for i := start + 1; i <= end; i++ {
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')', ',':
+			if sql[i] == ')' && depth > 0 {
+				depth--
+				continue
+			}
+			if depth > 0 {
+				continue
+			}
+
+			definition := strings.Fields(sql[defStart:i])
+			defStart = i + 1
+			if len(definition) == 0 {
+				continue
+			}
+
+			switch strings.ToUpper(definition[0]) {
+			case "PRIMARY", "UNIQUE", "CONSTRAINT", "CHECK", "FOREIGN":
+				continue
+			}
+			columns = append(columns, strings.Trim(definition[0], "\"`[]"))
+		}
+	}
+
+	return columns
+}
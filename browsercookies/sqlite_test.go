@@ -0,0 +1,232 @@
+package browsercookies
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The databases in testdata are made by SQLite itself, see the comments on each test for what's in them
+
+// rowsBy indexes rows by their name column
+func rowsBy(rows []map[string]any) map[string]map[string]any {
+	byName := make(map[string]map[string]any)
+	for _, row := range rows {
+		byName[stringValue(row["name"])] = row
+	}
+	return byName
+}
+
+// cookies.sqlite has Firefox's moz_cookies table with 404 rows on 512 byte pages, so the table's b-tree has
+// interior pages. One value is big enough for overflow pages, and the last row was added after a column was.
+func TestTable(t *testing.T) {
+	db, err := openDatabase(filepath.Join("testdata", "cookies.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.table("moz_cookies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 404 {
+		t.Fatalf("Got %d rows, want 404", len(rows))
+	}
+
+	byName := rowsBy(rows)
+	cookie := byName["cookie123"]
+	want := map[string]any{
+		// The rowid alias is stored as NULL
+		"id":               nil,
+		"originAttributes": "",
+		"name":             "cookie123",
+		"value":            "value123",
+		"host":             "example23.com",
+		"path":             "/",
+		"expiry":           int64(1893456000),
+		"lastAccessed":     int64(1700000000000123),
+		"creationTime":     int64(1600000000000000),
+		"isSecure":         int64(1),
+		"isHttpOnly":       int64(0),
+		"inBrowserElement": int64(0),
+		"sameSite":         int64(0),
+		"rawSameSite":      int64(0),
+		"schemeMap":        int64(0),
+	}
+	if !reflect.DeepEqual(cookie, want) {
+		t.Errorf("Got %v, want %v", cookie, want)
+	}
+
+	if value := stringValue(byName["vs"]["value"]); value != strings.Repeat("x", 3000) {
+		t.Errorf("Value on overflow pages is %d bytes, want 3000", len(value))
+	}
+	if expiry := byName["vs"]["expiry"]; expiry != int64(-1) {
+		t.Errorf("Got expiry %v, want -1", expiry)
+	}
+	if partitioned := byName["vs_anonymous_id"]["partitioned"]; partitioned != int64(1) {
+		t.Errorf("Got partitioned %v, want 1", partitioned)
+	}
+	if _, ok := byName["sessionid"]["partitioned"]; ok {
+		t.Error("A row from before the column was added has it")
+	}
+
+	if _, err := db.table("moz_hosts"); err == nil {
+		t.Error("Read a table that isn't there")
+	}
+}
+
+// every_type in cookies.sqlite has a value of each of SQLite's storage classes and integer sizes
+func TestRecordTypes(t *testing.T) {
+	db, err := openDatabase(filepath.Join("testdata", "cookies.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.table("every_type")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]any{
+		{"a": nil, "b": int64(0), "c": int64(1), "d": int64(-2), "e": int64(70000), "f": int64(-8000000000), "g": 3.5, "h": []byte{0x00, 0xff, 0x10}},
+		{"a": "text", "b": int64(127), "c": int64(-129), "d": int64(8388608), "e": int64(140737488355328), "f": int64(9223372036854775807), "g": -0.25, "h": ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Got %v, want %v", rows, want)
+	}
+}
+
+// wal.sqlite was copied while open in WAL mode: a sessionid row was added and cookie0 changed since the last
+// checkpoint, so both are only in wal.sqlite-wal
+func TestWAL(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := os.ReadFile(filepath.Join("testdata", "wal.sqlite-wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := os.ReadFile(filepath.Join("testdata", "wal.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(wal []byte) map[string]map[string]any {
+		t.Helper()
+
+		file := filepath.Join(dir, "cookies.sqlite")
+		os.Remove(file + "-wal")
+		if err := os.WriteFile(file, main, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if wal != nil {
+			if err := os.WriteFile(file+"-wal", wal, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		db, err := openDatabase(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := db.table("moz_cookies")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rowsBy(rows)
+	}
+
+	withoutWAL := read(nil)
+	if _, ok := withoutWAL["sessionid"]; ok || len(withoutWAL) != 20 {
+		t.Fatalf("The main file already has the changes, %d rows", len(withoutWAL))
+	}
+
+	withWAL := read(wal)
+	if value := stringValue(withWAL["sessionid"]["value"]); value != "fromwal" {
+		t.Errorf("Got sessionid %q, want the one from the WAL", value)
+	}
+	if value := stringValue(withWAL["cookie0"]["value"]); value != "changed" {
+		t.Errorf("Got cookie0 %q, want the change in the WAL", value)
+	}
+
+	// A frame after the last commit isn't part of the database yet, and neither is one with other salts
+	const headerSize, frameSize = 32, 24 + 512
+	if len(wal) < headerSize+frameSize {
+		t.Fatal("WAL has no frames")
+	}
+	last := wal[len(wal)-frameSize:]
+	uncommitted := append([]byte(nil), last...)
+	binary.BigEndian.PutUint32(uncommitted[4:], 0)
+	copy(uncommitted[24:], bytes.Repeat([]byte{0xee}, 512))
+	oldSalt := append([]byte(nil), last...)
+	copy(oldSalt[24:], bytes.Repeat([]byte{0xee}, 512))
+	binary.BigEndian.PutUint32(oldSalt[8:], binary.BigEndian.Uint32(wal[16:])+1)
+
+	for name, frame := range map[string][]byte{"uncommitted": uncommitted, "other salt": oldSalt} {
+		extended := append(append([]byte(nil), wal...), frame...)
+		if rows := read(extended); stringValue(rows["cookie0"]["value"]) != "changed" {
+			t.Errorf("A frame with %s was read", name)
+		}
+	}
+
+	// A WAL for another page size is someone else's
+	otherSize := append([]byte(nil), wal...)
+	binary.BigEndian.PutUint32(otherSize[8:], 4096)
+	if rows := read(otherSize); stringValue(rows["cookie0"]["value"]) != "value0" {
+		t.Error("A WAL for another page size was read")
+	}
+}
+
+func TestFirefoxCookies(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("APPDATA", home)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "cookies.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := strings.Replace(firefoxProfiles()[0], "*", "abcd1234.default-release", 1)
+	if err := os.MkdirAll(filepath.Dir(profile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(profile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := Load("firefox", "vsco.co")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cookies for vsco.co and its subdomains, in the table's order, and not notvsco.co's
+	want := "sessionid=abc123; vs=" + strings.Repeat("x", 3000) + "; vs_anonymous_id=def456"
+	if header != want {
+		t.Errorf("Got %.80q, want %.80q", header, want)
+	}
+
+	if _, err := Load("firefox", "example.org"); err == nil {
+		t.Error("Found cookies for a site that has none")
+	}
+}
+
+func TestOpenDatabaseNotSQLite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cookies.sqlite")
+	os.WriteFile(file, bytes.Repeat([]byte("not a database "), 20), 0644)
+
+	if _, err := openDatabase(file); err == nil {
+		t.Error("Opened something that isn't a database")
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	sql := `CREATE TABLE cookies(creation_utc INTEGER NOT NULL, "host_key" TEXT NOT NULL, [name] TEXT, value TEXT DEFAULT (''), ` +
+		`expires_utc INTEGER NOT NULL, CONSTRAINT pk PRIMARY KEY (host_key, name), UNIQUE (creation_utc))`
+
+	want := []string{"creation_utc", "host_key", "name", "value", "expires_utc"}
+	if got := parseColumns(sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+
+	vsco "github.com/SilverMight/vsco-get/scraper"
+)
+
+// commands are run as `vsco-get [flags] <command> <args...>` instead of scraping a user
+var commands = map[string]struct {
+	usage string
+	run   func(args []string, options vsco.Options) error
+}{
+	"backfill-metadata": {"<username>", backfillMetadata},
+	"diff":              {"<username>", diff},
+	"favorites":         {"<your username>", favorites},
+	"tag":               {"<tag>", tag},
+	"search":            {"<query>", search},
+	"duplicates":        {"<dir>", duplicates},
+	"gallery":           {"<dir>", gallery},
+	"du":                {"<dir>", du},
+	"status":            {"<dir>", status},
+	"fix-times":         {"<dir>", fixTimes},
+	"clean-store":       {"<store dir>", cleanStore},
+}
+
+func backfillMetadata(args []string, options vsco.Options) error {
+	scraper := vsco.NewScraper(args[0], options)
+	err := scraper.GetUserInfo()
+	if err != nil {
+		return err
+	}
+
+	return scraper.BackfillMetadata()
+}
+
+func diff(args []string, options vsco.Options) error {
+	scraper := vsco.NewScraper(args[0], options)
+	err := scraper.GetUserInfo()
+	if err != nil {
+		return err
+	}
+
+	return scraper.Diff()
+}
+
+func favorites(args []string, options vsco.Options) error {
+	scraper := vsco.NewScraper(args[0], options)
+	err := scraper.GetUserInfo()
+	if err != nil {
+		return err
+	}
+
+	return scraper.SaveFavorites()
+}
+
+func tag(args []string, options vsco.Options) error {
+	return vsco.NewSearchScraper(strings.TrimPrefix(args[0], "#"), true, options).SaveSearchResults()
+}
+
+func search(args []string, options vsco.Options) error {
+	return vsco.NewSearchScraper(strings.Join(args, " "), false, options).SaveSearchResults()
+}
+
+func duplicates(args []string, options vsco.Options) error {
+	return vsco.FindDuplicates(args[0], options)
+}
+
+func gallery(args []string, options vsco.Options) error {
+	return vsco.WriteGallery(args[0], options)
+}
+
+func du(args []string, options vsco.Options) error {
+	return vsco.DiskUsage(args[0])
+}
+
+func status(args []string, options vsco.Options) error {
+	return vsco.PrintStatus(args[0])
+}
+
+func fixTimes(args []string, options vsco.Options) error {
+	return vsco.FixTimes(args[0], options)
+}
+
+func cleanStore(args []string, options vsco.Options) error {
+	return vsco.CleanStore(args[0], options)
+}
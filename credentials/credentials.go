@@ -0,0 +1,42 @@
+// Package credentials keeps tokens and session cookies in the OS keyring (Keychain, Secret Service
+// or Windows Credential Manager) so they never have to sit around in plaintext.
+package credentials
+
+import (
+	"errors"
+
+	"github.com/zalando/go-keyring"
+)
+
+const service = "vsco-get"
+
+// Names of the stored secrets
+const (
+	Token   = "token"
+	Cookies = "cookies"
+	// The refresh token of the Google Drive sign in
+	Drive = "drive"
+)
+
+// Save stores a secret in the keyring, replacing what was there
+func Save(name string, value string) error {
+	return keyring.Set(service, name, value)
+}
+
+// Load returns a stored secret, or "" if there isn't one (or there's no keyring to look in)
+func Load(name string) string {
+	value, err := keyring.Get(service, name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// Delete removes a stored secret, it isn't an error if it didn't exist
+func Delete(name string) error {
+	err := keyring.Delete(service, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
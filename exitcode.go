@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+	vsco "github.com/SilverMight/vsco-get/scraper"
+)
+
+// Exit codes, so scripts can tell what went wrong. 2 is what the flag package uses for bad flags.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitPartial      = 3
+	exitUserNotFound = 4
+	exitRateLimited  = 5
+	exitNetworkError = 6
+	exitNothingToDo  = 7
+)
+
+// exitCode picks the exit code for err. Being rate limited anywhere in the run wins, since the fix is the
+// same however many requests it hit: wait and try again.
+func exitCode(err error) int {
+	var syncErr *vsco.SyncError
+	var userErrs vsco.UserErrors
+
+	switch {
+	case err == nil:
+		return exitOK
+	case anyError(err, isRateLimited):
+		return exitRateLimited
+	case errors.As(err, &syncErr), errors.As(err, &userErrs):
+		return exitPartial
+	case errors.Is(err, vsco.ErrInvalidUsername):
+		return exitUsage
+	case errors.Is(err, vsco.ErrUserNotFound), errors.Is(err, vsco.ErrUserPrivate):
+		return exitUserNotFound
+	case anyError(err, isNetworkError):
+		return exitNetworkError
+	case errors.Is(err, vsco.ErrNothingToDo):
+		return exitNothingToDo
+	default:
+		return exitError
+	}
+}
+
+// anyError tells whether err or any error it wraps matches. Unlike errors.As, it doesn't stop at the first
+// error of the right type, which matters when several downloads failed for different reasons.
+func anyError(err error, match func(error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if match(err) {
+		return true
+	}
+
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() error }:
+		return anyError(wrapped.Unwrap(), match)
+	case interface{ Unwrap() []error }:
+		for _, err := range wrapped.Unwrap() {
+			if anyError(err, match) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isRateLimited(err error) bool {
+	statusErr, ok := err.(*httpclient.StatusError)
+	return ok && statusErr.Code == http.StatusTooManyRequests
+}
+
+// isNetworkError matches errors from making a request, and not every error with a Timeout method (syscall.Errno
+// has one, so a missing file would count)
+func isNetworkError(err error) bool {
+	switch err.(type) {
+	case *url.Error, *net.OpError, *net.DNSError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// Package gdrive uploads downloads to Google Drive. Signing in uses the OAuth device flow, where the user
+// enters a code on google.com/device, so it works without a browser on the machine running vsco-get.
+package gdrive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Google's endpoints, variables so they can be pointed elsewhere
+var (
+	deviceCodeURL = "https://oauth2.googleapis.com/device/code"
+	tokenURL      = "https://oauth2.googleapis.com/token"
+	filesURL      = "https://www.googleapis.com/drive/v3/files"
+	uploadURL     = "https://www.googleapis.com/upload/drive/v3/files"
+)
+
+// Apps signing in with the device flow only get to see the files they created themselves
+const scope = "https://www.googleapis.com/auth/drive.file"
+
+// tokenResponse is what the token endpoint answers, with an error or a token
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+func postForm(client *http.Client, endpoint string, form url.Values, v any) error {
+	resp, err := client.PostForm(endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("Unexpected response from %s (status %s): %w", endpoint, resp.Status, err)
+	}
+	return nil
+}
+
+// Authorize signs in to Google with the device flow: prompt is called with the URL to visit and the code to
+// enter there, and Authorize waits until the user has. It returns a refresh token to pass to New, which
+// stays valid until the user revokes it.
+func Authorize(clientID string, clientSecret string, prompt func(verificationURL string, userCode string)) (string, error) {
+	client := &http.Client{Timeout: timeout}
+
+	var device struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURL string `json:"verification_url"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+		Error           string `json:"error"`
+		Description     string `json:"error_description"`
+	}
+	err := postForm(client, deviceCodeURL, url.Values{"client_id": {clientID}, "scope": {scope}}, &device)
+	if err != nil {
+		return "", fmt.Errorf("Failed to start Google sign in: %w", err)
+	}
+	if device.Error != "" {
+		return "", fmt.Errorf("Failed to start Google sign in: %s %s", device.Error, device.Description)
+	}
+
+	prompt(device.VerificationURL, device.UserCode)
+
+	interval := time.Duration(max(device.Interval, 1)) * time.Second
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var token tokenResponse
+		err := postForm(client, tokenURL, url.Values{
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+			"device_code":   {device.DeviceCode},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+		}, &token)
+		if err != nil {
+			return "", fmt.Errorf("Failed to finish Google sign in: %w", err)
+		}
+
+		switch token.Error {
+		case "":
+			return token.RefreshToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return "", fmt.Errorf("Google sign in failed: %s %s", token.Error, token.Description)
+		}
+	}
+
+	return "", errors.New("Google sign in timed out, the code was never entered")
+}
+
+// accessToken returns a current access token, getting a new one with the refresh token when the last is
+// about to expire
+func (drive *Drive) accessToken() (string, error) {
+	drive.tokenMu.Lock()
+	defer drive.tokenMu.Unlock()
+
+	if drive.token != "" && time.Until(drive.expiry) > time.Minute {
+		return drive.token, nil
+	}
+
+	var token tokenResponse
+	err := postForm(drive.client, tokenURL, url.Values{
+		"client_id":     {drive.clientID},
+		"client_secret": {drive.clientSecret},
+		"refresh_token": {drive.refreshToken},
+		"grant_type":    {"refresh_token"},
+	}, &token)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get a Google access token: %w", err)
+	}
+	if token.Error != "" {
+		// invalid_grant means the sign in was revoked or has expired
+		return "", fmt.Errorf("Failed to get a Google access token: %s %s", token.Error, strings.TrimSpace(token.Description))
+	}
+
+	drive.token = token.AccessToken
+	drive.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return drive.token, nil
+}
@@ -0,0 +1,444 @@
+package gdrive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	timeout = 5 * time.Minute
+	// Resumable uploads go up in pieces of this size, it has to be a multiple of 256 KiB
+	chunkSize = 8 << 20
+	// How many times a piece is retried before giving up on the file
+	chunkRetries = 5
+
+	folderType = "application/vnd.google-apps.folder"
+	// The folder uploads go to when no folder ID is given, made in My Drive the first time
+	defaultFolder = "vsco-get"
+)
+
+// Drive uploads files into a folder on Google Drive, recreating the folders in their names below it.
+// It's a vsco.Destination.
+type Drive struct {
+	clientID     string
+	clientSecret string
+	refreshToken string
+	client       *http.Client
+
+	tokenMu sync.Mutex
+	token   string
+	expiry  time.Time
+
+	// IDs of the folders by path, "" being the one everything goes in
+	foldersMu sync.Mutex
+	folders   map[string]string
+
+	// Names of the files in each folder by its path, listed the first time Stored looks in it
+	listingsMu sync.Mutex
+	listings   map[string]map[string]bool
+}
+
+// driveFile is the part of a Drive file we look at
+type driveFile struct {
+	ID   string `json:"id"`
+	Size string `json:"size"`
+}
+
+// New connects to Drive with a refresh token from Authorize. Uploads go to the folder with folderID, which
+// vsco-get has to have created itself (Google doesn't show it anything else), or to a "vsco-get" folder in
+// My Drive if folderID is empty.
+func New(clientID string, clientSecret string, refreshToken string, folderID string) (*Drive, error) {
+	drive := &Drive{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		refreshToken: refreshToken,
+		client:       &http.Client{Timeout: timeout},
+		folders:      make(map[string]string),
+		listings:     make(map[string]map[string]bool),
+	}
+
+	if folderID == "" {
+		var err error
+		folderID, err = drive.folder("root", defaultFolder)
+		if err != nil {
+			return nil, err
+		}
+	}
+	drive.folders[""] = folderID
+
+	return drive, nil
+}
+
+// request makes an authorized request to the Drive API, decoding the JSON response into v if it's not nil
+func (drive *Drive) request(method string, endpoint string, body io.Reader, header http.Header, v any) (*http.Response, error) {
+	token, err := drive.accessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := drive.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// A 308 is how a resumable upload says it wants the rest
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusPermanentRedirect {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp, fmt.Errorf("Status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// quote makes s safe to put in a search query
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// find looks for the file called name in the folder with parentID
+func (drive *Drive) find(parentID string, name string) (*driveFile, error) {
+	query := url.Values{
+		"q":      {fmt.Sprintf("name = %s and %s in parents and trashed = false", quote(name), quote(parentID))},
+		"fields": {"files(id,size)"},
+	}
+
+	var list struct {
+		Files []driveFile `json:"files"`
+	}
+	_, err := drive.request("GET", filesURL+"?"+query.Encode(), nil, nil, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list.Files) == 0 {
+		return nil, nil
+	}
+	return &list.Files[0], nil
+}
+
+// folder returns the ID of the folder called name in the folder with parentID, creating it if needed
+func (drive *Drive) folder(parentID string, name string) (string, error) {
+	existing, err := drive.find(parentID, name)
+	if err != nil {
+		return "", fmt.Errorf("Failed to find folder %s on Google Drive: %w", name, err)
+	}
+	if existing != nil {
+		return existing.ID, nil
+	}
+
+	metadata, err := json.Marshal(map[string]any{"name": name, "mimeType": folderType, "parents": []string{parentID}})
+	if err != nil {
+		return "", err
+	}
+
+	var created driveFile
+	header := http.Header{"Content-Type": {"application/json"}}
+	_, err = drive.request("POST", filesURL, bytes.NewReader(metadata), header, &created)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create folder %s on Google Drive: %w", name, err)
+	}
+	return created.ID, nil
+}
+
+// folderPath returns the ID of the folder at dir (slash separated) below the upload folder, creating
+// what's missing. Lookups are remembered, and only one happens at a time so no folder is made twice.
+func (drive *Drive) folderPath(dir string) (string, error) {
+	drive.foldersMu.Lock()
+	defer drive.foldersMu.Unlock()
+
+	if dir == "." {
+		dir = ""
+	}
+
+	parentID := drive.folders[""]
+	current := ""
+	for _, name := range strings.Split(dir, "/") {
+		if name == "" {
+			continue
+		}
+		current = path.Join(current, name)
+
+		id, ok := drive.folders[current]
+		if !ok {
+			var err error
+			id, err = drive.folder(parentID, name)
+			if err != nil {
+				return "", err
+			}
+			drive.folders[current] = id
+		}
+		parentID = id
+	}
+
+	return parentID, nil
+}
+
+// Stored tells whether there's a file called name in Drive already, so it isn't downloaded again. Each folder
+// is listed once, the first time something in it is asked about, and Store adds what it uploads after that, so
+// later syncs in the same process (watch mode) don't download it again.
+func (drive *Drive) Stored(name string) (bool, error) {
+	dir := path.Dir(name)
+
+	drive.listingsMu.Lock()
+	defer drive.listingsMu.Unlock()
+
+	names, ok := drive.listings[dir]
+	if !ok {
+		var err error
+		names, err = drive.listFolder(dir)
+		if err != nil {
+			return false, fmt.Errorf("Failed to list %s on Google Drive: %w", dir, err)
+		}
+		drive.listings[dir] = names
+	}
+	return names[path.Base(name)], nil
+}
+
+// addToListing adds name to the listing of its folder, if Stored has listed it already
+func (drive *Drive) addToListing(name string) {
+	drive.listingsMu.Lock()
+	defer drive.listingsMu.Unlock()
+
+	if names, ok := drive.listings[path.Dir(name)]; ok {
+		names[path.Base(name)] = true
+	}
+}
+
+// listFolder returns the names of the files in the folder at dir, none if it doesn't exist yet
+func (drive *Drive) listFolder(dir string) (map[string]bool, error) {
+	names := make(map[string]bool)
+
+	parentID, err := drive.existingFolder(dir)
+	if err != nil || parentID == "" {
+		return names, err
+	}
+
+	pageToken := ""
+	for {
+		query := url.Values{
+			"q":        {fmt.Sprintf("%s in parents and trashed = false and mimeType != %s", quote(parentID), quote(folderType))},
+			"fields":   {"nextPageToken,files(name)"},
+			"pageSize": {"1000"},
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		var list struct {
+			NextPageToken string `json:"nextPageToken"`
+			Files         []struct {
+				Name string `json:"name"`
+			} `json:"files"`
+		}
+		_, err := drive.request("GET", filesURL+"?"+query.Encode(), nil, nil, &list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range list.Files {
+			names[file.Name] = true
+		}
+		if list.NextPageToken == "" {
+			return names, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// existingFolder is folderPath without creating anything, "" if the folder isn't there
+func (drive *Drive) existingFolder(dir string) (string, error) {
+	drive.foldersMu.Lock()
+	defer drive.foldersMu.Unlock()
+
+	parentID := drive.folders[""]
+	current := ""
+	for _, name := range strings.Split(dir, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		current = path.Join(current, name)
+
+		id, ok := drive.folders[current]
+		if !ok {
+			existing, err := drive.find(parentID, name)
+			if err != nil || existing == nil {
+				return "", err
+			}
+			id = existing.ID
+			drive.folders[current] = id
+		}
+		parentID = id
+	}
+
+	return parentID, nil
+}
+
+// Store uploads file as name. A file of the same name and size that's already there is left alone,
+// one of a different size gets the new contents.
+func (drive *Drive) Store(name string, file *os.File, info fs.FileInfo) error {
+	parentID, err := drive.folderPath(path.Dir(name))
+	if err != nil {
+		return err
+	}
+
+	existing, err := drive.find(parentID, path.Base(name))
+	if err != nil {
+		return fmt.Errorf("Failed to upload %s to Google Drive: %w", name, err)
+	}
+	if existing != nil && existing.Size == strconv.FormatInt(info.Size(), 10) {
+		drive.addToListing(name)
+		return nil
+	}
+
+	err = drive.upload(parentID, existing, file, info)
+	if err != nil {
+		return fmt.Errorf("Failed to upload %s to Google Drive: %w", name, err)
+	}
+	drive.addToListing(name)
+	return nil
+}
+
+// upload sends file with a resumable upload, so a dropped connection only costs the piece that was going up
+func (drive *Drive) upload(parentID string, existing *driveFile, file *os.File, info fs.FileInfo) error {
+	contentType := mime.TypeByExtension(path.Ext(info.Name()))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	metadata := map[string]any{"name": info.Name(), "modifiedTime": info.ModTime().UTC().Format(time.RFC3339)}
+	method, endpoint := "POST", uploadURL+"?uploadType=resumable"
+	if existing != nil {
+		method, endpoint = "PATCH", uploadURL+"/"+url.PathEscape(existing.ID)+"?uploadType=resumable"
+	} else {
+		metadata["parents"] = []string{parentID}
+	}
+
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{
+		"Content-Type":            {"application/json; charset=UTF-8"},
+		"X-Upload-Content-Type":   {contentType},
+		"X-Upload-Content-Length": {strconv.FormatInt(info.Size(), 10)},
+	}
+	resp, err := drive.request(method, endpoint, bytes.NewReader(body), header, nil)
+	if err != nil {
+		return err
+	}
+
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return errors.New("Google Drive didn't start the upload")
+	}
+
+	size := info.Size()
+	var offset int64
+	retries := 0
+	for {
+		done, next, err := drive.uploadChunk(session, file, offset, size)
+		if err == nil {
+			if done {
+				return nil
+			}
+			offset, retries = next, 0
+			continue
+		}
+
+		retries++
+		if retries > chunkRetries {
+			return err
+		}
+		time.Sleep(time.Duration(retries) * time.Second)
+
+		// Ask how much made it before going on
+		done, next, statusErr := drive.uploadStatus(session, size)
+		if statusErr == nil {
+			if done {
+				return nil
+			}
+			offset = next
+		}
+	}
+}
+
+// uploadChunk sends the piece of file starting at offset, and returns whether the upload is complete or
+// else where to go on from
+func (drive *Drive) uploadChunk(session string, file *os.File, offset int64, size int64) (done bool, next int64, err error) {
+	length := min(chunkSize, size-offset)
+
+	header := http.Header{"Content-Range": {fmt.Sprintf("bytes */%d", size)}}
+	if length > 0 {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+	}
+
+	resp, err := drive.request("PUT", session, io.NewSectionReader(file, offset, length), header, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	return uploadProgress(resp, offset+length)
+}
+
+// uploadStatus asks how much of the upload Google has
+func (drive *Drive) uploadStatus(session string, size int64) (done bool, next int64, err error) {
+	header := http.Header{"Content-Range": {fmt.Sprintf("bytes */%d", size)}}
+	resp, err := drive.request("PUT", session, nil, header, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	return uploadProgress(resp, 0)
+}
+
+// uploadProgress reads an upload response: done, or a 308 with the Range Google has so far ("bytes=0-1234").
+// Without a Range header, nothing is there yet.
+func uploadProgress(resp *http.Response, sent int64) (done bool, next int64, err error) {
+	if resp.StatusCode != http.StatusPermanentRedirect {
+		return true, 0, nil
+	}
+
+	received := resp.Header.Get("Range")
+	if received == "" {
+		return false, 0, nil
+	}
+
+	_, end, found := strings.Cut(received, "-")
+	last, err := strconv.ParseInt(end, 10, 64)
+	if !found || err != nil {
+		return false, sent, nil
+	}
+	return false, last + 1, nil
+}
+
+// Close has nothing to do, every upload is complete once Store returns
+func (drive *Drive) Close() error {
+	return nil
+}
@@ -2,11 +2,18 @@ module github.com/SilverMight/vsco-get
 
 go 1.21.5
 
-require github.com/schollz/progressbar/v3 v3.14.1
+require (
+	github.com/schollz/progressbar/v3 v3.14.1
+	github.com/zalando/go-keyring v0.2.6
+	golang.org/x/sync v0.10.0
+	golang.org/x/sys v0.26.0
+	golang.org/x/term v0.14.0
+)
 
 require (
+	al.essio.dev/pkg/shellescape v1.5.1 // indirect
+	github.com/danieljoos/wincred v1.2.2 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
-	golang.org/x/sys v0.14.0 // indirect
-	golang.org/x/term v0.14.0 // indirect
 )
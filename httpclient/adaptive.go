@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Requests in a row that have to go through before the pace picks up again
+	adaptiveRecovery = 20
+	// The least time between requests once throttled, and the most it's stretched to
+	adaptiveMinDelay = 250 * time.Millisecond
+	adaptiveMaxDelay = 5 * time.Second
+)
+
+// adaptive backs off when VSCO starts turning requests away: every 429 or HTML error page halves how many
+// requests may be in flight and doubles a pause between them. Once enough requests in a row go through, the
+// pause halves again and then the requests in flight grow back by one, up to the ceiling.
+type adaptive struct {
+	ceiling int
+	notify  func(message string)
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// Requests allowed in flight right now, and in flight
+	limit  int
+	active int
+	// Time between one request starting and the next, and when the last one was let through
+	delay     time.Duration
+	lastStart time.Time
+	successes int
+	// When it last slowed down
+	backedOff time.Time
+}
+
+// SetAdaptive lets at most ceiling requests be in flight at once, fewer while VSCO is rate limiting us or
+// answering with error pages, then ramps back up after a run of successful requests. notify is told when
+// the pace changes. A ceiling of 0 turns it off.
+func (client *HttpClient) SetAdaptive(ceiling int, notify func(message string)) {
+	if ceiling <= 0 {
+		client.adaptive = nil
+		return
+	}
+
+	adaptive := &adaptive{ceiling: ceiling, limit: ceiling, notify: notify}
+	adaptive.cond = sync.NewCond(&adaptive.mu)
+	client.adaptive = adaptive
+}
+
+// acquire waits for a request to be allowed to start, and returns what to call with how it went once
+// it's done
+func (adaptive *adaptive) acquire() func(throttled bool) {
+	if adaptive == nil {
+		return func(bool) {}
+	}
+
+	adaptive.mu.Lock()
+	for adaptive.active >= adaptive.limit {
+		adaptive.cond.Wait()
+	}
+	adaptive.active++
+
+	// Space requests out by the delay, taking turns
+	start := time.Now()
+	if next := adaptive.lastStart.Add(adaptive.delay); next.After(start) {
+		start = next
+	}
+	adaptive.lastStart = start
+	adaptive.mu.Unlock()
+
+	time.Sleep(time.Until(start))
+
+	var once sync.Once
+	return func(throttled bool) {
+		once.Do(func() { adaptive.release(start, throttled) })
+	}
+}
+
+// release ends a request that started at start
+func (adaptive *adaptive) release(start time.Time, throttled bool) {
+	adaptive.mu.Lock()
+	defer adaptive.mu.Unlock()
+	defer adaptive.cond.Broadcast()
+
+	adaptive.active--
+
+	if throttled {
+		adaptive.successes = 0
+		// Requests that were already in flight when it slowed down don't each halve it again
+		if start.Before(adaptive.backedOff) {
+			return
+		}
+
+		adaptive.backedOff = time.Now()
+		adaptive.limit = max(adaptive.limit/2, 1)
+		adaptive.delay = min(max(adaptive.delay*2, adaptiveMinDelay), adaptiveMaxDelay)
+		adaptive.notify(fmt.Sprintf("VSCO is turning requests away, slowing down to %d at once, %s apart", adaptive.limit, adaptive.delay))
+		return
+	}
+
+	adaptive.successes++
+	if adaptive.successes < adaptiveRecovery {
+		return
+	}
+	adaptive.successes = 0
+
+	switch {
+	case adaptive.delay > 0:
+		adaptive.delay /= 2
+		if adaptive.delay < adaptiveMinDelay {
+			adaptive.delay = 0
+		}
+	case adaptive.limit < adaptive.ceiling:
+		adaptive.limit++
+		if adaptive.limit == adaptive.ceiling {
+			adaptive.notify(fmt.Sprintf("Back to full speed, %d requests at once", adaptive.limit))
+		}
+	}
+}
+
+// throttled tells whether a response means we're going too fast: a 429, or an HTML page where the API would
+// answer with JSON or media, which is how VSCO's edge answers a burst it doesn't like. Other errors, like a 404
+// for a deleted post, say nothing about our speed.
+func throttled(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusOK, http.StatusForbidden, http.StatusServiceUnavailable:
+		return htmlPage(resp)
+	}
+	return false
+}
+
+// htmlPage tells whether resp is a web page. We only ever ask for JSON and media, so a page is an error or a
+// challenge.
+func htmlPage(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/html"
+}
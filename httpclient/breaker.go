@@ -0,0 +1,136 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long requests are held back once the circuit opens. Each failed probe doubles it, up to breakerMaxCooldown.
+const (
+	breakerCooldown    = time.Minute
+	breakerMaxCooldown = 10 * time.Minute
+)
+
+// breaker stops every request for a while once enough of them in a row have failed, so a VSCO outage doesn't
+// turn the rest of a run into hundreds of failed downloads. After the cooldown a single request goes out
+// to probe: if it works everything goes on, if not the wait starts over.
+type breaker struct {
+	threshold int
+	notify    func(message string)
+
+	mu sync.Mutex
+	// Requests in a row that failed
+	failures  int
+	cooldown  time.Duration
+	openUntil time.Time
+	probing   bool
+}
+
+// SetCircuitBreaker holds back every request once threshold requests in a row have failed with a network error,
+// a server error or an HTML page (VSCO's error pages), until a probe goes through. notify is told when that
+// happens and when requests go through again. A threshold of 0 turns it off.
+func (client *HttpClient) SetCircuitBreaker(threshold int, notify func(message string)) {
+	if threshold <= 0 {
+		client.breaker = nil
+		return
+	}
+	client.breaker = &breaker{threshold: threshold, notify: notify, cooldown: breakerCooldown}
+}
+
+// outcome is what a request says about VSCO
+type outcome int
+
+const (
+	outcomeOK outcome = iota
+	outcomeFailed
+	// Given up on by us or never sent, it says nothing either way
+	outcomeUnknown
+)
+
+// wait blocks while the circuit is open. Once the cooldown is over, one caller gets through as the probe
+// and the rest keep waiting for how it goes. The probe has to be recorded whichever way it ends, or
+// nothing gets through again.
+func (breaker *breaker) wait() (probe bool) {
+	if breaker == nil {
+		return false
+	}
+
+	for {
+		breaker.mu.Lock()
+		if breaker.failures < breaker.threshold {
+			breaker.mu.Unlock()
+			return false
+		}
+
+		wait := time.Until(breaker.openUntil)
+		if wait <= 0 && !breaker.probing {
+			breaker.probing = true
+			breaker.mu.Unlock()
+			return true
+		}
+		breaker.mu.Unlock()
+
+		time.Sleep(max(wait, time.Second))
+	}
+}
+
+// record counts how a request went, probe being whether wait let it through as the probe
+func (breaker *breaker) record(probe bool, result outcome) {
+	if breaker == nil {
+		return
+	}
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	switch result {
+	case outcomeUnknown:
+		// Let another request probe instead
+		if probe {
+			breaker.probing = false
+		}
+		return
+	case outcomeOK:
+		if breaker.failures >= breaker.threshold {
+			breaker.notify("Requests are going through again, carrying on")
+		}
+		breaker.failures, breaker.probing, breaker.cooldown = 0, false, breakerCooldown
+		return
+	}
+
+	breaker.failures++
+	switch {
+	case probe:
+		breaker.probing = false
+		breaker.cooldown = min(breaker.cooldown*2, breakerMaxCooldown)
+		breaker.openUntil = time.Now().Add(breaker.cooldown)
+		breaker.notify(fmt.Sprintf("Requests are still failing, waiting %s before trying again", breaker.cooldown))
+	case breaker.failures == breaker.threshold:
+		breaker.openUntil = time.Now().Add(breaker.cooldown)
+		breaker.notify(fmt.Sprintf("%d requests in a row failed, VSCO seems to be down. Waiting %s before trying again", breaker.threshold, breaker.cooldown))
+	}
+}
+
+// upstreamOutcome tells whether a request that ended with resp or err means VSCO isn't working right, as
+// opposed to e.g. a missing file or a rate limit
+func upstreamOutcome(resp *http.Response, err error) outcome {
+	if err != nil {
+		// Requests we gave up on ourselves say nothing about VSCO
+		if errors.Is(err, context.Canceled) {
+			return outcomeUnknown
+		}
+		return outcomeFailed
+	}
+	if resp.StatusCode >= 500 {
+		return outcomeFailed
+	}
+
+	if htmlPage(resp) {
+		return outcomeFailed
+	}
+	return outcomeOK
+}
@@ -0,0 +1,123 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotModified is returned by DownloadFile when the server says the file we already have is current
+var ErrNotModified = errors.New("Not modified")
+
+// cacheEntry is what we remember about a response. API responses keep their body so a 304 can be answered
+// from disk, downloads only keep the validators since the file itself is the cached copy.
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         []byte `json:"body,omitempty"`
+}
+
+// SetCacheDir stores response validators (and API responses) in dir, and makes requests conditional on them
+func (client *HttpClient) SetCacheDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Failed to create cache directory %s: %w\n", dir, err)
+	}
+	client.cacheDir = dir
+	return nil
+}
+
+func (client *HttpClient) cachePath(url string) string {
+	return filepath.Join(client.cacheDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(url))))
+}
+
+func (client *HttpClient) cacheLookup(url string) (cacheEntry, bool) {
+	var entry cacheEntry
+	if client.cacheDir == "" {
+		return entry, false
+	}
+
+	data, err := os.ReadFile(client.cachePath(url))
+	if err != nil || json.Unmarshal(data, &entry) != nil {
+		return entry, false
+	}
+
+	return entry, entry.ETag != "" || entry.LastModified != ""
+}
+
+// cacheStore remembers resp's validators, if it has any. Failing to is no big deal, we just download it again next time.
+func (client *HttpClient) cacheStore(url string, resp *http.Response, body []byte) {
+	if client.cacheDir == "" {
+		return
+	}
+
+	entry := cacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         body,
+	}
+	if entry.ETag == "" && entry.LastModified == "" {
+		client.cacheForget(url)
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	os.WriteFile(client.cachePath(url), data, 0644)
+}
+
+func (client *HttpClient) cacheForget(url string) {
+	if client.cacheDir != "" {
+		os.Remove(client.cachePath(url))
+	}
+}
+
+func addValidators(req *http.Request, entry cacheEntry) {
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// cachedGet is Get, except a 304 is answered with the body we saved last time
+func (client *HttpClient) cachedGet(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+
+	entry, cached := client.cacheLookup(url)
+	if cached && entry.Body != nil {
+		addValidators(req, entry)
+	}
+
+	resp, err := client.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached && entry.Body != nil:
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.ContentLength = int64(len(entry.Body))
+		resp.Body = io.NopCloser(bytes.NewReader(entry.Body))
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		client.cacheStore(url, resp, body)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return resp, nil
+}
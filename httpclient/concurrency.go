@@ -0,0 +1,41 @@
+package httpclient
+
+import (
+	"io"
+	"sync"
+)
+
+// SetMaxConcurrent caps how many requests can be in flight at once through the client, across everything using it.
+// A request counts until its response body is closed. 0 removes the cap.
+func (client *HttpClient) SetMaxConcurrent(n int) {
+	if n <= 0 {
+		client.slots = nil
+		return
+	}
+	client.slots = make(chan struct{}, n)
+}
+
+func (client *HttpClient) acquire() func() {
+	if client.slots == nil {
+		return func() {}
+	}
+
+	client.slots <- struct{}{}
+
+	var once sync.Once
+	slots := client.slots
+	return func() {
+		once.Do(func() { <-slots })
+	}
+}
+
+// releasingBody gives the request's slot back once the body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (body *releasingBody) Close() error {
+	defer body.release()
+	return body.ReadCloser.Close()
+}
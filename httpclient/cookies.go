@@ -0,0 +1,73 @@
+package httpclient
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const cookieDomain = "vsco.co"
+
+// LoadCookies takes either a raw Cookie header ("name=value; other=value") or the path to a
+// Netscape cookies.txt export, and returns the Cookie header to send to VSCO
+func LoadCookies(value string) (string, error) {
+	file, err := os.Open(value)
+	if err != nil {
+		if os.IsNotExist(err) && strings.Contains(value, "=") {
+			return value, nil
+		}
+		return "", err
+	}
+	defer file.Close()
+
+	var cookies []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// curl marks HttpOnly cookies with this prefix, they're still cookies
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// domain, include subdomains, path, secure, expiry, name, value
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return "", fmt.Errorf("Invalid line in cookies file %s: %q", value, line)
+		}
+
+		if isVSCOHost(strings.TrimPrefix(fields[0], ".")) {
+			cookies = append(cookies, fields[5]+"="+fields[6])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if len(cookies) == 0 {
+		return "", fmt.Errorf("No %s cookies found in %s", cookieDomain, value)
+	}
+
+	return strings.Join(cookies, "; "), nil
+}
+
+// SetCookies sends a logged in session's cookies with every request to VSCO
+func (client *HttpClient) SetCookies(cookies string) {
+	client.cookies = cookies
+}
+
+func (client *HttpClient) addCookies(req *http.Request) {
+	if client.cookies != "" && isVSCOHost(req.URL.Hostname()) {
+		req.Header.Set("Cookie", client.cookies)
+	}
+}
+
+// isVSCOHost tells whether host is vsco.co or one of its subdomains, and not just a name ending in it
+func isVSCOHost(host string) bool {
+	return host == cookieDomain || strings.HasSuffix(host, "."+cookieDomain)
+}
@@ -0,0 +1,271 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS record types we look up
+const (
+	typeA    = 1
+	typeAAAA = 28
+)
+
+// dohResolver looks up hostnames with DNS-over-HTTPS (RFC 8484), for networks that filter or poison
+// regular DNS. Answers are cached for as long as their TTL says.
+type dohResolver struct {
+	url string
+	// Talking to the DoH server itself uses regular DNS, unless the URL is an IP address
+	client http.Client
+
+	mu    sync.Mutex
+	cache map[string]dohAnswer
+}
+
+type dohAnswer struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// SetDoH resolves every hostname the client connects to through the DoH server at serverURL,
+// e.g. https://cloudflare-dns.com/dns-query
+func (client *HttpClient) SetDoH(serverURL string) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = client.tlsConfig()
+
+	client.doh = &dohResolver{
+		url:    serverURL,
+		client: http.Client{Timeout: timeout, Transport: transport},
+		cache:  make(map[string]dohAnswer),
+	}
+}
+
+// dialDoH connects to addr by trying each address DoH gives for its host in turn
+func (client *HttpClient) dialDoH(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := client.doh.lookup(ctx, host, network)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	return nil, dialErr
+}
+
+// lookup gets the addresses of host that can be dialed on network, IPv4 first
+func (resolver *dohResolver) lookup(ctx context.Context, host string, network string) ([]net.IP, error) {
+	var types []uint16
+	switch network {
+	case "tcp4":
+		types = []uint16{typeA}
+	case "tcp6":
+		types = []uint16{typeAAAA}
+	default:
+		types = []uint16{typeA, typeAAAA}
+	}
+
+	var ips []net.IP
+	var lookupErr error
+	for _, qtype := range types {
+		found, err := resolver.cachedQuery(ctx, host, qtype)
+		if err != nil {
+			lookupErr = err
+			continue
+		}
+		ips = append(ips, found...)
+	}
+
+	if len(ips) == 0 {
+		if lookupErr == nil {
+			lookupErr = errors.New("no addresses found")
+		}
+		return nil, fmt.Errorf("Failed to resolve %s over DNS-over-HTTPS: %w", host, lookupErr)
+	}
+	return ips, nil
+}
+
+func (resolver *dohResolver) cachedQuery(ctx context.Context, host string, qtype uint16) ([]net.IP, error) {
+	key := fmt.Sprintf("%s/%d", host, qtype)
+
+	resolver.mu.Lock()
+	answer, ok := resolver.cache[key]
+	resolver.mu.Unlock()
+	if ok && time.Now().Before(answer.expires) {
+		return answer.ips, nil
+	}
+
+	ips, ttl, err := resolver.query(ctx, host, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver.mu.Lock()
+	resolver.cache[key] = dohAnswer{ips: ips, expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+	resolver.mu.Unlock()
+
+	return ips, nil
+}
+
+// query asks the DoH server for the qtype records of host, and returns them with the shortest TTL among them
+func (resolver *dohResolver) query(ctx context.Context, host string, qtype uint16) ([]net.IP, uint32, error) {
+	message, err := dnsQuery(host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", resolver.url, bytes.NewReader(message))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := resolver.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, NewStatusError(resp)
+	}
+
+	// DNS messages are at most 64 KiB
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return dnsAnswers(body, qtype)
+}
+
+// dnsQuery builds a recursive query for the qtype records of host. The ID is 0, as RFC 8484 asks for
+// to make responses cacheable.
+func dnsQuery(host string, qtype uint16) ([]byte, error) {
+	message := []byte{
+		0, 0, // ID
+		1, 0, // Recursion desired
+		0, 1, // One question
+		0, 0, 0, 0, 0, 0,
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("Invalid hostname %q", host)
+		}
+		message = append(message, byte(len(label)))
+		message = append(message, label...)
+	}
+	message = append(message, 0)
+
+	message = binary.BigEndian.AppendUint16(message, qtype)
+	message = binary.BigEndian.AppendUint16(message, 1) // IN
+	return message, nil
+}
+
+var errMalformedDNS = errors.New("malformed DNS response")
+
+// dnsAnswers reads the qtype records out of a DNS response. CNAMEs on the way are skipped, resolvers
+// put the records they lead to in the answer too.
+func dnsAnswers(message []byte, qtype uint16) ([]net.IP, uint32, error) {
+	if len(message) < 12 {
+		return nil, 0, errMalformedDNS
+	}
+
+	switch rcode := message[3] & 0xf; rcode {
+	case 0:
+	case 3:
+		return nil, 0, errors.New("no such host")
+	default:
+		return nil, 0, fmt.Errorf("DNS server answered with error code %d", rcode)
+	}
+
+	questions := binary.BigEndian.Uint16(message[4:])
+	answers := binary.BigEndian.Uint16(message[6:])
+
+	offset := 12
+	var err error
+	for i := 0; i < int(questions); i++ {
+		offset, err = skipName(message, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += 4
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for i := 0; i < int(answers); i++ {
+		offset, err = skipName(message, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		if offset+10 > len(message) {
+			return nil, 0, errMalformedDNS
+		}
+
+		recordType := binary.BigEndian.Uint16(message[offset:])
+		class := binary.BigEndian.Uint16(message[offset+2:])
+		recordTTL := binary.BigEndian.Uint32(message[offset+4:])
+		length := int(binary.BigEndian.Uint16(message[offset+8:]))
+		offset += 10
+		if offset+length > len(message) {
+			return nil, 0, errMalformedDNS
+		}
+
+		data := message[offset : offset+length]
+		offset += length
+
+		if recordType != qtype || class != 1 || (length != net.IPv4len && length != net.IPv6len) {
+			continue
+		}
+		ips = append(ips, net.IP(append([]byte(nil), data...)))
+		if len(ips) == 1 || recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+
+	return ips, ttl, nil
+}
+
+// skipName returns the offset after the (possibly compressed) name at offset
+func skipName(message []byte, offset int) (int, error) {
+	for {
+		if offset >= len(message) {
+			return 0, errMalformedDNS
+		}
+
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			// A pointer to a name earlier on ends this one
+			return offset + 2, nil
+		}
+		offset += 1 + length
+	}
+}
@@ -0,0 +1,181 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// dnsResponse answers query with records of its type, each one an address. The names in the answers point
+// back at the question, like most servers compress them.
+func dnsResponse(query []byte, rcode byte, ttl uint32, addresses ...net.IP) []byte {
+	// The question runs from the header to the end of the query
+	question := query[12:]
+	qtype := binary.BigEndian.Uint16(question[len(question)-4:])
+
+	response := []byte{0, 0, 0x81, 0x80 | rcode, 0, 1, 0, 0, 0, 0, 0, 0}
+	response = append(response, question...)
+
+	answers := 0
+	for _, ip := range addresses {
+		data := []byte(ip.To4())
+		if qtype == typeAAAA {
+			data = ip.To16()
+		}
+		if (qtype == typeA) != (ip.To4() != nil) {
+			continue
+		}
+
+		response = append(response, 0xc0, 12)
+		response = binary.BigEndian.AppendUint16(response, qtype)
+		response = binary.BigEndian.AppendUint16(response, 1)
+		response = binary.BigEndian.AppendUint32(response, ttl)
+		response = binary.BigEndian.AppendUint16(response, uint16(len(data)))
+		response = append(response, data...)
+		answers++
+	}
+	binary.BigEndian.PutUint16(response[6:], uint16(answers))
+
+	return response
+}
+
+// queryName reads the name asked for in a query
+func queryName(query []byte) string {
+	var labels []string
+	for offset := 12; offset < len(query) && query[offset] != 0; offset += 1 + int(query[offset]) {
+		labels = append(labels, string(query[offset+1:offset+1+int(query[offset])]))
+	}
+	return strings.Join(labels, ".")
+}
+
+// newDoHServer answers for example.com with loopback addresses, and counts the queries
+func newDoHServer(queries *atomic.Int32) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		queries.Add(1)
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		if queryName(query) != "example.com" {
+			w.Write(dnsResponse(query, 3, 0))
+			return
+		}
+		w.Write(dnsResponse(query, 0, 300, net.IPv4(127, 0, 0, 1), net.IPv6loopback))
+	}))
+}
+
+func TestDoH(t *testing.T) {
+	var queries atomic.Int32
+	dohServer := newDoHServer(&queries)
+	defer dohServer.Close()
+
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer target.Close()
+
+	client := NewClient()
+	client.AddRootCert(dohServer.Certificate())
+	client.AddRootCert(target.Certificate())
+	client.SetDoH(dohServer.URL)
+
+	// example.com is in the test certificate, and only the DoH server says it's this machine
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	resp, err := client.Get("https://example.com:" + port + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("Got %q", body)
+	}
+	if queries.Load() == 0 {
+		t.Error("The DoH server wasn't asked")
+	}
+
+	// Answers are cached for their TTL
+	asked := queries.Load()
+	ips, err := client.doh.lookup(context.Background(), "example.com", "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queries.Load() != asked {
+		t.Error("A cached answer was asked for again")
+	}
+	if len(ips) != 2 || !ips[0].Equal(net.IPv4(127, 0, 0, 1)) || !ips[1].Equal(net.IPv6loopback) {
+		t.Errorf("Got %v, want IPv4 then IPv6 loopback", ips)
+	}
+
+	ips, err = client.doh.lookup(context.Background(), "example.com", "tcp6")
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv6loopback) {
+		t.Errorf("Got %v, %v for tcp6", ips, err)
+	}
+
+	_, err = client.doh.lookup(context.Background(), "nowhere.example", "tcp")
+	if err == nil || !strings.Contains(err.Error(), "no such host") {
+		t.Errorf("Got %v, want no such host", err)
+	}
+}
+
+func TestDNSQuery(t *testing.T) {
+	query, err := dnsQuery("im.vsco.co.", typeAAAA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 2, 'i', 'm', 4, 'v', 's', 'c', 'o', 2, 'c', 'o', 0, 0, 28, 0, 1}
+	if !bytes.Equal(query, want) {
+		t.Errorf("Got %x, want %x", query, want)
+	}
+
+	for _, host := range []string{"a..b", strings.Repeat("x", 64) + ".com", ""} {
+		if _, err := dnsQuery(host, typeA); err == nil {
+			t.Errorf("Made a query for %q", host)
+		}
+	}
+}
+
+func TestDNSAnswers(t *testing.T) {
+	query, _ := dnsQuery("vsco.co", typeA)
+
+	// A CNAME first, then the address it leads to, with the shortest TTL winning
+	response := []byte{0, 0, 0x81, 0x80, 0, 1, 0, 3, 0, 0, 0, 0}
+	response = append(response, query[12:]...)
+	response = append(response, 0xc0, 12, 0, 5, 0, 1, 0, 0, 0, 60, 0, 6, 3, 'c', 'd', 'n', 0xc0, 12)
+	response = append(response, 3, 'c', 'd', 'n', 0xc0, 12, 0, 1, 0, 1, 0, 0, 1, 0, 0, 4, 10, 0, 0, 1)
+	response = append(response, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 30, 0, 4, 10, 0, 0, 2)
+
+	ips, ttl, err := dnsAnswers(response, typeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 || !ips[0].Equal(net.IPv4(10, 0, 0, 1)) || !ips[1].Equal(net.IPv4(10, 0, 0, 2)) {
+		t.Errorf("Got %v", ips)
+	}
+	if ttl != 30 {
+		t.Errorf("Got a TTL of %d, want 30", ttl)
+	}
+
+	// Cut off anywhere, it's malformed rather than a panic
+	for n := 0; n < len(response); n++ {
+		if _, _, err := dnsAnswers(response[:n], typeA); err == nil {
+			t.Errorf("Response cut off at %d bytes was read", n)
+		}
+	}
+
+	servfail := []byte{0, 0, 0x81, 0x82, 0, 0, 0, 0, 0, 0, 0, 0}
+	if _, _, err := dnsAnswers(servfail, typeA); err == nil {
+		t.Error("A server failure was read")
+	}
+}
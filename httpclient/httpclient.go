@@ -1,6 +1,8 @@
 package httpclient
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -8,7 +10,26 @@ import (
 )
 
 type HttpClient struct {
-	client http.Client
+	client  http.Client
+	limiter Limiter
+	cookies string
+	tokens  *tokenPool
+	headers http.Header
+
+	cacheDir string
+	slots    chan struct{}
+	// What to dial, "tcp4" or "tcp6" to stick to one IP version
+	network string
+	// Resolves hostnames instead of the system resolver if set
+	doh *dohResolver
+	// Records every request if set
+	tracer *Tracer
+	// Holds back requests while VSCO is down if set
+	breaker *breaker
+	// Stops making requests after this many if set
+	requests *requestLimit
+	// Slows down while requests are turned away if set
+	adaptive *adaptive
 }
 
 const (
@@ -18,7 +39,28 @@ const (
 )
 
 func NewClient() *HttpClient {
-	return &HttpClient{http.Client{Timeout: timeout}}
+	client := &HttpClient{client: http.Client{Timeout: timeout}}
+	client.transport()
+	client.SetToken(authorizationToken)
+	return client
+}
+
+// SetToken replaces the built in authorization token, with or without the "Bearer " prefix
+func (client *HttpClient) SetToken(token string) {
+	client.SetTokens([]string{token})
+}
+
+// SetLimiter rate limits every request made through the client, nil removes the limit
+func (client *HttpClient) SetLimiter(limiter Limiter) {
+	client.limiter = limiter
+}
+
+// SetHeader sends an extra header with every request, replacing the default value if there is one
+func (client *HttpClient) SetHeader(name string, value string) {
+	if client.headers == nil {
+		client.headers = make(http.Header)
+	}
+	client.headers.Add(name, value)
 }
 
 func (client *HttpClient) Get(url string) (resp *http.Response, err error) {
@@ -27,33 +69,205 @@ func (client *HttpClient) Get(url string) (resp *http.Response, err error) {
 		return nil, err
 	}
 
+	if client.cacheDir != "" {
+		return client.cachedGet(req)
+	}
+
+	return client.do(req)
+}
+
+func (client *HttpClient) Head(url string) (resp *http.Response, err error) {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	return client.do(req)
 }
 
 func (client *HttpClient) do(req *http.Request) (*http.Response, error) {
-	req.Header.Add("Authorization", authorizationToken)
+	if err := client.requests.take(); err != nil {
+		return nil, err
+	}
+
+	probe := client.breaker.wait()
+
+	token := client.tokens.take()
+	req.Header.Add("Authorization", token)
 	req.Header.Add("User-Agent", userAgent)
+	client.addCookies(req)
+
+	for name, values := range client.headers {
+		req.Header[name] = values
+	}
+
+	done := client.adaptive.acquire()
+	releaseSlot := client.acquire()
+	var throttledResp bool
+	release := func() {
+		releaseSlot()
+		done(throttledResp)
+	}
+
+	if client.limiter != nil {
+		if err := client.limiter.Wait(); err != nil {
+			release()
+			client.breaker.record(probe, outcomeUnknown)
+			return nil, err
+		}
+	}
+
+	var finishTrace func(resp *http.Response, err error)
+	if client.tracer != nil {
+		finishTrace = client.tracer.start(req, time.Now(), client.headers)
+	}
+
+	resp, err := client.client.Do(req)
+	if finishTrace != nil {
+		finishTrace(resp, err)
+	}
+	client.breaker.record(probe, upstreamOutcome(resp, err))
+	throttledResp = throttled(resp)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		client.tokens.rateLimited(token, resp)
+	}
+
+	resp.Body = &releasingBody{resp.Body, release}
+
+	return resp, nil
+}
+
+// ErrTooLarge is returned by DownloadFileMax for a file over the size limit
+var ErrTooLarge = errors.New("File too large")
+
+// StatusError is a response with a status other than the one we wanted
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func NewStatusError(resp *http.Response) *StatusError {
+	return &StatusError{Code: resp.StatusCode, Status: resp.Status}
+}
 
-	return client.client.Do(req)
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("Status %s", err.Status)
 }
 
-func (client *HttpClient) DownloadFile(url string, file string) (err error) {
-	resp, err := client.Get(url)
+// DownloadFile saves url to file, creating it with perm (before umask), and returns how many bytes were written.
+// With a cache directory set and file already there, ErrNotModified means the server says it hasn't changed.
+func (client *HttpClient) DownloadFile(url string, file string, perm os.FileMode) (written int64, err error) {
+	return client.DownloadFileProgress(url, file, perm, nil)
+}
+
+// DownloadFileProgress is DownloadFile, calling progress as the file comes in with the bytes written so far
+// and the total size (-1 if the server doesn't say)
+func (client *HttpClient) DownloadFileProgress(url string, file string, perm os.FileMode, progress func(written int64, total int64)) (written int64, err error) {
+	return client.DownloadFileMax(url, file, perm, 0, progress)
+}
+
+// DownloadFileMax is DownloadFileProgress, giving up with ErrTooLarge on a file bigger than maxSize bytes (0 for
+// no limit). The Content-Length is checked before anything is written. Without one, the download stops once it's
+// past maxSize and what was written is removed.
+func (client *HttpClient) DownloadFileMax(url string, file string, perm os.FileMode, maxSize int64, progress func(written int64, total int64)) (written int64, err error) {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if entry, cached := client.cacheLookup(url); cached {
+		if _, err := os.Stat(file); err == nil {
+			addValidators(req, entry)
+		}
+	}
+
+	resp, err := client.do(req)
+	if err != nil {
+		return 0, err
 	}
 	defer resp.Body.Close()
 
-	out, err := os.Create(file)
+	if resp.StatusCode == http.StatusNotModified {
+		return 0, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, NewStatusError(resp)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return 0, fmt.Errorf("%w (%d bytes)", ErrTooLarge, resp.ContentLength)
+	}
+
+	// Don't trust the old validators until the new copy is complete
+	client.cacheForget(url)
+
+	out, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	var dst io.Writer = out
+	if progress != nil {
+		dst = &progressWriter{w: out, total: resp.ContentLength, progress: progress}
+	}
+
+	var body io.Reader = resp.Body
+	if maxSize > 0 {
+		body = io.LimitReader(resp.Body, maxSize+1)
+	}
+
+	written, err = io.Copy(dst, body)
+	if err != nil {
+		return written, err
+	}
+
+	if maxSize > 0 && written > maxSize {
+		out.Close()
+		os.Remove(file)
+		return written, fmt.Errorf("%w (over %d bytes)", ErrTooLarge, maxSize)
+	}
+
+	client.cacheStore(url, resp, nil)
+
+	return written, nil
+}
+
+// DownloadTo writes the body of url to w, bypassing the cache, and returns how many bytes were written
+func (client *HttpClient) DownloadTo(url string, w io.Writer) (written int64, err error) {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	resp, err := client.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, NewStatusError(resp)
+	}
+
+	return io.Copy(w, resp.Body)
+}
+
+// progressWriter reports how much has gone through it
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written int64, total int64)
+}
+
+func (writer *progressWriter) Write(p []byte) (int, error) {
+	n, err := writer.w.Write(p)
+	writer.written += int64(n)
+	writer.progress(writer.written, writer.total)
+	return n, err
 }
@@ -0,0 +1,215 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Limiter blocks until the next request is allowed to go out
+type Limiter interface {
+	Wait() error
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket allows rate requests per second on average, with bursts of up to burst requests
+func NewTokenBucket(rate float64, burst int) Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (bucket *tokenBucket) Wait() error {
+	bucket.mu.Lock()
+
+	now := time.Now()
+	bucket.tokens = min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	bucket.last = now
+
+	// Going negative reserves our place in line
+	bucket.tokens--
+
+	var wait time.Duration
+	if bucket.tokens < 0 {
+		wait = time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+	}
+
+	bucket.mu.Unlock()
+
+	time.Sleep(wait)
+
+	return nil
+}
+
+// sharedLimiter hands out tokens from a single bucket to every vsco-get process on the host.
+// Whichever process gets to the socket first serves the bucket, the rest ask it for tokens.
+type sharedLimiter struct {
+	mu         sync.Mutex
+	socketPath string
+	bucket     Limiter
+	listener   net.Listener
+	conn       net.Conn
+	// The processes we're serving
+	clients map[net.Conn]bool
+}
+
+// SharedLimiter is a Limiter shared with other processes. Closing it removes the socket if this process
+// is the one serving the bucket, the others take over.
+type SharedLimiter interface {
+	Limiter
+	io.Closer
+}
+
+// NewSharedLimiter coordinates rate limiting with other processes through a unix socket
+func NewSharedLimiter(socketPath string, rate float64, burst int) (SharedLimiter, error) {
+	limiter := &sharedLimiter{
+		socketPath: socketPath,
+		bucket:     NewTokenBucket(rate, burst),
+	}
+
+	err := limiter.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return limiter, nil
+}
+
+func (limiter *sharedLimiter) connect() error {
+	conn, err := net.Dial("unix", limiter.socketPath)
+	if err == nil {
+		limiter.conn = conn
+		return nil
+	}
+
+	// A socket nobody is listening on is left over from a process that died. Any other error leaves it
+	// alone, it may well be serving.
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		os.Remove(limiter.socketPath)
+	}
+
+	listener, err := net.Listen("unix", limiter.socketPath)
+	if err != nil {
+		// Another process may have just taken over
+		conn, dialErr := net.Dial("unix", limiter.socketPath)
+		if dialErr != nil {
+			return err
+		}
+		limiter.conn = conn
+		return nil
+	}
+
+	limiter.listener = listener
+	go limiter.serve()
+
+	return nil
+}
+
+// Close stops serving the bucket and removes the socket, or lets go of the connection to whoever serves it
+func (limiter *sharedLimiter) Close() error {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if limiter.listener != nil {
+		// The others notice and one of them takes over
+		for conn := range limiter.clients {
+			conn.Close()
+		}
+		// Removes the socket too
+		return limiter.listener.Close()
+	}
+	if limiter.conn != nil {
+		return limiter.conn.Close()
+	}
+	return nil
+}
+
+func (limiter *sharedLimiter) serve() {
+	for {
+		conn, err := limiter.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		limiter.mu.Lock()
+		if limiter.clients == nil {
+			limiter.clients = make(map[net.Conn]bool)
+		}
+		limiter.clients[conn] = true
+		limiter.mu.Unlock()
+
+		go func(conn net.Conn) {
+			defer func() {
+				limiter.mu.Lock()
+				delete(limiter.clients, conn)
+				limiter.mu.Unlock()
+				conn.Close()
+			}()
+
+			buf := make([]byte, 1)
+			for {
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+
+				limiter.bucket.Wait()
+
+				if _, err := conn.Write(buf); err != nil {
+					return
+				}
+			}
+		}(conn)
+	}
+}
+
+func (limiter *sharedLimiter) Wait() error {
+	limiter.mu.Lock()
+	if limiter.listener != nil {
+		limiter.mu.Unlock()
+		return limiter.bucket.Wait()
+	}
+	defer limiter.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if limiter.listener != nil {
+			return limiter.bucket.Wait()
+		}
+
+		buf := []byte{1}
+		_, err := limiter.conn.Write(buf)
+		if err == nil {
+			_, err = limiter.conn.Read(buf)
+		}
+		if err == nil {
+			return nil
+		}
+
+		// The serving process went away, take over or find whoever did
+		limiter.conn.Close()
+		limiter.conn = nil
+
+		if err := limiter.connect(); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("Lost connection to shared rate limiter")
+}
@@ -0,0 +1,48 @@
+package httpclient
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrRequestLimit is returned instead of making a request once the limit set with SetRequestLimit is used up
+var ErrRequestLimit = errors.New("Request limit reached")
+
+// requestLimit counts requests against a maximum. A nil *requestLimit is unlimited.
+type requestLimit struct {
+	max  int64
+	used atomic.Int64
+}
+
+// SetRequestLimit caps how many requests the client makes, so a run that goes wrong (paging that never
+// ends, say) can't make thousands of them. Retries count too. 0 means no limit.
+func (client *HttpClient) SetRequestLimit(max int) {
+	if max <= 0 {
+		client.requests = nil
+		return
+	}
+	client.requests = &requestLimit{max: int64(max)}
+}
+
+// ResetRequestLimit starts counting requests against the limit again, for the next run
+func (client *HttpClient) ResetRequestLimit() {
+	if client.requests != nil {
+		client.requests.used.Store(0)
+	}
+}
+
+// RequestLimitReached tells whether the next request would go over the limit
+func (client *HttpClient) RequestLimitReached() bool {
+	return client.requests != nil && client.requests.used.Load() >= client.requests.max
+}
+
+// take counts a request, or returns ErrRequestLimit if there are none left
+func (limit *requestLimit) take() error {
+	if limit == nil {
+		return nil
+	}
+	if limit.used.Add(1) > limit.max {
+		return ErrRequestLimit
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a token that got rate limited is left out of the rotation, unless the response says otherwise
+const tokenCooldown = time.Minute
+
+// tokenPool hands out authorization tokens in turn, skipping ones that were rate limited recently
+type tokenPool struct {
+	mu     sync.Mutex
+	tokens []string
+	next   int
+	// When each token can be used again, by index
+	benched []time.Time
+}
+
+// SetTokens makes the client take turns between several authorization tokens (with or without the "Bearer "
+// prefix), one request each, so a big scrape spreads over their rate limits. A token that gets rate limited
+// sits out for a while. No tokens means the built in one.
+func (client *HttpClient) SetTokens(tokens []string) {
+	if len(tokens) == 0 {
+		tokens = []string{authorizationToken}
+	}
+
+	pool := &tokenPool{benched: make([]time.Time, len(tokens))}
+	for _, token := range tokens {
+		if !strings.HasPrefix(token, "Bearer ") {
+			token = "Bearer " + token
+		}
+		pool.tokens = append(pool.tokens, token)
+	}
+	client.tokens = pool
+}
+
+// take returns the token for the next request. When they're all sitting out, it's the one that's back first.
+func (pool *tokenPool) take() string {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	now := time.Now()
+	soonest := pool.next
+	for i := range pool.tokens {
+		candidate := (pool.next + i) % len(pool.tokens)
+		if !pool.benched[candidate].After(now) {
+			soonest = candidate
+			break
+		}
+		if pool.benched[candidate].Before(pool.benched[soonest]) {
+			soonest = candidate
+		}
+	}
+
+	pool.next = (soonest + 1) % len(pool.tokens)
+	return pool.tokens[soonest]
+}
+
+// rateLimited takes token out of the rotation for as long as resp asks to wait, or tokenCooldown
+func (pool *tokenPool) rateLimited(token string, resp *http.Response) {
+	cooldown := tokenCooldown
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		cooldown = time.Duration(seconds) * time.Second
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for i := range pool.tokens {
+		if pool.tokens[i] == token {
+			pool.benched[i] = time.Now().Add(cooldown)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bodies of API responses are kept up to this size. Media isn't kept at all.
+const traceBodyLimit = 1 << 20
+
+// Headers that would give away the user's session. Headers added with SetHeader are left out too, they're
+// often a token of some sort.
+var redactedHeaders = map[string]bool{"Authorization": true, "Cookie": true, "Set-Cookie": true}
+
+// What closes a HAR file after its last entry
+const harEnd = "\n  ]\n}}\n"
+
+// Tracer records every request the client makes and what came back, for diagnosing odd API responses.
+// A path ending in .har gets a HAR file that browser dev tools can open, anything else a plain text log.
+// Both are written as requests finish, so a long run doesn't hold its whole trace in memory.
+type Tracer struct {
+	har bool
+
+	mu   sync.Mutex
+	file *os.File
+	// Entries written to the HAR file so far
+	entries int
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	QueryString []harHeader `json:"queryString"`
+	Cookies     []harHeader `json:"cookies"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Cookies     []harHeader `json:"cookies"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Requests that got no response at all say why, HAR has no place for that
+	Error string `json:"_error,omitempty"`
+}
+
+func NewTracer(path string) (*Tracer, error) {
+	tracer := &Tracer{har: strings.EqualFold(filepath.Ext(path), ".har")}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create trace file: %w", err)
+	}
+	tracer.file = file
+
+	if tracer.har {
+		var creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		creator.Name = userAgent
+		creator.Version = "1"
+		data, _ := json.Marshal(creator)
+
+		err = tracer.writeHAR(fmt.Sprintf("{\"log\": {\n  \"version\": \"1.2\",\n  \"creator\": %s,\n  \"entries\": [", data))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Failed to write trace file: %w", err)
+		}
+	}
+	return tracer, nil
+}
+
+// writeHAR appends text to the HAR file, closing it again after, so it can be opened as it is at any point
+func (tracer *Tracer) writeHAR(text string) error {
+	if _, err := tracer.file.WriteString(text + harEnd); err != nil {
+		return err
+	}
+	_, err := tracer.file.Seek(-int64(len(harEnd)), io.SeekCurrent)
+	return err
+}
+
+// SetTracer records every request made through the client to tracer, nil stops recording
+func (client *HttpClient) SetTracer(tracer *Tracer) {
+	client.tracer = tracer
+}
+
+// Save makes sure what has been recorded so far is on disk
+func (tracer *Tracer) Save() error {
+	if tracer == nil {
+		return nil
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	if err := tracer.file.Sync(); err != nil {
+		return fmt.Errorf("Failed to write trace file: %w", err)
+	}
+	return nil
+}
+
+// harHeaders lists header, leaving out the values of the session headers and of custom, the headers added
+// with SetHeader
+func harHeaders(header http.Header, custom http.Header) []harHeader {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := []harHeader{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] || custom.Values(name) != nil {
+				value = "<redacted>"
+			}
+			headers = append(headers, harHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// isText tells whether a body of this type is worth keeping: API responses and playlists, not media
+func isText(mimeType string) bool {
+	for _, kind := range []string{"json", "text/", "xml", "mpegurl", "javascript"} {
+		if strings.Contains(strings.ToLower(mimeType), kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// start begins recording req, sent at start with the custom headers added by SetHeader. The returned
+// function finishes the entry once the response is in, or the request failed.
+func (tracer *Tracer) start(req *http.Request, start time.Time, custom http.Header) func(resp *http.Response, err error) {
+	query := []harHeader{}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, harHeader{Name: name, Value: value})
+		}
+	}
+
+	entry := harEntry{
+		StartedDateTime: start.UTC().Format(time.RFC3339Nano),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header, custom),
+			QueryString: query,
+			Cookies:     []harHeader{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+
+	return func(resp *http.Response, err error) {
+		entry.Timings.Wait = milliseconds(time.Since(start))
+		entry.Time = entry.Timings.Wait
+		entry.Response = harResponse{Headers: []harHeader{}, Cookies: []harHeader{}, HeadersSize: -1, BodySize: -1}
+
+		if err != nil {
+			entry.Error = err.Error()
+			tracer.add(entry)
+			return
+		}
+
+		entry.Response.Status = resp.StatusCode
+		entry.Response.StatusText = strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+		entry.Response.HTTPVersion = resp.Proto
+		entry.Response.Headers = harHeaders(resp.Header, nil)
+		entry.Response.RedirectURL = resp.Header.Get("Location")
+		entry.Response.Content.MimeType = resp.Header.Get("Content-Type")
+
+		resp.Body = &tracingBody{
+			ReadCloser: resp.Body,
+			keep:       isText(entry.Response.Content.MimeType),
+			done: func(body *tracingBody) {
+				entry.Timings.Receive = milliseconds(time.Since(start)) - entry.Timings.Wait
+				entry.Time = milliseconds(time.Since(start))
+				entry.Response.BodySize = body.read
+				entry.Response.Content.Size = body.read
+				entry.Response.Content.Text = body.kept.String()
+				tracer.add(entry)
+			},
+		}
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (tracer *Tracer) add(entry harEntry) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	if tracer.har {
+		data, err := json.MarshalIndent(entry, "    ", "  ")
+		if err != nil {
+			return
+		}
+		separator := ","
+		if tracer.entries == 0 {
+			separator = ""
+		}
+		if tracer.writeHAR(separator+"\n    "+string(data)) == nil {
+			tracer.entries++
+		}
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s %s %s\n", entry.StartedDateTime, entry.Request.Method, entry.Request.URL)
+	for _, header := range entry.Request.Headers {
+		fmt.Fprintf(&text, "> %s: %s\n", header.Name, header.Value)
+	}
+	if entry.Error != "" {
+		fmt.Fprintf(&text, "! %s (%.0fms)\n", entry.Error, entry.Time)
+	} else {
+		fmt.Fprintf(&text, "< %d %s (%.0fms, %d bytes)\n", entry.Response.Status, entry.Response.StatusText, entry.Time, entry.Response.BodySize)
+		for _, header := range entry.Response.Headers {
+			fmt.Fprintf(&text, "< %s: %s\n", header.Name, header.Value)
+		}
+		if entry.Response.Content.Text != "" {
+			fmt.Fprintf(&text, "\n%s\n", strings.TrimRight(entry.Response.Content.Text, "\n"))
+		}
+	}
+	text.WriteString("\n")
+
+	tracer.file.WriteString(text.String())
+}
+
+// tracingBody counts what's read through it, keeping text bodies, and finishes the trace entry once it's closed
+type tracingBody struct {
+	io.ReadCloser
+	read int64
+	keep bool
+	kept strings.Builder
+	done func(body *tracingBody)
+	once sync.Once
+}
+
+func (body *tracingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.read += int64(n)
+	if body.keep && body.kept.Len() < traceBodyLimit {
+		body.kept.Write(p[:min(n, traceBodyLimit-body.kept.Len())])
+	}
+	return n, err
+}
+
+func (body *tracingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(func() { body.done(body) })
+	return err
+}
@@ -0,0 +1,112 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// Idle connections kept open to each host, so every worker (up to this many) gets one back for its next
+	// download instead of dialing and handshaking again. Go keeps only 2 otherwise.
+	maxIdleConnsPerHost = 100
+	// Idle connections kept open in total, for the API, the CDN hosts and the video hosts together
+	maxIdleConns = 4 * maxIdleConnsPerHost
+	// Read buffer of each connection, bigger than the default 4 KB so large downloads take fewer reads
+	readBufferSize = 64 << 10
+)
+
+// transport is the client's own copy of the default transport, keeping enough idle connections for every
+// worker to reuse one when downloading many files at once from the same few hosts
+func (client *HttpClient) transport() *http.Transport {
+	if client.client.Transport == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = client.dial
+		transport.MaxIdleConns = maxIdleConns
+		transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		transport.ReadBufferSize = readBufferSize
+		client.client.Transport = transport
+	}
+	return client.client.Transport.(*http.Transport)
+}
+
+// tlsConfig is the TLS setup of the client's transport, shared with the DoH resolver so both trust the same certificates
+func (client *HttpClient) tlsConfig() *tls.Config {
+	transport := client.transport()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport.TLSClientConfig
+}
+
+// AddRootCAs trusts the PEM certificates in file on top of the system's, e.g. the CA of a corporate
+// proxy or of mitmproxy
+func (client *HttpClient) AddRootCAs(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("Failed to read certificates: %w", err)
+	}
+
+	if !client.rootCAs().AppendCertsFromPEM(data) {
+		return errors.New("No PEM certificates found in " + file)
+	}
+	return nil
+}
+
+// AddRootCert trusts cert on top of the system's certificates, e.g. that of an httptest.Server
+func (client *HttpClient) AddRootCert(cert *x509.Certificate) {
+	client.rootCAs().AddCert(cert)
+}
+
+// rootCAs is the pool of certificates the client trusts, starting out as the system's
+func (client *HttpClient) rootCAs() *x509.CertPool {
+	config := client.tlsConfig()
+	if config.RootCAs == nil {
+		var err error
+		config.RootCAs, err = x509.SystemCertPool()
+		if err != nil {
+			config.RootCAs = x509.NewCertPool()
+		}
+	}
+	return config.RootCAs
+}
+
+// SetInsecure turns off checking TLS certificates. Only for debugging, anyone in the middle can read everything.
+func (client *HttpClient) SetInsecure(insecure bool) {
+	client.tlsConfig().InsecureSkipVerify = insecure
+}
+
+// SetIPVersion makes the client only connect over IPv4 (4) or IPv6 (6), for networks that route to the CDN
+// badly over the other. Anything else, like 0, uses both.
+func (client *HttpClient) SetIPVersion(version int) {
+	switch version {
+	case 4, 6:
+		client.network = fmt.Sprintf("tcp%d", version)
+	default:
+		client.network = ""
+	}
+
+	client.transport()
+}
+
+// The same as the default transport's
+var dialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+func (client *HttpClient) dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if client.network != "" {
+		network = client.network
+	}
+	if client.doh != nil {
+		return client.dialDoH(ctx, network, addr)
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,118 @@
+package vscotest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// The profiles every server starts with, one file per user: the site as /sites answers with it, its media
+// newest first, and the media in its favorites collection, all in the API's own format. Media is on
+// mediaHost, which the server swaps for itself.
+//
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// A short fragmented MP4 with an H.264 and an AAC track, served for every video. The frames are filler, but
+// the boxes are all there, so the audio can be extracted.
+//
+//go:embed media/video.mp4
+var videoMP4 []byte
+
+// The host media URLs in the fixtures point at
+const mediaHost = "im.vsco.co"
+
+// User is a profile the server knows about
+type User struct {
+	Site      json.RawMessage   `json:"site"`
+	Media     []json.RawMessage `json:"media"`
+	Favorites []json.RawMessage `json:"favorites"`
+	// Whether the media endpoint turns us away
+	Private bool `json:"private"`
+
+	// Pulled out of Site to answer the endpoints that use them
+	id           int
+	collectionID string
+}
+
+func (user *User) parseSite() error {
+	var site struct {
+		ID               int    `json:"id"`
+		SiteCollectionID string `json:"site_collection_id"`
+	}
+	if err := json.Unmarshal(user.Site, &site); err != nil {
+		return err
+	}
+
+	user.id, user.collectionID = site.ID, site.SiteCollectionID
+	return nil
+}
+
+func loadFixtures() (map[string]*User, error) {
+	entries, err := fixtures.ReadDir("fixtures")
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]*User)
+	for _, entry := range entries {
+		data, err := fixtures.ReadFile(path.Join("fixtures", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		user := &User{}
+		if err := json.Unmarshal(data, user); err != nil {
+			return nil, fmt.Errorf("Failed to decode fixture %s: %w", entry.Name(), err)
+		}
+		if err := user.parseSite(); err != nil {
+			return nil, fmt.Errorf("Failed to decode site in fixture %s: %w", entry.Name(), err)
+		}
+
+		users[strings.TrimSuffix(entry.Name(), ".json")] = user
+	}
+
+	return users, nil
+}
+
+// generateUser makes a profile with count images, one uploaded a day going back from the start of 2024
+func generateUser(username string, id int, count int) *User {
+	site, _ := json.Marshal(map[string]any{
+		"id":                 id,
+		"name":               username,
+		"subdomain":          username,
+		"profile_image":      fmt.Sprintf("%s/generated/%d/avatar.jpg", mediaHost, id),
+		"site_collection_id": "",
+		"status":             "active",
+		"media_count":        count,
+	})
+
+	user := &User{Site: site, id: id}
+	uploaded := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < count; i++ {
+		mediaID := fmt.Sprintf("%012x%012x", id, i)
+		date := uploaded.AddDate(0, 0, -i).UnixMilli()
+
+		media, _ := json.Marshal(map[string]any{
+			"_id":             mediaID,
+			"caption":         fmt.Sprintf("Photo %d", count-i),
+			"capture_date":    date,
+			"has_audio":       nil,
+			"height":          1000,
+			"is_video":        false,
+			"perma_subdomain": username,
+			"permalink":       fmt.Sprintf("https://vsco.co/%s/media/%s", username, mediaID),
+			"playback_url":    "",
+			"responsive_url":  fmt.Sprintf("%s/generated/%d/%s/vsco%s.jpg", mediaHost, id, mediaID, mediaID),
+			"upload_date":     date,
+			"video_url":       "",
+			"width":           1000,
+		})
+		user.Media = append(user.Media, media)
+	}
+
+	return user
+}
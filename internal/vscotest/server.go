@@ -0,0 +1,421 @@
+// Package vscotest is a fake VSCO for trying the scraper out without the network. It serves the API
+// endpoints vsco-get uses from the profiles in fixtures/ (plus any added with AddUser), and small but
+// valid files for the media they link to. Requests can be made to fail, and are counted.
+//
+//	server := vscotest.NewServer()
+//	defer server.Close()
+//	defer server.Install()()
+//
+//	scraper := vsco.NewScraper("sample", options)
+//
+// The scraper keeps some state in the user's config directory, like the API response format it last saw,
+// so tests should point that at a temporary one (XDG_CONFIG_HOME on Linux).
+package vscotest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+	vsco "github.com/SilverMight/vsco-get/scraper"
+)
+
+// What every media file says it was last modified, so downloads get the same mtime every time
+var LastModified = time.Date(2023, time.September, 1, 12, 0, 0, 0, time.UTC)
+
+// Server is a running fake VSCO, serving the API under /api/2.0 and media everywhere else
+type Server struct {
+	// Like https://127.0.0.1:1234
+	URL string
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	users    map[string]*User
+	failures []*failure
+	// Bodies to answer media requests with instead of the media, by path prefix
+	substitutes map[string]substitute
+	// Paths in the order they were asked for
+	requests []string
+}
+
+// failure makes the next times requests under prefix answer with status
+type failure struct {
+	prefix string
+	status int
+	times  int
+}
+
+// substitute is what a media request is answered with instead of the media, with a 200 like the CDN does
+type substitute struct {
+	contentType string
+	body        []byte
+}
+
+// NewServer starts a server with the fixtures loaded, it has to be closed when done
+func NewServer() *Server {
+	users, err := loadFixtures()
+	if err != nil {
+		panic(err)
+	}
+
+	server := &Server{users: users, substitutes: make(map[string]substitute)}
+	server.server = httptest.NewTLSServer(http.HandlerFunc(server.serve))
+	server.URL = server.server.URL
+
+	return server
+}
+
+// Close shuts the server down
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+// Client returns an HTTP client that trusts the server's certificate
+func (server *Server) Client() *httpclient.HttpClient {
+	client := httpclient.NewClient()
+	client.AddRootCert(server.server.Certificate())
+	return client
+}
+
+// Install points the scraper package at the server, until the returned function puts the real VSCO back
+func (server *Server) Install() (restore func()) {
+	vsco.SetClient(server.Client())
+	vsco.SetAPIURL(server.URL + "/api/2.0")
+
+	return func() {
+		vsco.SetClient(httpclient.NewClient())
+		vsco.SetAPIURL("https://vsco.co/api/2.0")
+	}
+}
+
+// User returns the profile of username, nil if there isn't one. Changes to it show up in later responses.
+func (server *Server) User(username string) *User {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.users[strings.ToLower(username)]
+}
+
+// AddUser adds a profile with count generated images, replacing any user of that name
+func (server *Server) AddUser(username string, count int) *User {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	id := 5000 + len(server.users)
+	user := generateUser(username, id, count)
+	server.users[strings.ToLower(username)] = user
+	return user
+}
+
+// RemoveUser makes username not exist anymore
+func (server *Server) RemoveUser(username string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	delete(server.users, strings.ToLower(username))
+}
+
+// Fail makes the next times requests for paths starting with prefix fail with status, e.g.
+// Fail("/api/2.0/medias", http.StatusTooManyRequests, 2)
+func (server *Server) Fail(prefix string, status int, times int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.failures = append(server.failures, &failure{prefix, status, times})
+}
+
+// ServeInstead makes requests for media under prefix succeed with body instead of the media, like the CDN
+// sending an error page or a placeholder with a 200
+func (server *Server) ServeInstead(prefix string, contentType string, body []byte) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.substitutes[prefix] = substitute{contentType, body}
+}
+
+// Requests counts the requests so far for paths starting with prefix, "" counting all of them
+func (server *Server) Requests(prefix string) int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	count := 0
+	for _, requested := range server.requests {
+		if strings.HasPrefix(requested, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// injectedFailure returns the status to fail the request for path with, 0 to answer it
+func (server *Server) injectedFailure(requestPath string) int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.requests = append(server.requests, requestPath)
+
+	for _, failure := range server.failures {
+		if failure.times > 0 && strings.HasPrefix(requestPath, failure.prefix) {
+			failure.times--
+			return failure.status
+		}
+	}
+	return 0
+}
+
+func (server *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if status := server.injectedFailure(r.URL.Path); status != 0 {
+		if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "1")
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	endpoint, isAPI := strings.CutPrefix(r.URL.Path, "/api/2.0/")
+	if !isAPI {
+		server.serveMedia(w, r)
+		return
+	}
+
+	// Like VSCO, the API only answers requests with a token
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	size, _ := strconv.Atoi(query.Get("size"))
+	if size <= 0 {
+		size = vsco.PageSize
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	parts := strings.Split(endpoint, "/")
+	switch {
+	case endpoint == "sites":
+		user := server.users[strings.ToLower(query.Get("subdomain"))]
+		if user == nil {
+			http.Error(w, `{"error":"site_not_found"}`, http.StatusNotFound)
+			return
+		}
+		server.writeJSON(w, map[string]any{"sites": []json.RawMessage{user.Site}})
+
+	case endpoint == "medias":
+		siteID, _ := strconv.Atoi(query.Get("site_id"))
+		user := server.userBy(func(user *User) bool { return user.id == siteID })
+		if user == nil {
+			http.Error(w, `{"error":"site_not_found"}`, http.StatusNotFound)
+			return
+		}
+		if user.Private {
+			http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+			return
+		}
+		// Profile pages start at 0
+		server.writeJSON(w, map[string]any{"media": pageOf(user.Media, page, size), "page": page, "size": size, "total": len(user.Media)})
+
+	case len(parts) == 2 && parts[0] == "medias":
+		media := server.mediaByID(parts[1])
+		if media == nil {
+			http.Error(w, `{"error":"media_not_found"}`, http.StatusNotFound)
+			return
+		}
+		server.writeJSON(w, map[string]any{"media": media})
+
+	case len(parts) == 3 && parts[0] == "collections" && parts[2] == "medias":
+		user := server.userBy(func(user *User) bool { return user.collectionID != "" && user.collectionID == parts[1] })
+		if user == nil {
+			http.Error(w, `{"error":"collection_not_found"}`, http.StatusNotFound)
+			return
+		}
+		// Collection pages start at 1
+		server.writeJSON(w, map[string]any{"media": pageOf(user.Favorites, page-1, size), "page": page, "size": size, "total": len(user.Favorites)})
+
+	case len(parts) == 3 && parts[0] == "tags" && parts[2] == "medias":
+		results := server.tagged(parts[1])
+		server.writeJSON(w, map[string]any{"media": pageOf(results, page, size), "page": page, "size": size, "total": len(results)})
+
+	case endpoint == "search/images":
+		results := server.search(query.Get("query"))
+		server.writeJSON(w, map[string]any{"results": pageOf(results, page, size), "page": page, "size": size, "total": len(results)})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// userBy finds the first user match is true for, in username order so it's always the same one
+func (server *Server) userBy(match func(user *User) bool) *User {
+	usernames := make([]string, 0, len(server.users))
+	for username := range server.users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	for _, username := range usernames {
+		if match(server.users[username]) {
+			return server.users[username]
+		}
+	}
+	return nil
+}
+
+func (server *Server) mediaByID(id string) json.RawMessage {
+	var found json.RawMessage
+	server.userBy(func(user *User) bool {
+		for _, media := range user.Media {
+			if mediaField(media, "_id") == id {
+				found = media
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// search finds every media whose caption has query in it, hashtags included
+func (server *Server) search(query string) []json.RawMessage {
+	query = strings.ToLower(strings.TrimPrefix(query, "#"))
+
+	var results []json.RawMessage
+	server.userBy(func(user *User) bool {
+		for _, media := range user.Media {
+			if query != "" && strings.Contains(strings.ToLower(mediaField(media, "caption")), query) {
+				results = append(results, media)
+			}
+		}
+		return false
+	})
+	return results
+}
+
+// tagged finds every media with #tag in its caption
+func (server *Server) tagged(tag string) []json.RawMessage {
+	tag = "#" + strings.ToLower(tag)
+
+	var results []json.RawMessage
+	server.userBy(func(user *User) bool {
+		for _, media := range user.Media {
+			for _, word := range strings.Fields(strings.ToLower(mediaField(media, "caption"))) {
+				if strings.TrimRight(word, ".,!?") == tag {
+					results = append(results, media)
+					break
+				}
+			}
+		}
+		return false
+	})
+	return results
+}
+
+func mediaField(media json.RawMessage, name string) string {
+	var fields map[string]any
+	if json.Unmarshal(media, &fields) != nil {
+		return ""
+	}
+	value, _ := fields[name].(string)
+	return value
+}
+
+// pageOf returns page (counting from 0) of items, empty past the end
+func pageOf(items []json.RawMessage, page int, size int) []json.RawMessage {
+	start := max(page, 0) * size
+	if start >= len(items) {
+		return []json.RawMessage{}
+	}
+	return items[start:min(start+size, len(items))]
+}
+
+// writeJSON answers with v, pointing its media URLs at the server
+func (server *Server) writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// With the scheme, a host with a port in it wouldn't parse as a URL
+	data = bytes.ReplaceAll(data, []byte(mediaHost), []byte(server.URL))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// serveMedia answers with a file for any path, the same one every time: a small JPEG for images, a short MP4
+// for videos, filler bytes for anything else. Ranges and conditional requests work like on the CDN.
+func (server *Server) serveMedia(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	for prefix, substitute := range server.substitutes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			server.mu.Unlock()
+			w.Header().Set("Content-Type", substitute.contentType)
+			w.Write(substitute.body)
+			return
+		}
+	}
+	server.mu.Unlock()
+
+	var content []byte
+	switch strings.ToLower(path.Ext(r.URL.Path)) {
+	case ".jpg", ".jpeg":
+		content = fakeJPEG(r.URL.Path)
+		w.Header().Set("Content-Type", "image/jpeg")
+	case ".mp4":
+		content = fakeMP4(r.URL.Path)
+		w.Header().Set("Content-Type", "video/mp4")
+	case "":
+		http.NotFound(w, r)
+		return
+	default:
+		content = []byte(fmt.Sprintf("fake media %s\n", r.URL.Path))
+	}
+
+	http.ServeContent(w, r, path.Base(r.URL.Path), LastModified, bytes.NewReader(content))
+}
+
+// fakeMP4 is the MP4 in media/ with a free box after it naming the file, so different files have different contents
+func fakeMP4(name string) []byte {
+	note := fmt.Sprintf("fake video %s\n", name)
+	content := append([]byte(nil), videoMP4...)
+	content = binary.BigEndian.AppendUint32(content, uint32(8+len(note)))
+	content = append(content, "free"...)
+	return append(content, note...)
+}
+
+// fakeJPEG is a 16x16 image in a color picked by name, so different files have different contents
+func fakeJPEG(name string) []byte {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	sum := hash.Sum32()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	fill := color.RGBA{uint8(sum), uint8(sum >> 8), uint8(sum >> 16), 255}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, nil)
+	return buf.Bytes()
+}
@@ -5,44 +5,723 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/SilverMight/vsco-get/browsercookies"
+	"github.com/SilverMight/vsco-get/credentials"
+	"github.com/SilverMight/vsco-get/httpclient"
+	"github.com/SilverMight/vsco-get/schedule"
 	vsco "github.com/SilverMight/vsco-get/scraper"
+	"github.com/SilverMight/vsco-get/telemetry"
 )
 
+// headerFlags collects every -header given on the command line
+type headerFlags []string
+
+func (headers *headerFlags) String() string {
+	return strings.Join(*headers, ", ")
+}
+
+func (headers *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("Expected \"Name: value\", got %q", value)
+	}
+	*headers = append(*headers, value)
+	return nil
+}
+
 func main() {
 	usernameList := flag.String("l", "", "Scrape from text file containing a list of usernames for batch scraping (one per line).")
+	outputDir := flag.String("output", "", "Put user folders in this directory instead of the working directory. \"-\" streams everything to stdout as a tar instead.")
+	flag.StringVar(outputDir, "o", "", "Short for --output.")
 	numWorkers := flag.Int("w", 30, "Number of concurrent workers to download images.")
+	parallelUsers := flag.Int("parallel-users", 1, "With -l, how many users to sync at the same time.")
+	forceIPv4 := flag.Bool("force-ipv4", false, "Only connect over IPv4.")
+	forceIPv6 := flag.Bool("force-ipv6", false, "Only connect over IPv6.")
+	doh := flag.String("doh", "", "Look up hostnames through this DNS-over-HTTPS server instead of the system's DNS, e.g. https://cloudflare-dns.com/dns-query.")
+	caCert := flag.String("cacert", "", "Also trust the PEM certificates in this file, e.g. the CA of a corporate proxy or mitmproxy.")
+	insecure := flag.Bool("insecure", false, "Don't check TLS certificates. Only for debugging.")
+	drive := flag.Bool("drive", false, "Upload downloads to Google Drive instead of keeping them. Needs --drive-client-id and --drive-client-secret.")
+	driveFolder := flag.String("drive-folder", "", "ID of the Google Drive folder to upload to, one vsco-get created. Defaults to a vsco-get folder in My Drive.")
+	driveClientID := flag.String("drive-client-id", "", "OAuth client ID (of type \"TVs and Limited Input devices\") to sign in to Google Drive with.")
+	driveClientSecret := flag.String("drive-client-secret", "", "The secret of --drive-client-id.")
+	statsCSV := flag.String("stats-csv", "", "Append a row per synced user (items, bytes, failures, time, speed) to this CSV file.")
+	tracePath := flag.String("trace", "", "Record every HTTP request and response to this file, as a HAR file if it ends in .har or a text log otherwise. Session cookies, tokens and --header values are left out.")
+	circuitBreaker := flag.Int("circuit-breaker", 10, "After this many requests in a row fail (network errors, server errors, error pages), hold back every request for a minute and then try one, instead of failing everything left (0 turns it off).")
+	maxConnections := flag.Int("max-connections", 0, "Maximum simultaneous requests across all users and workers (0 for unlimited).")
 	getProfilePicture := flag.Bool("p", false, "Get profile pictures of a user.")
+	avatarSizes := flag.String("avatar-sizes", "", "With -p, also download the profile picture at these widths (e.g. 150,300,1000) besides the original.")
+	avatarHistory := flag.Bool("avatar-history", false, "With -p, keep every profile picture under a dated name instead of overwriting it, skipping unchanged ones.")
+	writeMetadata := flag.Bool("m", false, "Write a .json metadata sidecar (caption, dates, dimensions) next to each file.")
+	dirMode := flag.String("dir-mode", "", "Octal permissions for created directories (default 0755, the umask still applies).")
+	fileMode := flag.String("file-mode", "", "Octal permissions for created files (default 0666, the umask still applies).")
+	onConflict := flag.String("on-conflict", "skip", "What to do when a file already exists: skip, overwrite or rename.")
+	force := flag.Bool("force", false, "Download everything again, even files that already exist (e.g. to replace corrupted ones).")
+	dryRun := flag.Bool("dry-run", false, "Print what would be downloaded without downloading or writing anything.")
+	estimateSize := flag.Bool("estimate-size", false, "With -dry-run, also report the total download size (one HEAD request per item).")
+	checkSpace := flag.Bool("check-space", false, "Before downloading, check the estimated size against the free disk space and abort if it won't fit.")
+	getURLs := flag.Bool("get-urls", false, "Only print the direct image/video URLs, one per line, for use with other download tools.")
+	maxBytes := flag.String("max-bytes", "", "Stop after downloading this much (e.g. 500MB, 2GB), the rest is picked up by the next run.")
+	prune := flag.Bool("prune", false, "After syncing, delete local media that no longer exists on the profile.")
+	pruneToTrash := flag.Bool("prune-to-trash", false, "With -prune, move the files to a trash/ folder instead of deleting them.")
+	mirror := flag.Bool("mirror", false, "Make the local folder an exact copy of the profile: download new media, prune deleted media and refresh all metadata.")
+	idList := flag.String("ids", "", "Only download the media IDs (or post URLs) listed in this file, one per line.")
+	excludeIDList := flag.String("exclude-ids", "", "Never download the media IDs (or post URLs) listed in this file, one per line.")
+	maxItems := flag.Int("max-items", 0, "Download at most this many new media per user, newest first (0 for no limit).")
+	since := flag.String("since", "", "Skip media uploaded before this date (YYYY-MM-DD).")
+	videoQuality := flag.String("video-quality", vsco.QualityBest, "Which stream of streamed (HLS) videos to download: best, worst, or the best up to a height like 1080 or 720.")
+	extractAudio := flag.Bool("extract-audio", false, "Also save the audio track of new videos as .m4a next to them.")
+	videoPosters := flag.Bool("video-posters", false, "Also save the poster frame of new videos as a .jpg with the same name.")
+	writeFeed := flag.Bool("feed", false, "After syncing a user, write an Atom feed of their newest media (linking to the local files) to feed.xml in their folder.")
+	thumbnails := flag.Bool("thumbnails", false, "Also save a small copy of new images (and of videos, from their poster) in a .thumbs folder, used by the gallery command.")
+	fastUpdate := flag.Bool("fast-update", false, "Stop listing a profile at the first page that's all saved already, instead of going through its whole history. Can't be used with --prune, --mirror or --force.")
+	newerThanLocal := flag.Bool("newer-than-local", false, "Only download media uploaded after the newest one already in the user's folder (by its file time), and stop listing there. Can't be used with --prune or --mirror.")
+	saveJSON := flag.Bool("save-json", false, "Keep every API response (the profile and each page of media) exactly as it came in, in an _api folder in the user's folder.")
+	noDownload := flag.Bool("no-download", false, "Only save metadata: a .json sidecar for every post, a manifest.json listing them and profile.json, without downloading any media. Can't be used with --prune or --mirror.")
+	writeXMP := flag.Bool("xmp", false, "Write an .xmp sidecar (caption, dates, uploader) next to each file for Lightroom, digiKam and the like. Along with -m both sidecars are written.")
+	writeLocation := flag.Bool("location", false, "Keep the location posts are tagged with, in the metadata sidecars and the EXIF of downloaded JPEGs. Off by default for privacy.")
+	captionFilenames := flag.Bool("caption-filenames", false, "Add a short slug of the caption to filenames, like vsco5f1a2b3_sunset-at-the-pier.jpg.")
+	includeTypes := flag.String("include-types", "", "Only download media of these types, by file extension, comma separated (e.g. jpg,mp4).")
+	minWidth := flag.Int("min-width", 0, "Skip media narrower than this many pixels, like screenshots and small reposts.")
+	minHeight := flag.Int("min-height", 0, "Skip media shorter than this many pixels.")
+	maxFileSize := flag.String("max-filesize", "", "Skip media bigger than this (e.g. 50MB), like long videos.")
+	maxRequests := flag.Int("max-requests", 0, "Stop after this many HTTP requests in a run (retries included), leaving the rest for the next run. 0 for no limit.")
+	sleepInterval := flag.String("sleep-interval", "", "Wait a random time in this range before each download, in each worker, like 2s-5s (bare numbers are seconds).")
+	noAdaptive := flag.Bool("no-adaptive", false, "Keep -w workers going when VSCO starts answering with 429s or error pages, instead of slowing down until it stops.")
+	autoWorkers := flag.Bool("auto-workers", false, fmt.Sprintf("Start with a few workers and add more while downloads keep getting faster, settling once more don't help. -w is the most it goes up to (%d if not given).", vsco.MaxAutoWorkers))
+	pageSize := flag.Int("page-size", vsco.PageSize, fmt.Sprintf("How many media to list per API request (%d to %d). Smaller pages mean more requests, but less lost to a rate limited one.", vsco.MinPageSize, vsco.PageSize))
+	order := flag.String("order", "", "Download in this order: newest (the default), oldest (by upload date) or size-asc (smallest files first).")
+	pauseFile := flag.String("pause-file", "", "Hold back new downloads while this file exists, e.g. touch it to pause and delete it to resume. SIGUSR1 toggles pausing too.")
+	linkStore := flag.String("link-store", "", "Keep one copy of each distinct file in this directory and hard link downloads to it, so files reposted by several users only take space once.")
+	strict := flag.Bool("strict", false, "Stop with an error on media of a type vsco-get doesn't know how to download, instead of skipping it.")
+	saveUnknown := flag.Bool("save-unknown", false, "Save the raw JSON of media vsco-get doesn't know how to download to <user>/unknown/<id>.json.")
+	siteCacheTTL := flag.Duration("site-cache", 0, "Cache user lookups on disk for this long (e.g. 24h), saving a request per user on recurring batch runs.")
+	httpCache := flag.Bool("http-cache", false, "Remember ETag/Last-Modified of API responses and profile pictures, so unchanged ones aren't downloaded again.")
+	noMtime := flag.Bool("no-mtime", false, "Don't set file modification times to the upload date.")
+	rate := flag.Float64("rate", 0, "Maximum requests per second (0 for unlimited).")
+	rateSocket := flag.String("rate-socket", "", "Share the -rate limit with other vsco-get processes through this local socket.")
+	token := flag.String("token", "", "Authorization token to use instead of the built in one, e.g. after VSCO rotates it or to use your own session's. Several tokens separated by commas are used in turn, to spread a big scrape over their rate limits.")
+	var headers headerFlags
+	flag.Var(&headers, "header", "Extra \"Name: value\" header to send with every request (can be repeated).")
+	cookies := flag.String("cookies", "", "Use a logged in session: a cookie string (\"name=value; ...\") or a cookies.txt file exported from your browser.")
+	cookiesFromBrowser := flag.String("cookies-from-browser", "", "Use the VSCO session you're logged in to in this browser (firefox, chrome or chromium).")
+	saveCredentials := flag.Bool("save-credentials", false, "Store the given -token and cookies in the OS keyring, they are used automatically on later runs.")
+	forgetCredentials := flag.Bool("forget-credentials", false, "Remove the token and cookies stored with -save-credentials.")
+	watchSchedule := flag.String("watch", "", "Keep running and re-sync media on this cron schedule (e.g. \"0 */6 * * *\").")
+	avatarExpr := flag.String("avatar-schedule", "", "In -watch mode, also refresh profile pictures on this separate cron schedule (e.g. \"@weekly\").")
+	usageStats := flag.Bool("usage-stats", false, "Record anonymous usage counts to a local file you can attach to bug reports. Nothing is ever sent.")
 
 	flag.Parse()
 	args := flag.Args()
 
-	if len(args) > 0 {
-		scraper := vsco.NewScraper(args[0], *numWorkers)
-		err := scraper.GetUserInfo()
-		if err != nil {
-			log.Fatal(err)
+	if *usageStats {
+		telemetry.Enable()
+		flag.Visit(func(f *flag.Flag) {
+			telemetry.Feature("-" + f.Name)
+		})
+	}
+	defer saveUsageStats()
+
+	// With -auto-workers, -w is only how far it may go
+	if *autoWorkers {
+		workersGiven := false
+		flag.Visit(func(f *flag.Flag) {
+			workersGiven = workersGiven || f.Name == "w"
+		})
+		if !workersGiven {
+			*numWorkers = vsco.MaxAutoWorkers
 		}
+	}
 
-		if *getProfilePicture {
-			err := scraper.SaveProfilePicture()
+	var err error
+
+	client := httpclient.NewClient()
+	if *rate > 0 {
+		if *rateSocket != "" {
+			limiter, err := httpclient.NewSharedLimiter(*rateSocket, *rate, 1)
 			if err != nil {
-				log.Fatal(err)
+				fatal(fmt.Errorf("Failed to set up shared rate limit on %s: %w", *rateSocket, err))
 			}
+			client.SetLimiter(limiter)
+			sharedLimiter = limiter
+			defer closeSharedLimiter()
 		} else {
-			err = scraper.SaveAllMedia()
-			if err != nil {
-				log.Fatal(err)
+			client.SetLimiter(httpclient.NewTokenBucket(*rate, 1))
+		}
+	}
+	client.SetMaxConcurrent(*maxConnections)
+	client.SetCircuitBreaker(*circuitBreaker, func(message string) { log.Print(message) })
+	client.SetRequestLimit(*maxRequests)
+	if !*noAdaptive {
+		// Every worker of every user downloading, plus each user's listing
+		client.SetAdaptive(max(*numWorkers+1, 1)*max(*parallelUsers, 1), func(message string) { log.Print(message) })
+	}
+	if *forceIPv4 && *forceIPv6 {
+		fatal(fmt.Errorf("Only one of --force-ipv4 and --force-ipv6 can be given"))
+	}
+	if *forceIPv4 {
+		client.SetIPVersion(4)
+	}
+	if *forceIPv6 {
+		client.SetIPVersion(6)
+	}
+	if *caCert != "" {
+		if err := client.AddRootCAs(*caCert); err != nil {
+			fatal(err)
+		}
+	}
+	if *insecure {
+		log.Print("Warning: not checking TLS certificates (--insecure)")
+		client.SetInsecure(true)
+	}
+	if *doh != "" {
+		client.SetDoH(*doh)
+	}
+	if *tracePath != "" {
+		tracer, err = httpclient.NewTracer(*tracePath)
+		if err != nil {
+			fatal(err)
+		}
+		client.SetTracer(tracer)
+		defer saveTrace()
+	}
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		client.SetHeader(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	tokenValue, cookieHeader := *token, ""
+	if *cookies != "" {
+		cookieHeader, err = httpclient.LoadCookies(*cookies)
+		if err != nil {
+			fatal(fmt.Errorf("Failed to load cookies: %w", err))
+		}
+	}
+	if *cookiesFromBrowser != "" {
+		cookieHeader, err = browsercookies.Load(*cookiesFromBrowser, "vsco.co")
+		if err != nil {
+			fatal(fmt.Errorf("Failed to load cookies from %s: %w", *cookiesFromBrowser, err))
+		}
+	}
+
+	if *forgetCredentials {
+		for _, name := range []string{credentials.Token, credentials.Cookies, credentials.Drive} {
+			if err := credentials.Delete(name); err != nil {
+				fatal(fmt.Errorf("Failed to remove saved %s from the keyring: %w", name, err))
+			}
+		}
+	}
+
+	if *saveCredentials {
+		for name, value := range map[string]string{credentials.Token: tokenValue, credentials.Cookies: cookieHeader} {
+			if value == "" {
+				continue
+			}
+			if err := credentials.Save(name, value); err != nil {
+				fatal(fmt.Errorf("Failed to save %s to the keyring: %w", name, err))
+			}
+		}
+	}
+
+	// Fall back to whatever was saved last time
+	if tokenValue == "" && !*forgetCredentials {
+		tokenValue = credentials.Load(credentials.Token)
+	}
+	if cookieHeader == "" && !*forgetCredentials {
+		cookieHeader = credentials.Load(credentials.Cookies)
+	}
+
+	if tokenValue != "" {
+		var tokens []string
+		for _, value := range strings.Split(tokenValue, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				tokens = append(tokens, value)
 			}
 		}
-	} else if *usernameList != "" {
-		err := vsco.GetMediaFromUserlist(*usernameList, *numWorkers, *getProfilePicture)
+		client.SetTokens(tokens)
+	}
+	if cookieHeader != "" {
+		client.SetCookies(cookieHeader)
+	}
+	if *httpCache {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			fatal(fmt.Errorf("Failed to find cache directory: %w", err))
+		}
+		if err := client.SetCacheDir(filepath.Join(cacheDir, "vsco-get", "http")); err != nil {
+			fatal(err)
+		}
+	}
+	vsco.SetClient(client)
+
+	dirPerm, err := parseMode(*dirMode)
+	if err != nil {
+		fatal(err)
+	}
+	filePerm, err := parseMode(*fileMode)
+	if err != nil {
+		fatal(err)
+	}
+
+	byteLimit, err := parseSize(*maxBytes)
+	if err != nil {
+		fatal(err)
+	}
+
+	fileSizeLimit, err := parseSize(*maxFileSize)
+	if err != nil {
+		fatal(err)
+	}
+
+	var sleepMin, sleepMax time.Duration
+	if *sleepInterval != "" {
+		sleepMin, sleepMax, err = vsco.ParseSleepInterval(*sleepInterval)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	var profilePictureSizes []int
+	for _, size := range strings.FieldsFunc(*avatarSizes, func(r rune) bool { return r == ',' || r == ' ' }) {
+		width, err := strconv.Atoi(size)
+		if err != nil || width <= 0 {
+			fatal(fmt.Errorf("Invalid -avatar-sizes width %q", size))
+		}
+		profilePictureSizes = append(profilePictureSizes, width)
+	}
+
+	var sinceDate time.Time
+	if *since != "" {
+		sinceDate, err = time.ParseInLocation(time.DateOnly, *since, time.Local)
+		if err != nil {
+			fatal(fmt.Errorf("Invalid -since %q, expected YYYY-MM-DD", *since))
+		}
+	}
+
+	if !vsco.ValidOrder(*order) {
+		fatal(fmt.Errorf("Invalid -order %q, expected newest, oldest or size-asc", *order))
+	}
+
+	if *fastUpdate && (*prune || *mirror || *force) {
+		fatal(fmt.Errorf("--fast-update can't be used with --prune, --mirror or --force"))
+	}
+
+	if *newerThanLocal && (*prune || *mirror) {
+		fatal(fmt.Errorf("--newer-than-local can't be used with --prune or --mirror"))
+	}
+
+	if *noDownload && (*prune || *mirror) {
+		fatal(fmt.Errorf("--no-download can't be used with --prune or --mirror"))
+	}
+
+	if *minWidth < 0 || *minHeight < 0 {
+		fatal(fmt.Errorf("Invalid -min-width or -min-height, expected a number of pixels"))
+	}
+
+	if *maxRequests < 0 {
+		fatal(fmt.Errorf("Invalid -max-requests %d, expected a number of requests or 0 for no limit", *maxRequests))
+	}
+
+	if *pageSize < vsco.MinPageSize || *pageSize > vsco.PageSize {
+		fatal(fmt.Errorf("Invalid -page-size %d, expected %d to %d", *pageSize, vsco.MinPageSize, vsco.PageSize))
+	}
+
+	if !vsco.ValidVideoQuality(*videoQuality) {
+		fatal(fmt.Errorf("Invalid -video-quality %q, expected best, worst or a height like 720", *videoQuality))
+	}
+
+	conflictPolicy := vsco.ConflictPolicy(*onConflict)
+	switch conflictPolicy {
+	case vsco.ConflictSkip, vsco.ConflictOverwrite, vsco.ConflictRename:
+	default:
+		fatal(fmt.Errorf("Invalid -on-conflict %q, expected skip, overwrite or rename", *onConflict))
+	}
+
+	options := vsco.Options{
+		NumWorkers:    *numWorkers,
+		NoMtime:       *noMtime,
+		WriteMetadata: *writeMetadata,
+		DirMode:       dirPerm,
+		FileMode:      filePerm,
+		OnConflict:    conflictPolicy,
+		Force:         *force,
+		DryRun:        *dryRun,
+		EstimateSize:  *estimateSize,
+		CheckSpace:    *checkSpace,
+		GetURLs:       *getURLs,
+		Prune:         *prune,
+		PruneToTrash:  *pruneToTrash,
+		Mirror:        *mirror,
+
+		ProfilePictureSizes:   profilePictureSizes,
+		ProfilePictureHistory: *avatarHistory,
+		SiteCacheTTL:          *siteCacheTTL,
+		ParallelUsers:         *parallelUsers,
+		MaxItems:              *maxItems,
+		Since:                 sinceDate,
+		Strict:                *strict,
+		SaveUnknown:           *saveUnknown,
+		VideoQuality:          *videoQuality,
+		ExtractAudio:          *extractAudio,
+		VideoPosters:          *videoPosters,
+		LinkStore:             *linkStore,
+		Thumbnails:            *thumbnails,
+		WriteFeed:             *writeFeed,
+		Order:                 *order,
+		PageSize:              *pageSize,
+		FastUpdate:            *fastUpdate,
+		NewerThanLocal:        *newerThanLocal,
+		SaveJSON:              *saveJSON,
+		NoDownload:            *noDownload,
+		WriteXMP:              *writeXMP,
+		WriteLocation:         *writeLocation,
+		CaptionFilenames:      *captionFilenames,
+		MinWidth:              *minWidth,
+		MinHeight:             *minHeight,
+		MaxFileSize:           fileSizeLimit,
+		SleepMin:              sleepMin,
+		SleepMax:              sleepMax,
+		OutputDir:             *outputDir,
+	}
+
+	if byteLimit > 0 {
+		options.Budget = vsco.NewByteBudget(byteLimit)
+	}
+
+	if *autoWorkers {
+		options.AutoWorkers = vsco.NewAutoScaler(*numWorkers)
+	}
+
+	options.Pause = vsco.NewPause(*pauseFile)
+	pauseOnSignal(options.Pause)
+
+	if *idList != "" {
+		options.IDs, err = vsco.ReadIDList(*idList)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	if *excludeIDList != "" {
+		options.ExcludeIDs, err = vsco.ReadIDList(*excludeIDList)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	if *includeTypes != "" {
+		options.IncludeTypes, err = vsco.ParseTypes(*includeTypes)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	// Nothing is kept on disk to compare against
+	if (*outputDir == "-" || *drive) && (*prune || *mirror || *newerThanLocal) {
+		fatal(fmt.Errorf("--prune, --mirror and --newer-than-local can't be used with --drive or --output -"))
+	}
+
+	endOffload := func() error { return nil }
+	switch {
+	case *outputDir == "-" && *drive:
+		fatal(fmt.Errorf("--output - and --drive can't be used together"))
+	case *outputDir == "-":
+		// Everything else that would be printed goes to stderr, so it doesn't end up in the stream
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		endOffload = offloadTo(&options, vsco.NewTarStream(stdout))
+	case *drive:
+		destination, err := connectDrive(*driveFolder, *driveClientID, *driveClientSecret)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
-	} else {
-		fmt.Printf("Usage: %s [flags] username\n", os.Args[0])
+		endOffload = offloadTo(&options, destination)
+	}
+
+	if len(args) > 0 {
+		if command, ok := commands[args[0]]; ok {
+			if len(args) < 2 {
+				fmt.Printf("Usage: %s [flags] %s %s\n", os.Args[0], args[0], command.usage)
+				os.Exit(exitUsage)
+			}
+
+			telemetry.Feature(args[0])
+
+			err := command.run(args[1:], options)
+			if offloadErr := endOffload(); err == nil {
+				err = offloadErr
+			}
+			if err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
+
+	if len(args) < 1 && *usernameList == "" {
+		fmt.Printf("Usage: %s [flags] username|post URL|media URLs...|-\n", os.Args[0])
 		flag.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+
+	if *watchSchedule != "" {
+		mediaSchedule, err := schedule.Parse(*watchSchedule)
+		if err != nil {
+			fatal(err)
+		}
+
+		var avatarSchedule *schedule.Schedule
+		if *avatarExpr != "" {
+			avatarSchedule, err = schedule.Parse(*avatarExpr)
+			if err != nil {
+				fatal(err)
+			}
+		}
+
+		watch(mediaSchedule, avatarSchedule, *getProfilePicture, func(profile bool) error {
+			// Every sync gets the full quota
+			if byteLimit > 0 {
+				options.Budget = vsco.NewByteBudget(byteLimit)
+			}
+			client.ResetRequestLimit()
+			options.Failures = vsco.NewFailureLog()
+			options.Stats = vsco.NewStatsLog()
+			err := scrape(args, *usernameList, options, profile)
+			writeFailures(options)
+			writeStats(options, *statsCSV)
+			if flushErr := options.Offload.Flush(); err == nil {
+				err = flushErr
+			}
+			return err
+		})
+	}
+
+	options.Failures = vsco.NewFailureLog()
+	options.Stats = vsco.NewStatsLog()
+	err = scrape(args, *usernameList, options, *getProfilePicture)
+	writeFailures(options)
+	writeStats(options, *statsCSV)
+	if offloadErr := endOffload(); err == nil {
+		err = offloadErr
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// writeStats adds how each user's sync went to the --stats-csv file, if there is one
+func writeStats(options vsco.Options, path string) {
+	if path == "" || options.DryRun || options.GetURLs {
+		return
+	}
+
+	if err := options.Stats.AppendCSV(path, options.FileMode); err != nil {
+		log.Print(err)
+	}
+}
+
+// writeFailures saves what failed in the run to errors.json in the working directory, for retrying or reporting
+func writeFailures(options vsco.Options) {
+	if options.DryRun || options.GetURLs {
 		return
 	}
+
+	err := options.Failures.Write("errors.json", options.FileMode)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	if options.Failures.Len() > 0 {
+		log.Printf("%d failures written to errors.json", options.Failures.Len())
+	}
+}
+
+// fatal is log.Fatal that doesn't lose the usage stats, and exits with a code that says what went wrong
+func fatal(err error) {
+	telemetry.Error(err)
+	saveUsageStats()
+	saveTrace()
+	closeSharedLimiter()
+	log.Print(err)
+	os.Exit(exitCode(err))
+}
+
+// The --rate-socket limiter, nil without one
+var sharedLimiter httpclient.SharedLimiter
+
+// closeSharedLimiter hands the shared rate limit over to the other processes, if we're serving it
+func closeSharedLimiter() {
+	if sharedLimiter != nil {
+		sharedLimiter.Close()
+	}
+}
+
+// The --trace recording, nil if not tracing
+var tracer *httpclient.Tracer
+
+func saveTrace() {
+	if err := tracer.Save(); err != nil {
+		log.Print(err)
+	}
+}
+
+func saveUsageStats() {
+	statsPath, err := telemetry.DefaultPath()
+	if err == nil {
+		err = telemetry.Save(statsPath)
+	}
+	if err != nil {
+		log.Printf("Failed to save usage stats: %s", err)
+	}
+}
+
+// parseMode reads an octal permission string like "0775", empty means the default
+func parseMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("Invalid permissions %q, expected octal like 0755", mode)
+	}
+
+	return os.FileMode(perm), nil
+}
+
+// parseSize reads sizes like "500MB", "2G" or "1048576", empty means no limit
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3},
+		{"T", 1e12}, {"G", 1e9}, {"M", 1e6}, {"K", 1e3}, {"B", 1},
+	}
+
+	number, multiplier := strings.ToUpper(strings.TrimSpace(size)), 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("Invalid size %q, expected something like 500MB or 2GB", size)
+	}
+
+	return int64(value * multiplier), nil
+}
+
+func scrape(args []string, usernameList string, options vsco.Options, getProfilePicture bool) error {
+	if len(args) < 1 {
+		return vsco.GetMediaFromUserlist(usernameList, options, getProfilePicture)
+	}
+
+	if args[0] == "-" || vsco.IsMediaURL(args[0]) {
+		urls, err := mediaURLs(args)
+		if err != nil {
+			return err
+		}
+		return vsco.SaveMediaURLs(urls, options)
+	}
+
+	if username, id, ok := vsco.ParseMediaURL(args[0]); ok {
+		err := vsco.NewScraper(username, options).SaveMediaByID(id)
+		options.Failures.AddUserError(username, err)
+		return err
+	}
+
+	err := scrapeUser(args[0], options, getProfilePicture)
+	options.Failures.AddUserError(args[0], err)
+	return err
+}
+
+// mediaURLs are the CDN URLs given as arguments, with "-" meaning the ones on stdin
+func mediaURLs(args []string) ([]string, error) {
+	var urls []string
+	for _, arg := range args {
+		if arg != "-" {
+			urls = append(urls, arg)
+			continue
+		}
+
+		stdinURLs, err := vsco.ReadMediaURLs(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, stdinURLs...)
+	}
+	return urls, nil
+}
+
+func scrapeUser(username string, options vsco.Options, getProfilePicture bool) error {
+	scraper := vsco.NewScraper(username, options)
+	err := scraper.GetUserInfo()
+	if err != nil {
+		return err
+	}
+
+	if getProfilePicture {
+		return scraper.SaveProfilePicture()
+	}
+
+	return scraper.SaveAllMedia()
+}
+
+// watch runs forever, syncing media on one schedule and profile pictures on another (if any). With
+// profileOnly (-p) there's only profile pictures to sync, on the first schedule.
+func watch(mediaSchedule *schedule.Schedule, avatarSchedule *schedule.Schedule, profileOnly bool, sync func(profile bool) error) {
+	if profileOnly {
+		avatarSchedule = nil
+	}
+
+	now := time.Now()
+	nextMedia := mediaSchedule.Next(now)
+
+	var nextAvatar time.Time
+	if avatarSchedule != nil {
+		nextAvatar = avatarSchedule.Next(now)
+	}
+
+	for {
+		avatarNext := avatarSchedule != nil && nextAvatar.Before(nextMedia)
+
+		next, kind := nextMedia, "media"
+		if avatarNext {
+			next = nextAvatar
+		}
+		profile := avatarNext || profileOnly
+		if profile {
+			kind = "profile picture"
+		}
+
+		log.Printf("Next %s sync at %s", kind, next.Format(time.DateTime))
+		time.Sleep(time.Until(next))
+
+		// A missed sync shouldn't stop the watch, the next one will pick it up
+		err := sync(profile)
+		if err != nil {
+			telemetry.Error(err)
+			log.Print(err)
+		}
+		saveUsageStats()
+		saveTrace()
+
+		if avatarNext {
+			nextAvatar = avatarSchedule.Next(time.Now())
+		} else {
+			nextMedia = mediaSchedule.Next(time.Now())
+		}
+	}
 }
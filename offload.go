@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/SilverMight/vsco-get/credentials"
+	"github.com/SilverMight/vsco-get/gdrive"
+	vsco "github.com/SilverMight/vsco-get/scraper"
+)
+
+// offloadTo sets options up to send the downloads to destination instead of keeping them. They're downloaded
+// into a temporary directory first. The returned function sends what's left and closes the destination.
+func offloadTo(options *vsco.Options, destination vsco.Destination) func() error {
+	tempDir, err := os.MkdirTemp("", "vsco-get-")
+	if err != nil {
+		fatal(fmt.Errorf("Failed to create temporary directory: %w", err))
+	}
+
+	options.OutputDir = tempDir
+	options.Offload = vsco.NewOffload(destination, tempDir)
+
+	return func() error {
+		defer os.RemoveAll(tempDir)
+		return options.Offload.Close()
+	}
+}
+
+// connectDrive signs in to Google Drive, with the refresh token in the keyring if there is one, or by
+// asking the user to enter a code on Google's site
+func connectDrive(folderID string, clientID string, clientSecret string) (*gdrive.Drive, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, errors.New("--drive needs --drive-client-id and --drive-client-secret")
+	}
+
+	refreshToken := credentials.Load(credentials.Drive)
+	if refreshToken == "" {
+		var err error
+		refreshToken, err = gdrive.Authorize(clientID, clientSecret, func(verificationURL string, userCode string) {
+			log.Printf("To let vsco-get upload to your Google Drive, go to %s and enter the code %s", verificationURL, userCode)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Without a keyring the next run just asks again
+		if err := credentials.Save(credentials.Drive, refreshToken); err != nil {
+			log.Printf("Failed to save the Google Drive sign in to the keyring: %s", err)
+		}
+	}
+
+	drive, err := gdrive.New(clientID, clientSecret, refreshToken, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w (if the sign in was revoked, run with --forget-credentials to sign in again)", err)
+	}
+	return drive, nil
+}
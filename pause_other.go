@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import (
+	vsco "github.com/SilverMight/vsco-get/scraper"
+)
+
+// pauseOnSignal does nothing where there's no SIGUSR1, "--pause-file" works everywhere
+func pauseOnSignal(pause *vsco.Pause) {}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	vsco "github.com/SilverMight/vsco-get/scraper"
+)
+
+// pauseOnSignal toggles pause on every SIGUSR1, e.g. `kill -USR1 <pid>`
+func pauseOnSignal(pause *vsco.Pause) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		for range signals {
+			if pause.Toggle() {
+				log.Print("Pausing after the downloads in progress, send SIGUSR1 again to resume")
+			} else {
+				log.Print("Resuming on SIGUSR1")
+			}
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package remux
+
+import "fmt"
+
+// Samples in an AAC frame
+const aacFrameSamples = 1024
+
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// adtsFrames splits the ADTS frames in an audio PES packet, taking the stream's format from the first header
+func (track *audioTrack) adtsFrames(data []byte) ([][]byte, error) {
+	var frames [][]byte
+
+	for len(data) > 0 {
+		if len(data) < 7 || data[0] != 0xff || data[1]&0xf0 != 0xf0 {
+			return nil, fmt.Errorf("Broken ADTS header")
+		}
+
+		headerLength := 7
+		// Without protection_absent there's a CRC after the header
+		if data[1]&0x01 == 0 {
+			headerLength = 9
+		}
+		frameLength := int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5])>>5
+		if frameLength < headerLength || frameLength > len(data) {
+			return nil, fmt.Errorf("Broken ADTS header")
+		}
+
+		if track.sampleRate == 0 {
+			rateIndex := int(data[2] >> 2 & 0x0f)
+			if rateIndex >= len(aacSampleRates) {
+				return nil, fmt.Errorf("Unsupported AAC sample rate index %d", rateIndex)
+			}
+			track.objectType = int(data[2]>>6) + 1
+			track.rateIndex = rateIndex
+			track.sampleRate = aacSampleRates[rateIndex]
+			track.channels = int(data[2]&0x01)<<2 | int(data[3]>>6)
+		}
+
+		frames = append(frames, data[headerLength:frameLength])
+		data = data[frameLength:]
+	}
+
+	return frames, nil
+}
+
+// audioSpecificConfig is what a decoder needs to know about the AAC stream, which ADTS repeats in every header
+func (track *audioTrack) audioSpecificConfig() []byte {
+	if track.config != nil {
+		return track.config
+	}
+	config := track.objectType<<11 | track.rateIndex<<7 | track.channels<<3
+	return []byte{byte(config >> 8), byte(config)}
+}
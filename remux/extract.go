@@ -0,0 +1,640 @@
+package remux
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoAudio is returned by ExtractAudio for a video without an audio track
+var ErrNoAudio = errors.New("The video has no audio track")
+
+// Flags of the tfhd and trun boxes, saying which fields they have
+const (
+	tfhdBaseOffset      = 0x000001
+	tfhdDescription     = 0x000002
+	tfhdDefaultDuration = 0x000008
+	tfhdDefaultSize     = 0x000010
+
+	trunDataOffset = 0x000001
+	trunFirstFlags = 0x000004
+	trunDuration   = 0x000100
+	trunSize       = 0x000200
+	trunFlags      = 0x000400
+	trunCTSOffset  = 0x000800
+)
+
+// mp4Box is a box read from an MP4 file, its payload following the header at start
+type mp4Box struct {
+	typ     string
+	start   int64
+	payload []byte
+}
+
+// sampleRef is where a sample of the audio track is in the source file
+type sampleRef struct {
+	offset   int64
+	size     uint32
+	duration uint32
+}
+
+// sourceAudio is the audio track of an MP4 file, as far as copying it goes
+type sourceAudio struct {
+	id        uint32
+	timescale uint32
+	channels  int
+	config    []byte
+	samples   []sampleRef
+	// Defaults of the track's samples in fragments, from its trex
+	defaultDuration, defaultSize uint32
+}
+
+// ExtractAudio copies the AAC audio track of the MP4 in src, plain or fragmented, into an audio-only fragmented
+// MP4 (an .m4a) written to dst. It returns ErrNoAudio if there's no audio to copy.
+func ExtractAudio(dst io.Writer, src io.ReadSeeker) error {
+	var moovBox *mp4Box
+	var moofs []mp4Box
+
+	err := readBoxes(src, func(typ string) bool {
+		return typ == "moov" || typ == "moof"
+	}, func(b mp4Box) {
+		if b.typ == "moov" {
+			moovBox = &b
+		} else {
+			moofs = append(moofs, b)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if moovBox == nil {
+		return fmt.Errorf("Not an MP4 file, it has no moov box")
+	}
+
+	audio, err := findAudio(moovBox.payload)
+	if err != nil {
+		return err
+	}
+	for _, moof := range moofs {
+		if err := audio.addFragment(moof); err != nil {
+			return err
+		}
+	}
+	if len(audio.samples) == 0 {
+		return ErrNoAudio
+	}
+
+	track := &audioTrack{sampleRate: int(audio.timescale), channels: audio.channels, config: audio.config}
+	if _, err := dst.Write(append(ftyp(), moov(nil, track)...)); err != nil {
+		return err
+	}
+
+	var decodeTime uint64
+	sequence := uint32(0)
+	for start := 0; start < len(audio.samples); start += audioOnlyFragment {
+		refs := audio.samples[start:min(start+audioOnlyFragment, len(audio.samples))]
+
+		run := trackRun{id: audioTrackID, decodeTime: decodeTime}
+		for _, ref := range refs {
+			data := make([]byte, ref.size)
+			if _, err := src.Seek(ref.offset, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(src, data); err != nil {
+				return fmt.Errorf("Audio sample past the end of the file: %w", err)
+			}
+
+			run.samples = append(run.samples, sample{data: data, duration: ref.duration, keyframe: true})
+			decodeTime += uint64(ref.duration)
+		}
+
+		sequence++
+		if _, err := dst.Write(fragment(sequence, []trackRun{run})); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBoxes goes through the top level boxes of src, reading the payload of those keep wants and handing
+// them to found. The others, like the mdat, are skipped over.
+func readBoxes(src io.ReadSeeker, keep func(typ string) bool, found func(b mp4Box)) error {
+	var start int64
+	for {
+		if _, err := src.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(src, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("Broken MP4 box header: %w", err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// Runs to the end of the file, which can only be the last box
+			end, err := src.Seek(0, io.SeekEnd)
+			if err != nil {
+				return err
+			}
+			size = end - start
+			src.Seek(start+8, io.SeekStart)
+		case 1:
+			large := make([]byte, 8)
+			if _, err := io.ReadFull(src, large); err != nil {
+				return fmt.Errorf("Broken MP4 box header: %w", err)
+			}
+			size = int64(binary.BigEndian.Uint64(large))
+			headerSize = 16
+		}
+		if size < headerSize {
+			return fmt.Errorf("Broken MP4 box %q", typ)
+		}
+
+		if keep(typ) {
+			payload := make([]byte, size-headerSize)
+			if _, err := io.ReadFull(src, payload); err != nil {
+				return fmt.Errorf("MP4 box %q past the end of the file: %w", typ, err)
+			}
+			found(mp4Box{typ: typ, start: start, payload: payload})
+		}
+
+		start += size
+	}
+}
+
+// children splits the payload of a box into the boxes in it
+func children(payload []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset := 0; offset < len(payload); {
+		if len(payload)-offset < 8 {
+			return nil, fmt.Errorf("Broken MP4 box header")
+		}
+		size := int(binary.BigEndian.Uint32(payload[offset:]))
+		typ := string(payload[offset+4 : offset+8])
+		if size < 8 || offset+size > len(payload) {
+			return nil, fmt.Errorf("Broken MP4 box %q", typ)
+		}
+
+		boxes = append(boxes, mp4Box{typ: typ, start: int64(offset), payload: payload[offset+8 : offset+size]})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// child finds the box at path under payload, like "mdia", "minf", "stbl". ok is false if there isn't one.
+func child(payload []byte, path ...string) (box []byte, ok bool) {
+	box = payload
+	for _, typ := range path {
+		boxes, err := children(box)
+		if err != nil {
+			return nil, false
+		}
+
+		found := false
+		for _, b := range boxes {
+			if b.typ == typ {
+				box, found = b.payload, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return box, true
+}
+
+// fullBoxBody skips the version and flags of a full box, failing if it's shorter than n bytes after them
+func fullBoxBody(payload []byte, n int) (version byte, flags uint32, body []byte, err error) {
+	if len(payload) < 4+n {
+		return 0, 0, nil, fmt.Errorf("MP4 box too short")
+	}
+	return payload[0], binary.BigEndian.Uint32(payload[0:4]) & 0xffffff, payload[4:], nil
+}
+
+// findAudio finds the first audio track described in moov, with its samples if they aren't in fragments
+func findAudio(moov []byte) (*sourceAudio, error) {
+	boxes, err := children(moov)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range boxes {
+		if b.typ != "trak" {
+			continue
+		}
+
+		hdlr, ok := child(b.payload, "mdia", "hdlr")
+		if !ok || len(hdlr) < 12 || string(hdlr[8:12]) != "soun" {
+			continue
+		}
+
+		audio := &sourceAudio{}
+		if err := audio.readTrack(b.payload); err != nil {
+			return nil, err
+		}
+
+		// The defaults for its samples in fragments
+		if trexes, ok := child(moov, "mvex"); ok {
+			extends, _ := children(trexes)
+			for _, trex := range extends {
+				_, _, body, err := fullBoxBody(trex.payload, 20)
+				if trex.typ == "trex" && err == nil && binary.BigEndian.Uint32(body) == audio.id {
+					audio.defaultDuration = binary.BigEndian.Uint32(body[8:])
+					audio.defaultSize = binary.BigEndian.Uint32(body[12:])
+				}
+			}
+		}
+		return audio, nil
+	}
+
+	return nil, ErrNoAudio
+}
+
+// readTrack reads what the trak box of the audio track says about it
+func (audio *sourceAudio) readTrack(trak []byte) error {
+	tkhd, ok := child(trak, "tkhd")
+	if !ok {
+		return fmt.Errorf("Audio track has no tkhd")
+	}
+	version, _, body, err := fullBoxBody(tkhd, 20)
+	if err != nil {
+		return err
+	}
+	if version == 1 {
+		audio.id = binary.BigEndian.Uint32(body[16:])
+	} else {
+		audio.id = binary.BigEndian.Uint32(body[8:])
+	}
+
+	mdhd, ok := child(trak, "mdia", "mdhd")
+	if !ok {
+		return fmt.Errorf("Audio track has no mdhd")
+	}
+	version, _, body, err = fullBoxBody(mdhd, 20)
+	if err != nil {
+		return err
+	}
+	if version == 1 {
+		audio.timescale = binary.BigEndian.Uint32(body[16:])
+	} else {
+		audio.timescale = binary.BigEndian.Uint32(body[8:])
+	}
+	if audio.timescale == 0 {
+		return fmt.Errorf("Audio track has no timescale")
+	}
+
+	stbl, ok := child(trak, "mdia", "minf", "stbl")
+	if !ok {
+		return fmt.Errorf("Audio track has no sample table")
+	}
+	if err := audio.readSampleEntry(stbl); err != nil {
+		return err
+	}
+	return audio.readSampleTable(stbl)
+}
+
+// readSampleEntry takes the AAC config out of the mp4a entry in stsd
+func (audio *sourceAudio) readSampleEntry(stbl []byte) error {
+	stsd, ok := child(stbl, "stsd")
+	if !ok {
+		return fmt.Errorf("Audio track has no stsd")
+	}
+	_, _, body, err := fullBoxBody(stsd, 4)
+	if err != nil {
+		return err
+	}
+
+	entries, err := children(body[4:])
+	if err != nil || len(entries) == 0 {
+		return fmt.Errorf("Audio track has no sample description")
+	}
+	entry := entries[0]
+	if entry.typ != "mp4a" {
+		return fmt.Errorf("Unsupported audio codec %q, only AAC can be extracted", entry.typ)
+	}
+	// Reserved, data reference, reserved, then the channel count
+	if len(entry.payload) < 28 {
+		return fmt.Errorf("Broken mp4a sample entry")
+	}
+	audio.channels = int(binary.BigEndian.Uint16(entry.payload[16:]))
+
+	// QuickTime's newer versions of the entry have more fields before the boxes in it
+	boxesAt := 28
+	switch binary.BigEndian.Uint16(entry.payload[8:]) {
+	case 1:
+		boxesAt += 16
+	case 2:
+		boxesAt += 36
+	}
+	if len(entry.payload) < boxesAt {
+		return fmt.Errorf("Broken mp4a sample entry")
+	}
+
+	esds, ok := child(entry.payload[boxesAt:], "esds")
+	if !ok || len(esds) < 4 {
+		return fmt.Errorf("AAC track has no esds")
+	}
+	audio.config = decoderConfig(esds[4:])
+	if audio.config == nil {
+		return fmt.Errorf("AAC track has no decoder config")
+	}
+	return nil
+}
+
+// decoderConfig finds the DecoderSpecificInfo (the AudioSpecificConfig of AAC) in the descriptors of an esds box
+func decoderConfig(data []byte) []byte {
+	for len(data) >= 2 {
+		tag := data[0]
+		// Lengths take up to 4 bytes, 7 bits each
+		length, n := 0, 1
+		for ; n <= 4 && n < len(data); n++ {
+			length = length<<7 | int(data[n]&0x7f)
+			if data[n]&0x80 == 0 {
+				break
+			}
+		}
+		body := data[min(n+1, len(data)):]
+		if length > len(body) {
+			return nil
+		}
+
+		switch tag {
+		case 0x05:
+			return body[:length]
+		case 0x03:
+			// ES_ID and flags, then maybe a depends-on ID, URL and OCR ID before the descriptors in it
+			if length < 3 {
+				return nil
+			}
+			flags, skip := body[2], 3
+			if flags&0x80 != 0 {
+				skip += 2
+			}
+			if flags&0x40 != 0 && skip < length {
+				skip += 1 + int(body[skip])
+			}
+			if flags&0x20 != 0 {
+				skip += 2
+			}
+			if skip > length {
+				return nil
+			}
+			return decoderConfig(body[skip:length])
+		case 0x04:
+			// Object type, stream type, buffer size and bitrates, then the DecoderSpecificInfo
+			if length < 13 {
+				return nil
+			}
+			return decoderConfig(body[13:length])
+		}
+		data = body[length:]
+	}
+	return nil
+}
+
+// readSampleTable lists the samples the sample table has, for files that aren't fragmented
+func (audio *sourceAudio) readSampleTable(stbl []byte) error {
+	var sizes []uint32
+	if stsz, ok := child(stbl, "stsz"); ok {
+		_, _, body, err := fullBoxBody(stsz, 8)
+		if err != nil {
+			return err
+		}
+		fixed, count := binary.BigEndian.Uint32(body), int(binary.BigEndian.Uint32(body[4:]))
+		if fixed == 0 && len(body) < 8+4*count {
+			return fmt.Errorf("Broken stsz box")
+		}
+		for i := 0; i < count; i++ {
+			if fixed != 0 {
+				sizes = append(sizes, fixed)
+			} else {
+				sizes = append(sizes, binary.BigEndian.Uint32(body[8+4*i:]))
+			}
+		}
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+
+	var chunks []int64
+	if stco, ok := child(stbl, "stco"); ok {
+		_, _, body, err := fullBoxBody(stco, 4)
+		if err != nil {
+			return err
+		}
+		count := int(binary.BigEndian.Uint32(body))
+		if len(body) < 4+4*count {
+			return fmt.Errorf("Broken stco box")
+		}
+		for i := 0; i < count; i++ {
+			chunks = append(chunks, int64(binary.BigEndian.Uint32(body[4+4*i:])))
+		}
+	} else if co64, ok := child(stbl, "co64"); ok {
+		_, _, body, err := fullBoxBody(co64, 4)
+		if err != nil {
+			return err
+		}
+		count := int(binary.BigEndian.Uint32(body))
+		if len(body) < 4+8*count {
+			return fmt.Errorf("Broken co64 box")
+		}
+		for i := 0; i < count; i++ {
+			chunks = append(chunks, int64(binary.BigEndian.Uint64(body[4+8*i:])))
+		}
+	}
+
+	// Runs of chunks with the same number of samples, by their first chunk (counted from 1)
+	type chunkRun struct{ first, samples uint32 }
+	var runs []chunkRun
+	if stsc, ok := child(stbl, "stsc"); ok {
+		_, _, body, err := fullBoxBody(stsc, 4)
+		if err != nil {
+			return err
+		}
+		count := int(binary.BigEndian.Uint32(body))
+		if len(body) < 4+12*count {
+			return fmt.Errorf("Broken stsc box")
+		}
+		for i := 0; i < count; i++ {
+			runs = append(runs, chunkRun{binary.BigEndian.Uint32(body[4+12*i:]), binary.BigEndian.Uint32(body[8+12*i:])})
+		}
+	}
+
+	var durations []uint32
+	if stts, ok := child(stbl, "stts"); ok {
+		_, _, body, err := fullBoxBody(stts, 4)
+		if err != nil {
+			return err
+		}
+		count := int(binary.BigEndian.Uint32(body))
+		if len(body) < 4+8*count {
+			return fmt.Errorf("Broken stts box")
+		}
+		for i := 0; i < count && len(durations) < len(sizes); i++ {
+			n, duration := binary.BigEndian.Uint32(body[4+8*i:]), binary.BigEndian.Uint32(body[8+8*i:])
+			for j := uint32(0); j < n && len(durations) < len(sizes); j++ {
+				durations = append(durations, duration)
+			}
+		}
+	}
+	if len(chunks) == 0 || len(runs) == 0 || len(durations) < len(sizes) {
+		return fmt.Errorf("Audio track has an incomplete sample table")
+	}
+
+	sampleIndex := 0
+	for chunk := range chunks {
+		perChunk := uint32(0)
+		for _, run := range runs {
+			if run.first > uint32(chunk+1) {
+				break
+			}
+			perChunk = run.samples
+		}
+
+		offset := chunks[chunk]
+		for i := uint32(0); i < perChunk && sampleIndex < len(sizes); i++ {
+			audio.samples = append(audio.samples, sampleRef{offset: offset, size: sizes[sampleIndex], duration: durations[sampleIndex]})
+			offset += int64(sizes[sampleIndex])
+			sampleIndex++
+		}
+	}
+	if sampleIndex < len(sizes) {
+		return fmt.Errorf("Audio track has an incomplete sample table")
+	}
+	return nil
+}
+
+// addFragment adds the samples of the audio track in the moof box b
+func (audio *sourceAudio) addFragment(b mp4Box) error {
+	trafs, err := children(b.payload)
+	if err != nil {
+		return err
+	}
+
+	for _, traf := range trafs {
+		if traf.typ != "traf" {
+			continue
+		}
+
+		tfhd, ok := child(traf.payload, "tfhd")
+		if !ok {
+			return fmt.Errorf("Fragment has no tfhd")
+		}
+		_, flags, body, err := fullBoxBody(tfhd, 4)
+		if err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint32(body) != audio.id {
+			continue
+		}
+
+		// The samples are counted from the start of the moof, unless the tfhd says otherwise
+		base := b.start
+		duration, size := audio.defaultDuration, audio.defaultSize
+		fields := body[4:]
+		field := func(n int) ([]byte, error) {
+			if len(fields) < n {
+				return nil, fmt.Errorf("Broken tfhd box")
+			}
+			value := fields[:n]
+			fields = fields[n:]
+			return value, nil
+		}
+		if flags&tfhdBaseOffset != 0 {
+			value, err := field(8)
+			if err != nil {
+				return err
+			}
+			base = int64(binary.BigEndian.Uint64(value))
+		}
+		if flags&tfhdDescription != 0 {
+			if _, err := field(4); err != nil {
+				return err
+			}
+		}
+		if flags&tfhdDefaultDuration != 0 {
+			value, err := field(4)
+			if err != nil {
+				return err
+			}
+			duration = binary.BigEndian.Uint32(value)
+		}
+		if flags&tfhdDefaultSize != 0 {
+			value, err := field(4)
+			if err != nil {
+				return err
+			}
+			size = binary.BigEndian.Uint32(value)
+		}
+
+		runs, _ := children(traf.payload)
+		for _, run := range runs {
+			if run.typ == "trun" {
+				if err := audio.addRun(run.payload, base, duration, size); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// addRun adds the samples of a trun box, base being where its data offset counts from
+func (audio *sourceAudio) addRun(trun []byte, base int64, defaultDuration uint32, defaultSize uint32) error {
+	_, flags, body, err := fullBoxBody(trun, 4)
+	if err != nil {
+		return err
+	}
+	count := int(binary.BigEndian.Uint32(body))
+	body = body[4:]
+
+	offset := base
+	if flags&trunDataOffset != 0 {
+		if len(body) < 4 {
+			return fmt.Errorf("Broken trun box")
+		}
+		offset += int64(int32(binary.BigEndian.Uint32(body)))
+		body = body[4:]
+	}
+	if flags&trunFirstFlags != 0 {
+		if len(body) < 4 {
+			return fmt.Errorf("Broken trun box")
+		}
+		body = body[4:]
+	}
+
+	for i := 0; i < count; i++ {
+		duration, size := defaultDuration, defaultSize
+		for _, f := range []uint32{trunDuration, trunSize, trunFlags, trunCTSOffset} {
+			if flags&f == 0 {
+				continue
+			}
+			if len(body) < 4 {
+				return fmt.Errorf("Broken trun box")
+			}
+			value := binary.BigEndian.Uint32(body)
+			body = body[4:]
+
+			switch f {
+			case trunDuration:
+				duration = value
+			case trunSize:
+				size = value
+			}
+		}
+
+		audio.samples = append(audio.samples, sampleRef{offset: offset, size: size, duration: duration})
+		offset += int64(size)
+	}
+	return nil
+}
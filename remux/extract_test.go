@@ -0,0 +1,242 @@
+package remux
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testAudio is a 44.1kHz stereo track with count frames of different sizes and contents
+func testAudio(count int) (*audioTrack, []sample) {
+	track := &audioTrack{objectType: 2, rateIndex: 4, sampleRate: 44100, channels: 2}
+
+	var samples []sample
+	for i := 0; i < count; i++ {
+		samples = append(samples, sample{data: bytes.Repeat([]byte{byte(i)}, 10+i%7), duration: aacFrameSamples, keyframe: true})
+	}
+	return track, samples
+}
+
+func testVideo() *videoTrack {
+	return &videoTrack{sps: testSPS(66, 640, 360), pps: []byte{0x68, 0xce}, width: 640, height: 360}
+}
+
+func videoRun(decodeTime uint64) trackRun {
+	return trackRun{id: videoTrackID, decodeTime: decodeTime, samples: []sample{{data: []byte("frame"), duration: 3000, keyframe: true}}}
+}
+
+// checkExtracted checks the m4a in data has exactly samples as its audio
+func checkExtracted(t *testing.T, data []byte, samples []sample) {
+	t.Helper()
+
+	got := trackSamples(t, data, audioTrackID)
+	if len(got) != len(samples) {
+		t.Fatalf("Got %d samples, want %d", len(got), len(samples))
+	}
+	for i, s := range samples {
+		if !bytes.Equal(got[i], s.data) {
+			t.Fatalf("Sample %d is %x, want %x", i, got[i], s.data)
+		}
+	}
+
+	moovBox, ok := child(data, "moov")
+	if !ok {
+		t.Fatal("No moov")
+	}
+	if _, ok := child(moovBox, "trak", "mdia", "minf", "vmhd"); ok {
+		t.Error("The m4a has a video track")
+	}
+}
+
+func TestExtractAudioFragmented(t *testing.T) {
+	track, samples := testAudio(300)
+	// HE-AAC, which ADTS can't describe, so the config has to come from the source as it is
+	track.config = []byte{0x2b, 0x92, 0x08, 0x00}
+
+	var src bytes.Buffer
+	src.Write(ftyp())
+	src.Write(moov(testVideo(), track))
+	src.Write(fragment(1, []trackRun{videoRun(0), {id: audioTrackID, samples: samples[:100]}}))
+	src.Write(fragment(2, []trackRun{videoRun(3000), {id: audioTrackID, decodeTime: 100 * aacFrameSamples, samples: samples[100:]}}))
+
+	var dst bytes.Buffer
+	if err := ExtractAudio(&dst, bytes.NewReader(src.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dst.Bytes(), samples)
+
+	moovBox, _ := child(dst.Bytes(), "moov")
+	audio, err := findAudio(moovBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audio.timescale != 44100 || audio.channels != 2 || !bytes.Equal(audio.config, track.config) {
+		t.Errorf("Got %d Hz, %d channels, config %x", audio.timescale, audio.channels, audio.config)
+	}
+
+	// Extracting from an m4a gives the same m4a
+	var again bytes.Buffer
+	if err := ExtractAudio(&again, bytes.NewReader(dst.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), dst.Bytes()) {
+		t.Error("Extracting the audio again changed it")
+	}
+}
+
+// progressiveMP4 is a plain MP4 with the samples in one mdat ahead of the moov, in chunks of the sizes given.
+// sampleEntry describes the audio and large uses co64 for the chunk offsets.
+func progressiveMP4(samples []sample, chunkSizes []int, sampleEntry []byte, large bool) []byte {
+	head := ftyp()
+
+	var mdat, sizes []byte
+	for _, s := range samples {
+		mdat = append(mdat, s.data...)
+		sizes = append(sizes, u32(uint32(len(s.data)))...)
+	}
+
+	var offsets []uint32
+	offset := uint32(len(head) + 8)
+	var stsc []uint32
+	index := 0
+	for chunk, size := range chunkSizes {
+		offsets = append(offsets, offset)
+		for _, s := range samples[index : index+size] {
+			offset += uint32(len(s.data))
+		}
+		index += size
+		if chunk == 0 || size != chunkSizes[chunk-1] {
+			stsc = append(stsc, uint32(chunk+1), uint32(size), 1)
+		}
+	}
+
+	var chunkOffsets []byte
+	if large {
+		body := u32(uint32(len(offsets)))
+		for _, offset := range offsets {
+			body = append(body, u32(0, offset)...)
+		}
+		chunkOffsets = fullBox("co64", 0, 0, body)
+	} else {
+		chunkOffsets = fullBox("stco", 0, 0, u32(uint32(len(offsets))), u32(offsets...))
+	}
+
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), sampleEntry),
+		fullBox("stts", 0, 0, u32(1, uint32(len(samples)), aacFrameSamples)),
+		fullBox("stsc", 0, 0, u32(uint32(len(stsc)/3)), u32(stsc...)),
+		fullBox("stsz", 0, 0, u32(0, uint32(len(samples))), sizes),
+		chunkOffsets,
+	)
+	mdhd := fullBox("mdhd", 0, 0, u32(0, 0, 44100, 0), u16(0x55c4, 0))
+	hdlr := fullBox("hdlr", 0, 0, u32(0), []byte("soun"), make([]byte, 12), []byte("sound\x00"))
+	tkhd := fullBox("tkhd", 0, 3, u32(0, 0, 7, 0, 0), make([]byte, 8), u16(0, 0, 0x100, 0), unityMatrix, u32(0, 0))
+	trak := box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", fullBox("smhd", 0, 0, u16(0, 0)), stbl)))
+
+	file := append(head, box("mdat", mdat)...)
+	return append(file, box("moov", trak)...)
+}
+
+// quickTimeEntry turns an mp4a entry into the version of it QuickTime writes, with more fields before the esds
+func quickTimeEntry(entry []byte, version uint16) []byte {
+	payload := append([]byte(nil), entry[8:]...)
+	copy(payload[8:], u16(version))
+
+	extra := 16
+	if version == 2 {
+		extra = 36
+	}
+	fields := append(append([]byte(nil), payload[:28]...), make([]byte, extra)...)
+	return box("mp4a", append(fields, payload[28:]...))
+}
+
+func TestExtractAudioProgressive(t *testing.T) {
+	track, samples := testAudio(300)
+	entry := audioSampleEntry(track)
+
+	tests := []struct {
+		name   string
+		chunks []int
+		entry  []byte
+		large  bool
+	}{
+		{"stco", []int{200, 100}, entry, false},
+		{"co64", []int{100, 100, 100}, entry, true},
+		{"uneven chunks", []int{1, 1, 98, 200}, entry, false},
+		{"QuickTime v1 entry", []int{300}, quickTimeEntry(entry, 1), false},
+		{"QuickTime v2 entry", []int{300}, quickTimeEntry(entry, 2), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := progressiveMP4(samples, test.chunks, test.entry, test.large)
+
+			var dst bytes.Buffer
+			if err := ExtractAudio(&dst, bytes.NewReader(src)); err != nil {
+				t.Fatal(err)
+			}
+			checkExtracted(t, dst.Bytes(), samples)
+		})
+	}
+}
+
+func TestExtractAudioDefaults(t *testing.T) {
+	track, _ := testAudio(0)
+	frames := []byte("aaaabbbbcccc")
+
+	// The sample size and duration come from the tfhd, the run only says how many there are
+	build := func(moofSize int) []byte {
+		tfhd := fullBox("tfhd", 0, 0x020000|tfhdDefaultDuration|tfhdDefaultSize, u32(audioTrackID, aacFrameSamples, 4))
+		trun := fullBox("trun", 0, trunDataOffset, u32(3, uint32(moofSize+8)))
+		return box("moof", fullBox("mfhd", 0, 0, u32(1)), box("traf", tfhd, trun))
+	}
+
+	var src bytes.Buffer
+	src.Write(ftyp())
+	src.Write(moov(nil, track))
+	src.Write(build(len(build(0))))
+	src.Write(box("mdat", frames))
+
+	var dst bytes.Buffer
+	if err := ExtractAudio(&dst, bytes.NewReader(src.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dst.Bytes(), []sample{{data: frames[0:4]}, {data: frames[4:8]}, {data: frames[8:12]}})
+}
+
+func TestExtractAudioSilent(t *testing.T) {
+	var src bytes.Buffer
+	src.Write(ftyp())
+	src.Write(moov(testVideo(), nil))
+	src.Write(fragment(1, []trackRun{videoRun(0)}))
+
+	err := ExtractAudio(&bytes.Buffer{}, bytes.NewReader(src.Bytes()))
+	if !errors.Is(err, ErrNoAudio) {
+		t.Errorf("Got %v, want ErrNoAudio", err)
+	}
+}
+
+func TestExtractAudioBroken(t *testing.T) {
+	track, samples := testAudio(10)
+
+	var fragmented bytes.Buffer
+	fragmented.Write(ftyp())
+	fragmented.Write(moov(nil, track))
+	fragmented.Write(fragment(1, []trackRun{{id: audioTrackID, samples: samples}}))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"HTML page", []byte("<!DOCTYPE html><html><body>Not found</body></html>")},
+		{"no moov", ftyp()},
+		{"cut off", fragmented.Bytes()[:fragmented.Len()-20]},
+		{"box past the end", append(ftyp(), u32(1000)...)},
+	}
+
+	for _, test := range tests {
+		if err := ExtractAudio(&bytes.Buffer{}, bytes.NewReader(test.data)); err == nil {
+			t.Errorf("%s: extracted audio", test.name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package remux
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// NAL unit types we care about
+const (
+	nalIDR = 5
+	nalSPS = 7
+	nalPPS = 8
+	nalAUD = 9
+)
+
+// splitNALs splits an Annex B byte stream (units separated by 00 00 01 start codes) into its NAL units
+func splitNALs(data []byte) [][]byte {
+	var nals [][]byte
+
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+
+		if start >= 0 {
+			nals = append(nals, trimZeros(data[start:i]))
+		}
+		start = i + 3
+		i += 2
+	}
+
+	if start >= 0 && start < len(data) {
+		nals = append(nals, data[start:])
+	}
+
+	return nals
+}
+
+// trimZeros drops the zero bytes a four byte start code leaves at the end of the unit before it
+func trimZeros(nal []byte) []byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	return nal
+}
+
+// accessUnit turns a video frame in Annex B form into an MP4 sample (units prefixed by their length),
+// keeping the parameter sets aside for the sample description
+func (track *videoTrack) accessUnit(data []byte) (sample []byte, keyframe bool, err error) {
+	for _, nal := range splitNALs(data) {
+		if len(nal) == 0 {
+			continue
+		}
+
+		switch nal[0] & 0x1f {
+		case nalSPS:
+			if track.sps == nil {
+				track.width, track.height, err = spsDimensions(nal)
+				if err != nil {
+					return nil, false, err
+				}
+				track.sps = append([]byte(nil), nal...)
+			}
+			continue
+		case nalPPS:
+			if track.pps == nil {
+				track.pps = append([]byte(nil), nal...)
+			}
+			continue
+		case nalAUD:
+			continue
+		case nalIDR:
+			keyframe = true
+		}
+
+		sample = binary.BigEndian.AppendUint32(sample, uint32(len(nal)))
+		sample = append(sample, nal...)
+	}
+
+	return sample, keyframe, nil
+}
+
+// bitReader reads the bit fields and Exp-Golomb codes of a parameter set
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) bit() uint {
+	if r.pos >= len(r.data)*8 {
+		r.err = fmt.Errorf("SPS is too short")
+		return 0
+	}
+	b := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint(b)
+}
+
+func (r *bitReader) bits(n int) uint {
+	var v uint
+	for i := 0; i < n; i++ {
+		v = v<<1 | r.bit()
+	}
+	return v
+}
+
+func (r *bitReader) ue() uint {
+	zeros := 0
+	for r.bit() == 0 && r.err == nil {
+		zeros++
+		if zeros > 31 {
+			r.err = fmt.Errorf("Broken Exp-Golomb code in SPS")
+			return 0
+		}
+	}
+	return 1<<zeros - 1 + r.bits(zeros)
+}
+
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v&1 == 1 {
+		return int(v+1) / 2
+	}
+	return -int(v / 2)
+}
+
+// unescape removes the emulation prevention bytes (the 03 in 00 00 03) from a NAL unit
+func unescape(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// spsDimensions reads the picture size out of a sequence parameter set
+func spsDimensions(sps []byte) (width int, height int, err error) {
+	if len(sps) < 4 {
+		return 0, 0, fmt.Errorf("SPS is too short")
+	}
+
+	r := &bitReader{data: unescape(sps[1:])}
+	profile := r.bits(8)
+	r.bits(16) // constraint flags, level
+	r.ue()     // seq_parameter_set_id
+
+	chromaFormat := uint(1)
+	separatePlanes := false
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = r.ue()
+		if chromaFormat == 3 {
+			separatePlanes = r.bit() == 1
+		}
+		r.ue()  // bit_depth_luma_minus8
+		r.ue()  // bit_depth_chroma_minus8
+		r.bit() // qpprime_y_zero_transform_bypass_flag
+
+		if r.bit() == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bit() == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for j := 0; j < size && r.err == nil; j++ {
+					if next != 0 {
+						next = (last + r.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bit() // delta_pic_order_always_zero_flag
+		r.se()  // offset_for_non_ref_pic
+		r.se()  // offset_for_top_to_bottom_field
+		cycle := r.ue()
+		for i := uint(0); i < cycle && r.err == nil; i++ {
+			r.se()
+		}
+	}
+
+	r.ue()  // max_num_ref_frames
+	r.bit() // gaps_in_frame_num_value_allowed_flag
+	widthMbs := int(r.ue()) + 1
+	heightUnits := int(r.ue()) + 1
+	frameMbsOnly := int(r.bit())
+	if frameMbsOnly == 0 {
+		r.bit() // mb_adaptive_frame_field_flag
+	}
+	r.bit() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.bit() == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+	}
+
+	if r.err != nil {
+		return 0, 0, r.err
+	}
+
+	cropX, cropY := 1, 2-frameMbsOnly
+	if chromaFormat != 0 && !separatePlanes {
+		if chromaFormat != 3 {
+			cropX = 2
+		}
+		if chromaFormat == 1 {
+			cropY *= 2
+		}
+	}
+
+	width = widthMbs*16 - cropX*(cropLeft+cropRight)
+	height = (2-frameMbsOnly)*heightUnits*16 - cropY*(cropTop+cropBottom)
+	return width, height, nil
+}
@@ -0,0 +1,219 @@
+package remux
+
+import "encoding/binary"
+
+// Track IDs in the MP4, whether or not the stream has both tracks
+const (
+	videoTrackID = 1
+	audioTrackID = 2
+)
+
+// Timescale of the video track, the same 90kHz the transport stream uses
+const videoTimescale = 90000
+
+// Sample flags for trun: a keyframe depends on nothing else, other frames aren't sync samples
+const (
+	flagsKeyframe = 0x02000000
+	flagsDelta    = 0x01010000
+)
+
+var unityMatrix = u32(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000)
+
+func u32(values ...uint32) []byte {
+	b := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func u16(values ...uint16) []byte {
+	b := make([]byte, 0, 2*len(values))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+
+	b := make([]byte, 0, size)
+	b = binary.BigEndian.AppendUint32(b, uint32(size))
+	b = append(b, typ...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, payload...)...)
+}
+
+// descriptor is an MPEG-4 descriptor as used in esds, all of ours are short enough for a one byte length
+func descriptor(tag byte, payload ...[]byte) []byte {
+	var body []byte
+	for _, p := range payload {
+		body = append(body, p...)
+	}
+	return append([]byte{tag, byte(len(body))}, body...)
+}
+
+func ftyp() []byte {
+	return box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso5iso6avc1mp41"))
+}
+
+// moov describes the tracks; the samples themselves all come in fragments after it
+func moov(video *videoTrack, audio *audioTrack) []byte {
+	mvhd := fullBox("mvhd", 0, 0,
+		u32(0, 0, 1000, 0),
+		u32(0x00010000), u16(0x0100), make([]byte, 10),
+		unityMatrix, make([]byte, 24),
+		u32(audioTrackID+1),
+	)
+
+	var traks, trexs [][]byte
+	if video != nil {
+		traks = append(traks, trak(videoTrackID, video.width, video.height, videoTimescale, "vide", videoSampleEntry(video)))
+		trexs = append(trexs, trex(videoTrackID))
+	}
+	if audio != nil {
+		traks = append(traks, trak(audioTrackID, 0, 0, audio.sampleRate, "soun", audioSampleEntry(audio)))
+		trexs = append(trexs, trex(audioTrackID))
+	}
+
+	return box("moov", append(append([][]byte{mvhd}, traks...), box("mvex", trexs...))...)
+}
+
+func trak(id uint32, width int, height int, timescale int, handler string, sampleEntry []byte) []byte {
+	var volume uint16
+	var header []byte
+	if handler == "soun" {
+		volume = 0x0100
+		header = fullBox("smhd", 0, 0, u16(0, 0))
+	} else {
+		header = fullBox("vmhd", 0, 1, u16(0, 0, 0, 0))
+	}
+
+	tkhd := fullBox("tkhd", 0, 0x000003,
+		u32(0, 0, id, 0, 0), make([]byte, 8),
+		u16(0, 0, volume, 0),
+		unityMatrix,
+		u32(uint32(width)<<16, uint32(height)<<16),
+	)
+
+	// 'und' language, packed as three 5 bit letters
+	mdhd := fullBox("mdhd", 0, 0, u32(0, 0, uint32(timescale), 0), u16(0x55c4, 0))
+	hdlr := fullBox("hdlr", 0, 0, u32(0), []byte(handler), make([]byte, 12), []byte("vsco-get\x00"))
+	dinf := box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1)))
+
+	// No samples in here, they're all in the fragments
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), sampleEntry),
+		fullBox("stts", 0, 0, u32(0)),
+		fullBox("stsc", 0, 0, u32(0)),
+		fullBox("stsz", 0, 0, u32(0, 0)),
+		fullBox("stco", 0, 0, u32(0)),
+	)
+
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", header, dinf, stbl)))
+}
+
+func trex(id uint32) []byte {
+	return fullBox("trex", 0, 0, u32(id, 1, 0, 0, 0))
+}
+
+func videoSampleEntry(video *videoTrack) []byte {
+	avcC := box("avcC",
+		[]byte{1, video.sps[1], video.sps[2], video.sps[3], 0xff, 0xe1},
+		u16(uint16(len(video.sps))), video.sps,
+		[]byte{1},
+		u16(uint16(len(video.pps))), video.pps,
+	)
+
+	return box("avc1",
+		make([]byte, 6), u16(1),
+		make([]byte, 16),
+		u16(uint16(video.width), uint16(video.height)),
+		u32(0x00480000, 0x00480000, 0),
+		u16(1), make([]byte, 32),
+		u16(0x0018, 0xffff),
+		avcC,
+	)
+}
+
+func audioSampleEntry(audio *audioTrack) []byte {
+	esds := fullBox("esds", 0, 0,
+		descriptor(0x03, u16(audioTrackID), []byte{0},
+			// MPEG-4 audio, audio stream
+			descriptor(0x04, []byte{0x40, 0x15, 0, 0, 0}, u32(0, 0),
+				descriptor(0x05, audio.audioSpecificConfig()),
+			),
+			descriptor(0x06, []byte{0x02}),
+		),
+	)
+
+	return box("mp4a",
+		make([]byte, 6), u16(1),
+		make([]byte, 8),
+		u16(uint16(audio.channels), 16, 0, 0),
+		u32(uint32(audio.sampleRate)<<16),
+		esds,
+	)
+}
+
+// trackRun is the samples of one track in a fragment
+type trackRun struct {
+	id         uint32
+	decodeTime uint64
+	samples    []sample
+}
+
+// fragment is a moof describing runs followed by the mdat holding their samples
+func fragment(sequence uint32, runs []trackRun) []byte {
+	build := func(moofSize int) []byte {
+		trafs := [][]byte{fullBox("mfhd", 0, 0, u32(sequence))}
+
+		offset := moofSize + 8
+		for _, run := range runs {
+			entries := make([]byte, 0, 16*len(run.samples))
+			for _, s := range run.samples {
+				flags := uint32(flagsDelta)
+				if s.keyframe {
+					flags = flagsKeyframe
+				}
+				entries = append(entries, u32(s.duration, uint32(len(s.data)), flags, s.ctsOffset)...)
+			}
+
+			// default-base-is-moof, and data offset, duration, size, flags and composition offset per sample
+			trafs = append(trafs, box("traf",
+				fullBox("tfhd", 0, 0x020000, u32(run.id)),
+				fullBox("tfdt", 1, 0, u32(uint32(run.decodeTime>>32), uint32(run.decodeTime))),
+				fullBox("trun", 0, 0x000f01, u32(uint32(len(run.samples)), uint32(offset)), entries),
+			))
+
+			for _, s := range run.samples {
+				offset += len(s.data)
+			}
+		}
+
+		return box("moof", trafs...)
+	}
+
+	// The data offsets depend on the size of the moof, which doesn't depend on their values
+	moof := build(len(build(0)))
+
+	var data [][]byte
+	for _, run := range runs {
+		for _, s := range run.samples {
+			data = append(data, s.data)
+		}
+	}
+
+	return append(moof, box("mdat", data...)...)
+}
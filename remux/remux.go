@@ -0,0 +1,249 @@
+// Package remux turns the MPEG-TS streams HLS serves into fragmented MP4 files, and copies the audio out of
+// MP4 videos, without re-encoding and without needing ffmpeg. It only handles what VSCO uses: one H.264 video
+// and one AAC audio stream.
+package remux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// How many audio frames to put in a fragment when there's no video to split fragments at keyframes
+const audioOnlyFragment = 128
+
+// Duration of a video frame when there's no next frame to tell, at 30fps
+const defaultFrameDuration = videoTimescale / 30
+
+type sample struct {
+	data      []byte
+	duration  uint32
+	ctsOffset uint32
+	keyframe  bool
+	// Decode timestamp of video samples, for working out their durations
+	dts uint64
+}
+
+type videoTrack struct {
+	sps, pps      []byte
+	width, height int
+	samples       []sample
+}
+
+type audioTrack struct {
+	objectType, rateIndex, sampleRate, channels int
+	// The AudioSpecificConfig as the source had it, when it isn't made from the ADTS headers
+	config []byte
+	// Timestamp of the first frame, which the audio track starts at
+	firstPTS uint64
+	samples  []sample
+}
+
+// muxer collects samples and writes them out a fragment at a time
+type muxer struct {
+	w     io.Writer
+	video *videoTrack
+	audio *audioTrack
+
+	headerWritten bool
+	sequence      uint32
+	// Timestamp everything is relative to, so the file starts at zero
+	start uint64
+	// Where the next fragment of each track starts, in its own timescale
+	videoTime, audioTime uint64
+	lastDuration         uint32
+}
+
+// Remux copies the audio and video of the transport stream in src into a fragmented MP4 written to dst
+func Remux(dst io.Writer, src io.Reader) error {
+	d := newDemuxer(src)
+	m := &muxer{w: dst}
+
+	for {
+		packet, err := d.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// The PMT comes before any audio or video, so by now we know which tracks there are
+		if d.videoPID != 0 && m.video == nil {
+			m.video = &videoTrack{}
+		}
+		if d.audioPID != 0 && m.audio == nil {
+			m.audio = &audioTrack{}
+		}
+
+		switch packet.pid {
+		case d.videoPID:
+			err = m.addVideo(packet)
+		case d.audioPID:
+			err = m.addAudio(packet)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.video == nil && m.audio == nil {
+		if len(d.unsupported) > 0 {
+			return fmt.Errorf("Unsupported stream types %x, only H.264 video and AAC audio can be remuxed", d.unsupported)
+		}
+		return fmt.Errorf("No audio or video found in the stream")
+	}
+
+	return m.flush(0, true)
+}
+
+func (m *muxer) addVideo(packet pes) error {
+	data, keyframe, err := m.video.accessUnit(packet.data)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	// Frames before the first keyframe can't be decoded
+	if len(m.video.samples) == 0 && !m.headerWritten && !keyframe {
+		return nil
+	}
+
+	// Fragments start at keyframes, once we know enough about the audio to describe it
+	audioReady := m.audio == nil || m.audio.sampleRate != 0
+	if keyframe && len(m.video.samples) > 0 && audioReady {
+		if err := m.flush(packet.dts, false); err != nil {
+			return err
+		}
+	}
+
+	m.video.samples = append(m.video.samples, sample{
+		data:      data,
+		ctsOffset: uint32(packet.pts - packet.dts),
+		keyframe:  keyframe,
+		dts:       packet.dts,
+	})
+	return nil
+}
+
+func (m *muxer) addAudio(packet pes) error {
+	frames, err := m.audio.adtsFrames(packet.data)
+	if err != nil {
+		return err
+	}
+
+	if len(m.audio.samples) == 0 && !m.headerWritten && len(frames) > 0 {
+		m.audio.firstPTS = packet.pts
+	}
+
+	for _, frame := range frames {
+		m.audio.samples = append(m.audio.samples, sample{
+			data:     frame,
+			duration: aacFrameSamples,
+			keyframe: true,
+		})
+	}
+
+	if m.video == nil && len(m.audio.samples) >= audioOnlyFragment {
+		return m.flush(0, false)
+	}
+	return nil
+}
+
+// flush writes the samples collected so far as a fragment. nextDTS is the timestamp of the frame after the last
+// video sample, which gives its duration; at the end of the stream there is none and last is set.
+func (m *muxer) flush(nextDTS uint64, last bool) error {
+	video, audio := m.video, m.audio
+	if video != nil && video.sps == nil {
+		if len(video.samples) > 0 {
+			return fmt.Errorf("Video stream has no SPS")
+		}
+		video = nil
+	}
+	if audio != nil && audio.sampleRate == 0 {
+		audio = nil
+	}
+
+	if !m.headerWritten {
+		if video == nil && audio == nil {
+			return fmt.Errorf("No audio or video found in the stream")
+		}
+		if video != nil && video.pps == nil {
+			return fmt.Errorf("Video stream has no PPS")
+		}
+
+		m.start = m.firstTimestamp(video, audio)
+		if audio != nil {
+			m.audioTime = uint64(max(int64(audio.firstPTS)-int64(m.start), 0)) * uint64(audio.sampleRate) / videoTimescale
+		}
+		if video != nil && len(video.samples) > 0 {
+			m.videoTime = uint64(max(int64(video.samples[0].dts)-int64(m.start), 0))
+		}
+
+		if _, err := m.w.Write(append(ftyp(), moov(video, audio)...)); err != nil {
+			return err
+		}
+		m.headerWritten = true
+	}
+
+	var runs []trackRun
+	if video != nil && len(video.samples) > 0 {
+		m.setDurations(nextDTS, last)
+		runs = append(runs, trackRun{id: videoTrackID, decodeTime: m.videoTime, samples: video.samples})
+		for _, s := range video.samples {
+			m.videoTime += uint64(s.duration)
+		}
+		video.samples = nil
+	}
+	if audio != nil && len(audio.samples) > 0 {
+		runs = append(runs, trackRun{id: audioTrackID, decodeTime: m.audioTime, samples: audio.samples})
+		m.audioTime += uint64(len(audio.samples)) * aacFrameSamples
+		audio.samples = nil
+	}
+
+	if len(runs) == 0 {
+		return nil
+	}
+
+	m.sequence++
+	_, err := m.w.Write(fragment(m.sequence, runs))
+	return err
+}
+
+// firstTimestamp is the earliest timestamp of the first fragment, which becomes time zero
+func (m *muxer) firstTimestamp(video *videoTrack, audio *audioTrack) uint64 {
+	var first []uint64
+	if video != nil && len(video.samples) > 0 {
+		first = append(first, video.samples[0].dts)
+	}
+	if audio != nil && len(audio.samples) > 0 {
+		first = append(first, audio.firstPTS)
+	}
+	if len(first) == 0 {
+		return 0
+	}
+	return min(first[0], first[len(first)-1])
+}
+
+// setDurations works out how long each video sample lasts from the timestamp of the one after it
+func (m *muxer) setDurations(nextDTS uint64, last bool) {
+	samples := m.video.samples
+	for i := range samples {
+		var duration uint32
+		switch {
+		case i+1 < len(samples) && samples[i+1].dts > samples[i].dts:
+			duration = uint32(samples[i+1].dts - samples[i].dts)
+		case i+1 == len(samples) && !last && nextDTS > samples[i].dts:
+			duration = uint32(nextDTS - samples[i].dts)
+		case m.lastDuration != 0:
+			duration = m.lastDuration
+		default:
+			duration = defaultFrameDuration
+		}
+
+		samples[i].duration = duration
+		m.lastDuration = duration
+	}
+}
@@ -0,0 +1,431 @@
+package remux
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// bitWriter writes the bit fields and Exp-Golomb codes of a parameter set, the other way round from bitReader
+type bitWriter struct {
+	data  []byte
+	nbits int
+}
+
+func (w *bitWriter) bit(b uint) {
+	if w.nbits%8 == 0 {
+		w.data = append(w.data, 0)
+	}
+	w.data[len(w.data)-1] |= byte(b&1) << (7 - w.nbits%8)
+	w.nbits++
+}
+
+func (w *bitWriter) bits(n int, v uint) {
+	for i := n - 1; i >= 0; i-- {
+		w.bit(v >> i)
+	}
+}
+
+func (w *bitWriter) ue(v uint) {
+	length := 0
+	for (v+1)>>length > 1 {
+		length++
+	}
+	w.bits(length, 0)
+	w.bits(length+1, v+1)
+}
+
+// escape adds the emulation prevention bytes unescape takes out
+func escape(rbsp []byte) []byte {
+	var out []byte
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// testSPS is a sequence parameter set for a progressive 4:2:0 picture of width by height, in macroblocks
+// cropped down to size
+func testSPS(profile uint, width int, height int) []byte {
+	w := &bitWriter{}
+	w.bits(8, profile)
+	w.bits(16, 40) // constraint flags, level 4.0
+	w.ue(0)        // seq_parameter_set_id
+	if profile == 100 {
+		w.ue(1)  // chroma_format_idc
+		w.ue(0)  // bit_depth_luma_minus8
+		w.ue(0)  // bit_depth_chroma_minus8
+		w.bit(0) // qpprime_y_zero_transform_bypass_flag
+		w.bit(0) // seq_scaling_matrix_present_flag
+	}
+	w.ue(0) // log2_max_frame_num_minus4
+	w.ue(0) // pic_order_cnt_type
+	w.ue(0) // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(1) // max_num_ref_frames
+	w.bit(0)
+
+	widthMbs, heightMbs := (width+15)/16, (height+15)/16
+	w.ue(uint(widthMbs - 1))
+	w.ue(uint(heightMbs - 1))
+	w.bit(1) // frame_mbs_only_flag
+	w.bit(1) // direct_8x8_inference_flag
+
+	// Cropping counts in pairs of pixels for 4:2:0
+	cropRight, cropBottom := (widthMbs*16-width)/2, (heightMbs*16-height)/2
+	if cropRight == 0 && cropBottom == 0 {
+		w.bit(0)
+	} else {
+		w.bit(1)
+		w.ue(0)
+		w.ue(uint(cropRight))
+		w.ue(0)
+		w.ue(uint(cropBottom))
+	}
+	w.bit(0) // vui_parameters_present_flag
+	w.bit(1) // rbsp_stop_one_bit
+
+	return append([]byte{0x67}, escape(w.data)...)
+}
+
+func TestSPSDimensions(t *testing.T) {
+	tests := []struct {
+		profile       uint
+		width, height int
+	}{
+		{66, 640, 360},
+		{77, 1280, 720},
+		{100, 1920, 1080},
+		{100, 720, 1280},
+	}
+
+	for _, test := range tests {
+		name := fmt.Sprintf("profile %d %dx%d", test.profile, test.width, test.height)
+		width, height, err := spsDimensions(testSPS(test.profile, test.width, test.height))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if width != test.width || height != test.height {
+			t.Errorf("%s: got %dx%d", name, width, height)
+		}
+	}
+
+	if _, _, err := spsDimensions([]byte{0x67, 66, 0, 40}); err == nil {
+		t.Error("A truncated SPS parsed")
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	raw := []byte{0x65, 0, 0, 0, 0, 0, 1, 0, 0, 2, 0, 0, 3, 0xff}
+	escaped := escape(raw)
+	if bytes.Equal(escaped, raw) {
+		t.Fatal("Nothing needed escaping")
+	}
+	if got := unescape(escaped); !bytes.Equal(got, raw) {
+		t.Errorf("Got %x, want %x", got, raw)
+	}
+}
+
+func TestSplitNALs(t *testing.T) {
+	stream := []byte{0, 0, 0, 1, 9, 0xf0, 0, 0, 1, 0x67, 1, 2, 0, 0, 0, 1, 0x65, 3, 0}
+	nals := splitNALs(stream)
+
+	want := [][]byte{{9, 0xf0}, {0x67, 1, 2}, {0x65, 3, 0}}
+	if len(nals) != len(want) {
+		t.Fatalf("Got %d NAL units, want %d", len(nals), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(nals[i], want[i]) {
+			t.Errorf("NAL %d is %x, want %x", i, nals[i], want[i])
+		}
+	}
+}
+
+// tsWriter writes a transport stream with one H.264 and one AAC stream, the way HLS segments have them
+type tsWriter struct {
+	buf        bytes.Buffer
+	continuity map[uint16]byte
+}
+
+const (
+	testPMTPID   = 0x100
+	testVideoPID = 0x101
+	testAudioPID = 0x102
+)
+
+func newTSWriter(streamTypes ...byte) *tsWriter {
+	w := &tsWriter{continuity: make(map[uint16]byte)}
+
+	pat := []byte{0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe0 | testPMTPID>>8, testPMTPID & 0xff, 0, 0, 0, 0}
+	w.section(0, pat)
+
+	pmt := []byte{0x02, 0xb0, byte(9 + 5*len(streamTypes) + 4), 0, 1, 0xc1, 0, 0, 0xe1, 0x01, 0xf0, 0}
+	for i, streamType := range streamTypes {
+		pid := testVideoPID + i
+		pmt = append(pmt, streamType, 0xe0|byte(pid>>8), byte(pid), 0xf0, 0)
+	}
+	w.section(testPMTPID, append(pmt, 0, 0, 0, 0))
+
+	return w
+}
+
+// section writes a PSI table in one packet, the CRC left as zeros since nothing checks it
+func (w *tsWriter) section(pid uint16, table []byte) {
+	payload := append([]byte{0}, table...)
+	w.packet(pid, true, append(payload, bytes.Repeat([]byte{0xff}, 184-len(payload))...))
+}
+
+// packet writes one packet, filling up a short payload with adaptation field stuffing
+func (w *tsWriter) packet(pid uint16, start bool, payload []byte) {
+	header := []byte{0x47, byte(pid >> 8), byte(pid), 0x10 | w.continuity[pid]&0x0f}
+	if start {
+		header[1] |= 0x40
+	}
+	w.continuity[pid]++
+
+	if len(payload) < 184 {
+		header[3] |= 0x20
+		stuffing := 183 - len(payload)
+		header = append(header, byte(stuffing))
+		if stuffing > 0 {
+			header = append(header, 0)
+			header = append(header, bytes.Repeat([]byte{0xff}, stuffing-1)...)
+		}
+	}
+
+	w.buf.Write(header)
+	w.buf.Write(payload)
+}
+
+// pes writes data as a PES packet split over as many packets as it takes
+func (w *tsWriter) pes(pid uint16, streamID byte, pts uint64, dts uint64, data []byte) {
+	header := []byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5}
+	header = append(header, encodeTimestamp(2, pts)...)
+	if dts != pts {
+		header[7], header[8] = 0xc0, 10
+		header[9] |= 0x30
+		header = append(header, encodeTimestamp(1, dts)...)
+	}
+
+	payload := append(header, data...)
+	for start := true; len(payload) > 0; start = false {
+		n := min(len(payload), 184)
+		w.packet(pid, start, payload[:n])
+		payload = payload[n:]
+	}
+}
+
+func encodeTimestamp(prefix byte, ts uint64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29&0x0e) | 1,
+		byte(ts >> 22),
+		byte(ts>>14&0xfe) | 1,
+		byte(ts >> 7),
+		byte(ts<<1&0xfe) | 1,
+	}
+}
+
+// adts puts an AAC frame behind an ADTS header, for 44.1kHz stereo AAC-LC
+func adts(frame []byte) []byte {
+	length := len(frame) + 7
+	header := []byte{
+		0xff, 0xf1,
+		1<<6 | 4<<2,
+		2<<6 | byte(length>>11),
+		byte(length >> 3),
+		byte(length&7)<<5 | 0x1f,
+		0xfc,
+	}
+	return append(header, frame...)
+}
+
+// trackSamples reads the samples of track id out of the fragments of a fragmented MP4
+func trackSamples(t *testing.T, data []byte, id uint32) [][]byte {
+	t.Helper()
+
+	track := &sourceAudio{id: id}
+	err := readBoxes(bytes.NewReader(data), func(typ string) bool { return typ == "moof" }, func(b mp4Box) {
+		if err := track.addFragment(b); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var samples [][]byte
+	for _, ref := range track.samples {
+		if ref.offset+int64(ref.size) > int64(len(data)) {
+			t.Fatalf("Sample of track %d past the end of the file", id)
+		}
+		samples = append(samples, data[ref.offset:ref.offset+int64(ref.size)])
+	}
+	return samples
+}
+
+// topBoxes lists the types of the top level boxes in an MP4
+func topBoxes(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	var types []string
+	boxes, err := children(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range boxes {
+		types = append(types, b.typ)
+	}
+	return types
+}
+
+func TestRemux(t *testing.T) {
+	w := newTSWriter(streamTypeH264, streamTypeAAC)
+	sps, pps := testSPS(100, 1920, 1080), []byte{0x68, 0xce, 0x3c, 0x80}
+
+	var videoFrames, audioFrames [][]byte
+	start := uint64(900000)
+	for i := 0; i < 10; i++ {
+		dts := start + uint64(i)*3000
+		var frame []byte
+		if i%5 == 0 {
+			frame = append([]byte{0x65}, bytes.Repeat([]byte{byte(i)}, 300)...)
+		} else {
+			frame = append([]byte{0x41}, bytes.Repeat([]byte{byte(i)}, 40+i)...)
+		}
+		videoFrames = append(videoFrames, frame)
+
+		unit := []byte{0, 0, 0, 1, 0x09, 0xf0}
+		if i == 0 {
+			unit = append(unit, 0, 0, 0, 1)
+			unit = append(unit, sps...)
+			unit = append(unit, 0, 0, 1)
+			unit = append(unit, pps...)
+		}
+		unit = append(unit, 0, 0, 1)
+		unit = append(unit, frame...)
+		// Presented a frame later than decoded, like with B-frames
+		w.pes(testVideoPID, 0xe0, dts+3000, dts, unit)
+
+		var packet []byte
+		for j := 0; j < 2; j++ {
+			frame := bytes.Repeat([]byte{byte(0x80 + 2*i + j)}, 20+j)
+			audioFrames = append(audioFrames, frame)
+			packet = append(packet, adts(frame)...)
+		}
+		w.pes(testAudioPID, 0xc0, start+uint64(2*i)*1024*90000/44100, start+uint64(2*i)*1024*90000/44100, packet)
+	}
+
+	var out bytes.Buffer
+	if err := Remux(&out, &w.buf); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+
+	// A fragment for each keyframe
+	if got, want := strings.Join(topBoxes(t, data), " "), "ftyp moov moof mdat moof mdat"; got != want {
+		t.Errorf("Got boxes %q, want %q", got, want)
+	}
+
+	moovBox, ok := child(data, "moov")
+	if !ok {
+		t.Fatal("No moov")
+	}
+	avc1, ok := child(moovBox, "trak", "mdia", "minf", "stbl")
+	if !ok {
+		t.Fatal("No video sample table")
+	}
+	if !bytes.Contains(avc1, sps) || !bytes.Contains(avc1, pps) {
+		t.Error("The parameter sets aren't in the avcC")
+	}
+	if !bytes.Contains(avc1, u16(1920, 1080)) {
+		t.Error("The sample entry doesn't say 1920x1080")
+	}
+
+	video := trackSamples(t, data, videoTrackID)
+	if len(video) != len(videoFrames) {
+		t.Fatalf("Got %d video samples, want %d", len(video), len(videoFrames))
+	}
+	for i, frame := range videoFrames {
+		want := append(u32(uint32(len(frame))), frame...)
+		if !bytes.Equal(video[i], want) {
+			t.Errorf("Video sample %d is %x, want %x", i, video[i], want)
+		}
+	}
+
+	audio := trackSamples(t, data, audioTrackID)
+	if len(audio) != len(audioFrames) {
+		t.Fatalf("Got %d audio samples, want %d", len(audio), len(audioFrames))
+	}
+	for i, frame := range audioFrames {
+		if !bytes.Equal(audio[i], frame) {
+			t.Errorf("Audio sample %d is %x, want %x", i, audio[i], frame)
+		}
+	}
+
+	// What Remux makes, ExtractAudio can take the sound out of
+	var m4a bytes.Buffer
+	if err := ExtractAudio(&m4a, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	extracted := trackSamples(t, m4a.Bytes(), audioTrackID)
+	if len(extracted) != len(audioFrames) {
+		t.Fatalf("Extracted %d audio samples, want %d", len(extracted), len(audioFrames))
+	}
+	for i, frame := range audioFrames {
+		if !bytes.Equal(extracted[i], frame) {
+			t.Errorf("Extracted audio sample %d is %x, want %x", i, extracted[i], frame)
+		}
+	}
+}
+
+func TestRemuxAudioOnly(t *testing.T) {
+	w := newTSWriter(streamTypeAAC)
+	// newTSWriter numbers the streams from the video PID
+	var frames [][]byte
+	for i := 0; i < audioOnlyFragment+10; i++ {
+		frame := []byte{byte(i), byte(i >> 8), 1, 2, 3}
+		frames = append(frames, frame)
+		w.pes(testVideoPID, 0xc0, uint64(i)*2090, uint64(i)*2090, adts(frame))
+	}
+
+	var out bytes.Buffer
+	if err := Remux(&out, &w.buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(topBoxes(t, out.Bytes()), " "), "ftyp moov moof mdat moof mdat"; got != want {
+		t.Errorf("Got boxes %q, want %q", got, want)
+	}
+	if got := trackSamples(t, out.Bytes(), audioTrackID); len(got) != len(frames) {
+		t.Errorf("Got %d audio samples, want %d", len(got), len(frames))
+	}
+}
+
+func TestRemuxUnsupported(t *testing.T) {
+	// HEVC video and AC-3 audio
+	w := newTSWriter(0x24, 0x81)
+	w.pes(testVideoPID, 0xe0, 0, 0, []byte{0, 0, 1, 0x40, 1})
+
+	err := Remux(&bytes.Buffer{}, &w.buf)
+	if err == nil || !strings.Contains(err.Error(), "Unsupported stream types") {
+		t.Errorf("Got %v, want unsupported stream types", err)
+	}
+}
+
+func TestRemuxNotTS(t *testing.T) {
+	err := Remux(&bytes.Buffer{}, bytes.NewReader(bytes.Repeat([]byte("<html>"), 100)))
+	if err == nil {
+		t.Error("Remuxed an HTML page")
+	}
+}
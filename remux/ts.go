@@ -0,0 +1,227 @@
+package remux
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const tsPacketSize = 188
+
+// Stream types from the PMT we know how to put in an MP4
+const (
+	streamTypeAAC  = 0x0f
+	streamTypeH264 = 0x1b
+)
+
+// pes is one reassembled packet of a stream, usually a whole frame of video or a few frames of audio
+type pes struct {
+	pid      uint16
+	pts, dts uint64
+	data     []byte
+}
+
+// demuxer reads the packets of a transport stream and hands back the PES packets of its audio and video
+type demuxer struct {
+	r *bufio.Reader
+
+	pmtPID   uint16
+	videoPID uint16
+	audioPID uint16
+	// Streams found in the PMT that we can't handle, by stream type
+	unsupported []byte
+
+	pending map[uint16][]byte
+	// Finished packets waiting to be read
+	queue []pes
+	eof   bool
+}
+
+func newDemuxer(r io.Reader) *demuxer {
+	return &demuxer{
+		r:       bufio.NewReaderSize(r, 64*tsPacketSize),
+		pending: make(map[uint16][]byte),
+	}
+}
+
+// next returns the next PES packet of the audio or video stream, or io.EOF once the stream is done
+func (d *demuxer) next() (pes, error) {
+	packet := make([]byte, tsPacketSize)
+
+	for len(d.queue) == 0 {
+		if d.eof {
+			return pes{}, io.EOF
+		}
+
+		_, err := io.ReadFull(d.r, packet)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// Whatever we have left is complete now
+			d.eof = true
+			if err := d.flush(d.videoPID); err != nil {
+				return pes{}, err
+			}
+			if err := d.flush(d.audioPID); err != nil {
+				return pes{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return pes{}, err
+		}
+
+		if err := d.packet(packet); err != nil {
+			return pes{}, err
+		}
+	}
+
+	next := d.queue[0]
+	d.queue = d.queue[1:]
+	return next, nil
+}
+
+func (d *demuxer) packet(packet []byte) error {
+	if packet[0] != 0x47 {
+		return fmt.Errorf("Not an MPEG-TS stream (lost sync)")
+	}
+
+	start := packet[1]&0x40 != 0
+	pid := uint16(packet[1]&0x1f)<<8 | uint16(packet[2])
+	adaptation := packet[3] >> 4 & 0x03
+
+	payload := packet[4:]
+	if adaptation&0x02 != 0 {
+		length := int(payload[0])
+		if length+1 > len(payload) {
+			return nil
+		}
+		payload = payload[1+length:]
+	}
+	if adaptation&0x01 == 0 {
+		return nil
+	}
+
+	switch {
+	case pid == 0:
+		if start {
+			d.pat(section(payload))
+		}
+	case pid == d.pmtPID && d.pmtPID != 0:
+		if start {
+			d.pmt(section(payload))
+		}
+	case pid == d.videoPID || pid == d.audioPID:
+		if start {
+			if err := d.flush(pid); err != nil {
+				return err
+			}
+			d.pending[pid] = append([]byte(nil), payload...)
+		} else if d.pending[pid] != nil {
+			d.pending[pid] = append(d.pending[pid], payload...)
+		}
+	}
+
+	return nil
+}
+
+// section skips the pointer field in front of a PSI table. Tables bigger than a packet don't happen in HLS.
+func section(payload []byte) []byte {
+	if len(payload) == 0 || int(payload[0])+1 > len(payload) {
+		return nil
+	}
+	payload = payload[1+int(payload[0]):]
+	if len(payload) < 3 {
+		return nil
+	}
+
+	length := int(payload[1]&0x0f)<<8 | int(payload[2])
+	// Drop the CRC at the end
+	end := min(3+length-4, len(payload))
+	if end < 8 {
+		return nil
+	}
+	return payload[:end]
+}
+
+func (d *demuxer) pat(table []byte) {
+	if len(table) == 0 || table[0] != 0x00 {
+		return
+	}
+
+	for programs := table[8:]; len(programs) >= 4; programs = programs[4:] {
+		number := uint16(programs[0])<<8 | uint16(programs[1])
+		// Program 0 points to the network information table, not a program
+		if number != 0 {
+			d.pmtPID = uint16(programs[2]&0x1f)<<8 | uint16(programs[3])
+			return
+		}
+	}
+}
+
+func (d *demuxer) pmt(table []byte) {
+	if len(table) < 12 || table[0] != 0x02 {
+		return
+	}
+
+	infoLength := int(table[10]&0x0f)<<8 | int(table[11])
+	if 12+infoLength > len(table) {
+		return
+	}
+
+	d.unsupported = nil
+	for streams := table[12+infoLength:]; len(streams) >= 5; {
+		streamType := streams[0]
+		pid := uint16(streams[1]&0x1f)<<8 | uint16(streams[2])
+		infoLength := int(streams[3]&0x0f)<<8 | int(streams[4])
+
+		switch {
+		case streamType == streamTypeH264 && d.videoPID == 0:
+			d.videoPID = pid
+		case streamType == streamTypeAAC && d.audioPID == 0:
+			d.audioPID = pid
+		case pid != d.videoPID && pid != d.audioPID:
+			d.unsupported = append(d.unsupported, streamType)
+		}
+
+		if 5+infoLength > len(streams) {
+			break
+		}
+		streams = streams[5+infoLength:]
+	}
+}
+
+// flush parses the PES packet collected so far for pid and queues it
+func (d *demuxer) flush(pid uint16) error {
+	data := d.pending[pid]
+	delete(d.pending, pid)
+	if pid == 0 || len(data) == 0 {
+		return nil
+	}
+
+	if len(data) < 9 || data[0] != 0 || data[1] != 0 || data[2] != 1 {
+		return fmt.Errorf("Broken PES packet in stream %d", pid)
+	}
+
+	flags := data[7] >> 6
+	headerEnd := 9 + int(data[8])
+	if headerEnd > len(data) {
+		return fmt.Errorf("Broken PES packet in stream %d", pid)
+	}
+
+	packet := pes{pid: pid, data: data[headerEnd:]}
+	if flags&0x02 != 0 && len(data) >= 14 {
+		packet.pts = timestamp(data[9:14])
+		packet.dts = packet.pts
+	}
+	if flags == 0x03 && len(data) >= 19 {
+		packet.dts = timestamp(data[14:19])
+	}
+
+	d.queue = append(d.queue, packet)
+	return nil
+}
+
+// timestamp reads a 33 bit PTS or DTS in 90kHz units
+func timestamp(b []byte) uint64 {
+	return uint64(b[0]>>1&0x07)<<30 | uint64(b[1])<<22 | uint64(b[2]>>1)<<15 | uint64(b[3])<<7 | uint64(b[4]>>1)
+}
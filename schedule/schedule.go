@@ -0,0 +1,177 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five field cron expression (minute hour day-of-month month day-of-week)
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Cron matches either day field when both are restricted
+	domStar, dowStar bool
+}
+
+type field struct {
+	min, max int
+}
+
+var (
+	minuteField = field{0, 59}
+	hourField   = field{0, 23}
+	domField    = field{1, 31}
+	monthField  = field{1, 12}
+	dowField    = field{0, 7}
+)
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse reads a standard cron expression such as "*/30 * * * *" or one of the @daily style shorthands
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if full, ok := shorthands[expr]; ok {
+		expr = full
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Expected 5 fields in cron expression %q, got %d", expr, len(fields))
+	}
+
+	var schedule Schedule
+	var err error
+
+	if schedule.minute, err = parseField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	// 7 is also Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow = schedule.dow&^(1<<7) | 1
+	}
+
+	schedule.domStar = fields[2] == "*" || fields[2] == "?"
+	schedule.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	// Like the 31st of February
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("Cron expression %q never matches a date", expr)
+	}
+
+	return &schedule, nil
+}
+
+func parseField(expr string, bounds field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("Invalid step in cron field %q", part)
+			}
+		}
+
+		low, high := bounds.min, bounds.max
+		if rangeExpr != "*" && rangeExpr != "?" {
+			lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+
+			var err error
+			low, err = strconv.Atoi(lowExpr)
+			if err != nil {
+				return 0, fmt.Errorf("Invalid value in cron field %q", part)
+			}
+
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highExpr)
+				if err != nil {
+					return 0, fmt.Errorf("Invalid range in cron field %q", part)
+				}
+			} else if hasStep {
+				high = bounds.max
+			}
+		}
+
+		if low < bounds.min || high > bounds.max || low > high {
+			return 0, fmt.Errorf("Cron field %q is out of range %d-%d", part, bounds.min, bounds.max)
+		}
+
+		for i := low; i <= high; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+func (schedule *Schedule) dayMatches(t time.Time) bool {
+	domMatch := schedule.dom&(1<<uint(t.Day())) != 0
+	dowMatch := schedule.dow&(1<<uint(t.Weekday())) != 0
+
+	if schedule.domStar || schedule.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// Next returns the first time after t that matches the schedule, zero if there's none. Parse only
+// returns schedules that match something.
+func (schedule *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// No valid expression needs more than a few years to come around again
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if schedule.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !schedule.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if schedule.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if schedule.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,99 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, time.January, 10, 14, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 10, 14, 8, 0, 0, time.UTC)},
+		{"*/30 * * * *", time.Date(2024, time.January, 10, 14, 30, 0, 0, time.UTC)},
+		{"7 * * * *", time.Date(2024, time.January, 10, 15, 7, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, time.January, 10, 17, 0, 0, 0, time.UTC)},
+		{"15,45 3 * * *", time.Date(2024, time.January, 11, 3, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.January, 10, 15, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		// 7 is Sunday too
+		{"0 12 * * 7", time.Date(2024, time.January, 14, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2024, time.January, 11, 12, 0, 0, 0, time.UTC)},
+		// With both day fields restricted either one matching is enough: the 20th, or the Friday before it
+		{"0 0 20 * 5", time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 11 * ?", time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 4,6,7 *", time.Date(2024, time.July, 31, 0, 0, 0, 0, time.UTC)},
+		// Only in leap years
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		schedule, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+
+		if got := schedule.Next(from); !got.Equal(test.want) {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestNextLeapDay(t *testing.T) {
+	schedule, err := Parse("0 0 29 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := schedule.Next(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestNextLocal(t *testing.T) {
+	location := time.FixedZone("UTC+5:30", 5*60*60+30*60)
+	schedule, err := Parse("0 6 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := schedule.Next(time.Date(2024, time.January, 10, 6, 0, 0, 0, location))
+	if want := time.Date(2024, time.January, 11, 6, 0, 0, 0, location); !got.Equal(want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@fortnightly",
+		// Never comes around
+		"0 0 30 2 *",
+		"0 0 31 4 *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q parsed", expr)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package vsco
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The folder in the user's folder where Options.SaveJSON keeps the API responses
+const apiFolder = "_api"
+
+// saveAPIResponse keeps body, exactly as the API sent it, as name in the user's _api folder with Options.SaveJSON
+func (scraper *Scraper) saveAPIResponse(name string, body []byte) error {
+	if !scraper.options.SaveJSON || !scraper.writesFiles() {
+		return nil
+	}
+
+	if err := scraper.saveSiteResponse(); err != nil {
+		return err
+	}
+	return scraper.writeAPIResponse(name, body)
+}
+
+// saveSiteResponse saves the sites response GetUserInfo held back, once something goes in the user's folder.
+// Commands that only look at the profile never save it.
+func (scraper *Scraper) saveSiteResponse() error {
+	site := scraper.siteResponse
+	if site == nil || !scraper.options.SaveJSON || !scraper.writesFiles() {
+		return nil
+	}
+
+	scraper.siteResponse = nil
+	return scraper.writeAPIResponse("sites.json", site)
+}
+
+func (scraper *Scraper) writeAPIResponse(name string, body []byte) error {
+	userPath, err := scraper.userPath()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(userPath, apiFolder)
+	if err := os.MkdirAll(dir, scraper.options.DirMode); err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", dir, err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, name), body, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to save API response %s: %w\n", name, err)
+	}
+	return nil
+}
+
+// apiPageName names the response for page of the paginated endpoint at pageUrl after the endpoint,
+// like medias-0000.json or collections-0001.json
+func apiPageName(pageUrl string, page int) string {
+	endpoint := strings.TrimPrefix(pageUrl, apiURL+"/")
+	endpoint, _, _ = strings.Cut(endpoint, "?")
+	endpoint, _, _ = strings.Cut(endpoint, "/")
+	return fmt.Sprintf("%s-%04d.json", endpoint, page)
+}
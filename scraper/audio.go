@@ -0,0 +1,59 @@
+package vsco
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/SilverMight/vsco-get/remux"
+)
+
+// hasAudio is false only for videos the API says are silent, we don't skip what we can't be sure about
+func hasAudio(media Media) bool {
+	return media.Has_audio == nil || *media.Has_audio
+}
+
+// audioPath is where the audio track of the video at videoPath goes
+func audioPath(videoPath string) string {
+	return strings.TrimSuffix(videoPath, path.Ext(videoPath)) + ".m4a"
+}
+
+// posterPath is where the poster frame of the video at videoPath goes
+func posterPath(videoPath string) string {
+	return strings.TrimSuffix(videoPath, path.Ext(videoPath)) + ".jpg"
+}
+
+// extractAudio copies the audio track of the video at videoPath into an .m4a next to it, without re-encoding.
+// A video without one, which the API doesn't always say, has nothing to extract and that's fine.
+func (scraper *Scraper) extractAudio(videoPath string) error {
+	video, err := os.Open(videoPath)
+	if err != nil {
+		return fmt.Errorf("Failed to extract audio from %s: %w\n", videoPath, err)
+	}
+	defer video.Close()
+
+	// Put together next to it first, so a failure doesn't leave half an .m4a
+	target := audioPath(videoPath)
+	partPath := path.Join(path.Dir(target), "."+path.Base(target)+".part")
+	defer os.Remove(partPath)
+
+	out, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to extract audio from %s: %w\n", videoPath, err)
+	}
+
+	err = remux.ExtractAudio(out, video)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, remux.ErrNoAudio) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to extract audio from %s: %w\n", videoPath, err)
+	}
+
+	return os.Rename(partPath, target)
+}
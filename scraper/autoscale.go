@@ -0,0 +1,152 @@
+package vsco
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The most workers Options.AutoWorkers grows to when it isn't given a NumWorkers of its own
+const MaxAutoWorkers = 100
+
+const (
+	// Workers Options.AutoWorkers starts out with
+	autoWorkersStart = 4
+	// How much faster a round has to be to be worth the extra workers
+	autoWorkersGain = 1.1
+	// The share of failed downloads in a round that counts as too many workers
+	autoWorkersMaxFailures = 0.1
+)
+
+// AutoScaler finds how many downloads at once a connection handles best, for Options.AutoWorkers. It starts
+// with a few workers and measures the download speed over a round of downloads; while each round is clearly
+// faster than the last it grows the workers by half. Once a round isn't faster (the downloads just got slower
+// each) or too many of them failed, it goes back to the last good number and stays there.
+//
+// Like ByteBudget it's shared by every scraper in the run, so users synced one after another keep sizing up
+// the same workers and users synced at once share them. A nil *AutoScaler leaves the workers alone.
+type AutoScaler struct {
+	ceiling int
+	written atomic.Int64
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	// The last number of workers that paid off and its speed, in bytes a second
+	best      int
+	bestSpeed float64
+	settled   bool
+
+	// The round being measured. Only the time something was downloading counts, not the time spent
+	// listing the next user in between.
+	roundBusy    time.Duration
+	busySince    time.Time
+	roundWritten int64
+	roundDone    int
+	roundFailed  int
+}
+
+// NewAutoScaler grows up to ceiling workers
+func NewAutoScaler(ceiling int) *AutoScaler {
+	scale := &AutoScaler{
+		ceiling: ceiling,
+		limit:   min(autoWorkersStart, ceiling),
+	}
+	scale.cond = sync.NewCond(&scale.mu)
+	return scale
+}
+
+// Add counts n downloaded bytes towards the speed of the round
+func (scale *AutoScaler) Add(n int64) {
+	if scale != nil {
+		scale.written.Add(n)
+	}
+}
+
+// acquire waits for a worker to be free
+func (scale *AutoScaler) acquire() {
+	if scale == nil {
+		return
+	}
+
+	scale.mu.Lock()
+	defer scale.mu.Unlock()
+
+	for scale.active >= scale.limit {
+		scale.cond.Wait()
+	}
+	if scale.active == 0 {
+		scale.busySince = time.Now()
+	}
+	scale.active++
+}
+
+// release frees the worker once its download is done, and sizes up the round once it's complete. What the
+// workers settle on goes to log.
+func (scale *AutoScaler) release(failed bool, log func(v ...any)) {
+	if scale == nil {
+		return
+	}
+
+	scale.mu.Lock()
+	defer scale.mu.Unlock()
+	defer scale.cond.Broadcast()
+
+	scale.active--
+	if scale.active == 0 {
+		scale.roundBusy += time.Since(scale.busySince)
+	}
+	scale.roundDone++
+	if failed {
+		scale.roundFailed++
+	}
+
+	// A round is enough downloads for every worker to have done a couple
+	if scale.settled || scale.roundDone < max(scale.limit*2, 8) {
+		return
+	}
+
+	busy := scale.roundBusy
+	if scale.active > 0 {
+		busy += time.Since(scale.busySince)
+	}
+	speed := float64(scale.written.Load()-scale.roundWritten) / max(busy.Seconds(), 0.001)
+	failures := float64(scale.roundFailed) / float64(scale.roundDone)
+
+	switch {
+	case failures > autoWorkersMaxFailures:
+		scale.settle(fmt.Sprintf("%d of the last %d downloads failed", scale.roundFailed, scale.roundDone), log)
+	case scale.best > 0 && speed < scale.bestSpeed*autoWorkersGain:
+		scale.settle(fmt.Sprintf("%d workers weren't faster than %d", scale.limit, scale.best), log)
+	case scale.limit >= scale.ceiling:
+		scale.best, scale.bestSpeed = scale.limit, speed
+		scale.settle("as many as allowed", log)
+	default:
+		scale.best, scale.bestSpeed = scale.limit, speed
+		scale.limit = min(scale.limit+max(scale.limit/2, 1), scale.ceiling)
+	}
+
+	scale.startRound()
+}
+
+// settle stops growing, going back to the last number of workers that paid off
+func (scale *AutoScaler) settle(reason string, log func(v ...any)) {
+	scale.settled = true
+	if scale.best > 0 {
+		scale.limit = scale.best
+	} else {
+		// Failing from the start, fewer might do better
+		scale.limit = max(scale.limit/2, 1)
+	}
+	log(fmt.Sprintf("Settled on %d workers, %s", scale.limit, reason))
+}
+
+func (scale *AutoScaler) startRound() {
+	scale.roundBusy = 0
+	scale.busySince = time.Now()
+	scale.roundWritten = scale.written.Load()
+	scale.roundDone = 0
+	scale.roundFailed = 0
+}
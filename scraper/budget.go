@@ -0,0 +1,27 @@
+package vsco
+
+import (
+	"sync/atomic"
+)
+
+// ByteBudget caps how much a run downloads. It is shared by every scraper in the run, so the
+// limit covers all users together. A nil *ByteBudget is unlimited.
+type ByteBudget struct {
+	max  int64
+	used atomic.Int64
+}
+
+func NewByteBudget(max int64) *ByteBudget {
+	return &ByteBudget{max: max}
+}
+
+func (budget *ByteBudget) Add(n int64) {
+	if budget != nil {
+		budget.used.Add(n)
+	}
+}
+
+// Exhausted reports whether we should stop starting new downloads
+func (budget *ByteBudget) Exhausted() bool {
+	return budget != nil && budget.used.Load() >= budget.max
+}
@@ -0,0 +1,113 @@
+package vsco
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Preset is the VSCO filter media was edited with
+type Preset struct {
+	Key       string `json:"key"`
+	ShortName string `json:"short_name"`
+	Color     string `json:"color"`
+}
+
+// UnmarshalJSON takes the preset as an object or just its key, and ignores anything else
+func (preset *Preset) UnmarshalJSON(data []byte) error {
+	var key string
+	if json.Unmarshal(data, &key) == nil {
+		*preset = Preset{Key: key}
+		return nil
+	}
+
+	type fields Preset
+	var decoded fields
+	if json.Unmarshal(data, &decoded) == nil {
+		*preset = Preset(decoded)
+	}
+	return nil
+}
+
+// ImageMeta is the EXIF VSCO keeps from the original upload
+type ImageMeta struct {
+	Make         metaValue `json:"make"`
+	Model        metaValue `json:"model"`
+	Software     metaValue `json:"software"`
+	Aperture     metaValue `json:"aperture"`
+	ExposureTime metaValue `json:"exposure_time"`
+	ISO          metaValue `json:"iso"`
+	FocalLength  metaValue `json:"focal_length"`
+	FlashMode    metaValue `json:"flash_mode"`
+	WhiteBalance metaValue `json:"white_balance"`
+}
+
+// metaValue is an EXIF value, which the API has as a string or a number depending on the camera. Either
+// is kept as text, so an odd one can't stop a page of media from decoding.
+type metaValue string
+
+func (value *metaValue) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		*value = metaValue(strings.TrimSpace(text))
+		return nil
+	}
+
+	var number float64
+	if json.Unmarshal(data, &number) == nil {
+		*value = metaValue(strconv.FormatFloat(number, 'f', -1, 64))
+		return nil
+	}
+
+	// Anything else (null, objects) we have no use for
+	*value = ""
+	return nil
+}
+
+// Camera is what the sidecars say about the camera and exposure
+type Camera struct {
+	Make         string `json:"make,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Software     string `json:"software,omitempty"`
+	Aperture     string `json:"aperture,omitempty"`
+	ExposureTime string `json:"exposure_time,omitempty"`
+	ISO          string `json:"iso,omitempty"`
+	FocalLength  string `json:"focal_length,omitempty"`
+	FlashMode    string `json:"flash_mode,omitempty"`
+	WhiteBalance string `json:"white_balance,omitempty"`
+}
+
+// mediaCamera is the camera details of media, nil if the API has none
+func mediaCamera(media Media) *Camera {
+	meta := media.Image_meta
+	if meta == nil {
+		return nil
+	}
+
+	camera := Camera{
+		Make:         string(meta.Make),
+		Model:        string(meta.Model),
+		Software:     string(meta.Software),
+		Aperture:     string(meta.Aperture),
+		ExposureTime: string(meta.ExposureTime),
+		ISO:          string(meta.ISO),
+		FocalLength:  string(meta.FocalLength),
+		FlashMode:    string(meta.FlashMode),
+		WhiteBalance: string(meta.WhiteBalance),
+	}
+	if camera == (Camera{}) {
+		return nil
+	}
+	return &camera
+}
+
+// presetName is the name VSCO shows for the preset media was edited with, like "A6", "" if none was
+func presetName(media Media) string {
+	if media.Preset == nil {
+		return ""
+	}
+	if media.Preset.ShortName != "" {
+		return media.Preset.ShortName
+	}
+	return strings.ToUpper(media.Preset.Key)
+}
@@ -0,0 +1,97 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// The file in the user's folder listing everything on the profile, written with Options.NoDownload
+const manifestFile = "manifest.json"
+
+// Manifest is a catalog of a profile: what's on it and where each item would be saved
+type Manifest struct {
+	Username  string          `json:"username"`
+	Generated time.Time       `json:"generated"`
+	Images    int             `json:"images"`
+	Videos    int             `json:"videos"`
+	Media     []ManifestEntry `json:"media"`
+}
+
+// ManifestEntry is the sidecar metadata of one item, plus its filename in the user's folder
+type ManifestEntry struct {
+	File string `json:"file"`
+	Metadata
+}
+
+// LoadManifest reads the manifest in userPath, nil if there isn't one
+func LoadManifest(userPath string) (*Manifest, error) {
+	data, err := os.ReadFile(path.Join(userPath, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w\n", path.Join(userPath, manifestFile), err)
+	}
+	return manifest, nil
+}
+
+// saveCatalog lists the whole profile and writes its metadata to userPath: a sidecar for each item, named
+// for the file it would be saved as, the manifest and profile.json. No media is downloaded, a later run
+// without NoDownload still sees all of it as missing.
+func (scraper *Scraper) saveCatalog(userPath string) error {
+	imagelist, err := scraper.fetchImageList()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(userPath, scraper.options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", userPath, err)
+	}
+
+	manifest := Manifest{Username: scraper.username, Generated: time.Now().UTC(), Media: []ManifestEntry{}}
+	for _, media := range imagelist.Media {
+		mediaFilename, err := scraper.getMediaFilename(media)
+		if err != nil {
+			return err
+		}
+
+		if err := scraper.writeMetadata(media, path.Join(userPath, mediaFilename)); err != nil {
+			return err
+		}
+
+		if media.Is_video {
+			manifest.Videos++
+		} else {
+			manifest.Images++
+		}
+		manifest.Media = append(manifest.Media, ManifestEntry{File: mediaFilename, Metadata: scraper.newMetadata(media)})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	manifestPath := path.Join(userPath, manifestFile)
+	err = os.WriteFile(manifestPath, data, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", manifestPath, err)
+	}
+
+	if err := scraper.writeProfile(userPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Cataloged %d items from %s (%d images, %d videos)\n", len(manifest.Media), scraper.username, manifest.Images, manifest.Videos)
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package vsco
+
+import (
+	"fmt"
+	"os"
+)
+
+// Diff prints which media is on the profile but not downloaded, and which downloaded media is gone from the profile.
+// It doesn't download or change anything.
+func (scraper *Scraper) Diff() error {
+	scraper.listOnly = true
+	defer func() { scraper.listOnly = false }()
+
+	imagelist, err := scraper.fetchImageList()
+	if err != nil {
+		return err
+	}
+
+	userPath, err := scraper.userPath()
+	if err != nil {
+		return err
+	}
+
+	missing, err := scraper.stripExistingMedia(imagelist, userPath)
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	if _, err := os.Stat(userPath); err == nil {
+		remote := make(map[string]bool)
+		err = scraper.addRemoteFiles(remote, imagelist)
+		if err != nil {
+			return err
+		}
+
+		stale, err = scraper.staleFiles(remote, userPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, media := range missing.Media {
+		mediaFilename, err := scraper.getMediaFilename(media)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("+ %s\n", mediaFilename)
+	}
+
+	for _, filename := range stale {
+		fmt.Printf("- %s\n", filename)
+	}
+
+	fmt.Printf("%s: %d on the profile, %d missing locally (+), %d only stored locally (-)\n", scraper.username, len(imagelist.Media), len(missing.Media), len(stale))
+
+	return nil
+}
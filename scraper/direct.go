@@ -0,0 +1,126 @@
+package vsco
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Extensions of the CDN files that are videos
+var videoExtensions = map[string]bool{".mp4": true, ".mov": true, ".m4v": true, ".ts": true, ".m3u8": true}
+
+// IsMediaURL tells whether rawURL points straight at a file on VSCO's CDN, like the URLs --get-urls prints,
+// rather than at a profile or post
+func IsMediaURL(rawURL string) bool {
+	parsed, err := url.Parse(fixUrl(rawURL))
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	return strings.HasSuffix(host, ".vsco.co") && host != "www.vsco.co" && path.Ext(parsed.Path) != ""
+}
+
+// ReadMediaURLs reads one URL per line from r, skipping blank lines and # comments
+func ReadMediaURLs(r io.Reader) ([]string, error) {
+	var urls []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read URLs: %w\n", err)
+	}
+	return urls, nil
+}
+
+// SaveMediaURLs downloads files straight from VSCO's CDN into the output directory, named and dated like
+// any other download. Only VSCO's own hosts are allowed, the requests carry our authorization token.
+func SaveMediaURLs(urls []string, options Options) error {
+	scraper := NewScraper("urls", options)
+	scraper.folder = ""
+	// We only know about these files, anything else in the folder would look deleted
+	scraper.options.Prune = false
+
+	list, err := scraper.mediaFromURLs(urls)
+	if err != nil {
+		return err
+	}
+	if len(list.Media) == 0 {
+		return fmt.Errorf("No URLs to download: %w\n", ErrNothingToDo)
+	}
+
+	userPath, err := scraper.userPath()
+	if err != nil {
+		return err
+	}
+
+	return scraper.saveMediaList(list, userPath)
+}
+
+// mediaFromURLs makes up the media behind each URL. The upload date is taken from the CDN's Last-Modified,
+// which is when the file was put there.
+func (scraper *Scraper) mediaFromURLs(urls []string) (imageList, error) {
+	list := imageList{Media: make([]Media, len(urls))}
+
+	for i, rawURL := range urls {
+		if !IsMediaURL(rawURL) {
+			return imageList{}, fmt.Errorf("Not a VSCO media URL: %s\n", rawURL)
+		}
+
+		mediaUrl := fixUrl(rawURL)
+		parsed, err := url.Parse(mediaUrl)
+		if err != nil {
+			return imageList{}, err
+		}
+
+		name := path.Base(parsed.Path)
+		media := Media{Id: strings.TrimSuffix(name, path.Ext(name))}
+		if videoExtensions[strings.ToLower(path.Ext(name))] {
+			media.Is_video = true
+			media.Video_url = mediaUrl
+		} else {
+			media.Responsive_url = mediaUrl
+		}
+		list.Media[i] = media
+	}
+
+	if scraper.options.NoMtime || scraper.options.GetURLs {
+		return list, nil
+	}
+
+	group := new(errgroup.Group)
+	group.SetLimit(scraper.options.NumWorkers)
+
+	for i := range list.Media {
+		media := &list.Media[i]
+		group.Go(func() error {
+			resp, err := client.Head(getCorrectUrl(*media))
+			if err != nil {
+				return nil
+			}
+			resp.Body.Close()
+
+			uploaded, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+			if err == nil {
+				media.Upload_date = int(uploaded.UnixMilli())
+			}
+			return nil
+		})
+	}
+	group.Wait()
+
+	return list, nil
+}
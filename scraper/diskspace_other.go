@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package vsco
+
+import (
+	"errors"
+)
+
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("Checking free space is not supported on this platform")
+}
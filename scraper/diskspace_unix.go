@@ -0,0 +1,19 @@
+//go:build linux || darwin
+
+package vsco
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace is how many bytes we can still write to the filesystem holding dir
+func freeSpace(dir string) (uint64, error) {
+	var stat unix.Statfs_t
+
+	err := unix.Statfs(dir, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
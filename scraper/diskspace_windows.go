@@ -0,0 +1,23 @@
+//go:build windows
+
+package vsco
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace is how many bytes we can still write to the filesystem holding dir
+func freeSpace(dir string) (uint64, error) {
+	dirp, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	err = windows.GetDiskFreeSpaceEx(dirp, &available, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return available, nil
+}
@@ -0,0 +1,126 @@
+package vsco
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// formatBytes prints a byte count the way humans read it, e.g. 1.5 GB
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// estimateSize adds up the Content-Length of every item using HEAD requests.
+// Items the CDN won't give a size for are counted in unknown.
+func (scraper *Scraper) estimateSize(list imageList) (total int64, unknown int64) {
+	for _, size := range scraper.mediaSizes(list) {
+		if size < 0 {
+			unknown++
+			continue
+		}
+		total += size
+	}
+
+	return total, unknown
+}
+
+// mediaSizes gets the Content-Length of every item in list using HEAD requests, or -1 where the CDN won't say
+// or doesn't answer with a 200.
+// Streamed videos are -1 too, all a HEAD could tell is the size of the playlist.
+func (scraper *Scraper) mediaSizes(list imageList) []int64 {
+	var sem = make(chan int, scraper.options.NumWorkers)
+	var wg sync.WaitGroup
+
+	sizes := make([]int64, len(list.Media))
+	for i, media := range list.Media {
+		sem <- 1
+		wg.Add(1)
+		go func(i int, media Media) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			sizes[i] = -1
+
+			mediaUrl := fixUrl(getCorrectUrl(media))
+			if isHLS(mediaUrl) {
+				return
+			}
+
+			resp, err := client.Head(mediaUrl)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+
+			// An error page has a size too, just not the media's
+			if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 {
+				sizes[i] = resp.ContentLength
+			}
+		}(i, media)
+	}
+
+	wg.Wait()
+
+	return sizes
+}
+
+// checkFreeSpace makes sure the download will fit before we start, rather than filling the disk halfway through
+func (scraper *Scraper) checkFreeSpace(list imageList, userPath string) error {
+	available, err := freeSpace(userPath)
+	if err != nil {
+		return fmt.Errorf("Could not check free space in %s: %w\n", userPath, err)
+	}
+
+	needed, unknown := scraper.estimateSize(list)
+	if uint64(needed) > available {
+		return fmt.Errorf("Not enough free space for %s: need %s, only %s available\n", scraper.username, formatBytes(needed), formatBytes(int64(available)))
+	}
+
+	if unknown > 0 {
+		log.Printf("Could not get the size of %d items from %s, they may not fit", unknown, scraper.username)
+	}
+
+	return nil
+}
+
+func (scraper *Scraper) printDryRun(list imageList) error {
+	counts := make(map[string]int)
+
+	for _, media := range list.Media {
+		mediaFilename, err := scraper.getMediaFilename(media)
+		if err != nil {
+			return err
+		}
+
+		counts[mediaType(media)]++
+		fmt.Printf("%s\t%s\n", mediaType(media), mediaFilename)
+	}
+
+	fmt.Printf("Would download %d items from %s (%d images, %d videos)\n", len(list.Media), scraper.username, counts["image"], counts["video"])
+
+	if scraper.options.EstimateSize {
+		total, unknown := scraper.estimateSize(list)
+		fmt.Printf("Estimated download size: %s", formatBytes(total))
+		if unknown > 0 {
+			fmt.Printf(" (size unknown for %d items)", unknown)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package vsco
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// folderUsage is how much space one user's folder takes
+type folderUsage struct {
+	name   string
+	items  int
+	videos int
+	// Bytes of the media itself, and of everything else: sidecars, posters, thumbnails, profile pictures, trash
+	media int64
+	other int64
+}
+
+// DiskUsage prints how many items each user's folder in dir has and how much space it takes, biggest first,
+// for deciding what to prune from a big archive
+func DiskUsage(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Could not read directory %s: %w\n", dir, err)
+	}
+
+	// Files hard linked into several folders (with the link store) take their space once, so the total only
+	// counts each the first time it's seen
+	counted := make(map[fileID]bool)
+	total := folderUsage{name: "Total"}
+
+	var folders []folderUsage
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		usage, unseen, err := diskUsage(filepath.Join(dir, entry.Name()), counted)
+		if err != nil {
+			return err
+		}
+		usage.name = entry.Name()
+		folders = append(folders, usage)
+
+		total.items += usage.items
+		total.videos += usage.videos
+		total.media += unseen.media
+		total.other += unseen.other
+	}
+
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[i].media+folders[i].other > folders[j].media+folders[j].other
+	})
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "User\tItems\tVideos\tMedia\tOther\tTotal\t")
+
+	for _, usage := range folders {
+		printUsage(table, usage)
+	}
+	printUsage(table, total)
+
+	return table.Flush()
+}
+
+func printUsage(table *tabwriter.Writer, usage folderUsage) {
+	fmt.Fprintf(table, "%s\t%d\t%d\t%s\t%s\t%s\t\n", usage.name, usage.items, usage.videos,
+		formatBytes(usage.media), formatBytes(usage.other), formatBytes(usage.media+usage.other))
+}
+
+// diskUsage adds up the files in userPath. Only what's directly in it counts as media, the subfolders
+// (profile pictures, trash, thumbnails) all count as other. A file linked in more than once only counts once.
+// unseen is the part of it not in counted yet, which it's added to.
+func diskUsage(userPath string, counted map[fileID]bool) (usage folderUsage, unseen folderUsage, err error) {
+	own := make(map[fileID]bool)
+
+	err = filepath.WalkDir(userPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		size, unseenSize := info.Size(), info.Size()
+		if id, links, ok := fileLinks(info); ok && links > 1 {
+			if own[id] {
+				size = 0
+			}
+			if counted[id] {
+				unseenSize = 0
+			}
+			own[id], counted[id] = true, true
+		}
+
+		if filepath.Dir(filePath) != userPath {
+			usage.other += size
+			unseen.other += unseenSize
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".mp4", ".mov", ".m4v", ".ts":
+			usage.items++
+			usage.videos++
+			usage.media += size
+			unseen.media += unseenSize
+		case ".jpg", ".jpeg", ".png", ".gif":
+			if isPoster(filePath) {
+				usage.other += size
+				unseen.other += unseenSize
+				return nil
+			}
+			usage.items++
+			usage.media += size
+			unseen.media += unseenSize
+		default:
+			usage.other += size
+			unseen.other += unseenSize
+		}
+		return nil
+	})
+	if err != nil {
+		return folderUsage{}, folderUsage{}, fmt.Errorf("Could not read directory %s: %w\n", userPath, err)
+	}
+
+	return usage, unseen, nil
+}
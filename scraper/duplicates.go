@@ -0,0 +1,288 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Images whose hashes differ in at most this many of their 64 bits are considered the same photo
+const duplicateDistance = 8
+
+// Folders in a user's directory that don't hold their posts
+var skippedFolders = map[string]bool{"profile": true, "trash": true, "unknown": true}
+
+// hashedImage is a downloaded image and its perceptual hash
+type hashedImage struct {
+	Path   string `json:"path"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+	hash   uint64
+}
+
+// duplicateGroup is a set of images that look the same, biggest first
+type duplicateGroup struct {
+	Files []hashedImage `json:"files"`
+}
+
+// FindDuplicates hashes the images under dir, which can be one user's folder or a whole archive of them, and
+// writes the groups of near-duplicates (the same photo reposted at a different size, say) to duplicates.json in dir
+func FindDuplicates(dir string, options Options) error {
+	options = withDefaults(options)
+
+	paths, err := imageFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	images, err := hashImages(dir, paths, options.NumWorkers)
+	if err != nil {
+		return err
+	}
+
+	groups := groupDuplicates(images)
+
+	reportPath := filepath.Join(dir, "duplicates.json")
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(reportPath, data, options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", reportPath, err)
+	}
+
+	for _, group := range groups {
+		var paths []string
+		for _, file := range group.Files {
+			paths = append(paths, fmt.Sprintf("%s (%dx%d)", file.Path, file.Width, file.Height))
+		}
+		fmt.Printf("%s\n", strings.Join(paths, "\n\t"))
+	}
+
+	fmt.Printf("Hashed %d images, found %d groups of duplicates, written to %s\n", len(images), len(groups), reportPath)
+
+	return nil
+}
+
+// imageFiles lists the JPEG and PNG files under dir, leaving out video posters and anything that isn't a post
+func imageFiles(dir string) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if filePath != dir && (skippedFolders[entry.Name()] || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".jpg", ".jpeg", ".png":
+		default:
+			return nil
+		}
+
+		if isPoster(filePath) {
+			return nil
+		}
+
+		paths = append(paths, filePath)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not read directory %s: %w\n", dir, err)
+	}
+
+	return paths, nil
+}
+
+// isPoster tells whether the image at imagePath is the poster frame saved next to a video
+func isPoster(imagePath string) bool {
+	base := strings.TrimSuffix(imagePath, filepath.Ext(imagePath))
+	for _, ext := range []string{".mp4", ".mov", ".ts"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hashImages decodes and hashes a few images at once. Images that can't be decoded are logged and left out.
+func hashImages(dir string, paths []string, workers int) ([]hashedImage, error) {
+	var mu sync.Mutex
+	var images []hashedImage
+
+	group := new(errgroup.Group)
+	group.SetLimit(max(workers, 1))
+
+	for _, imagePath := range paths {
+		imagePath := imagePath
+		group.Go(func() error {
+			hashed, err := hashImage(imagePath)
+			if err != nil {
+				log.Printf("Skipping %s: %v", imagePath, err)
+				return nil
+			}
+
+			hashed.Path, err = filepath.Rel(dir, imagePath)
+			if err != nil {
+				hashed.Path = imagePath
+			}
+
+			mu.Lock()
+			images = append(images, hashed)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	err := group.Wait()
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Path < images[j].Path
+	})
+	return images, err
+}
+
+func hashImage(imagePath string) (hashedImage, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return hashedImage{}, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return hashedImage{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return hashedImage{}, err
+	}
+
+	bounds := img.Bounds()
+	return hashedImage{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Size:   info.Size(),
+		hash:   differenceHash(img),
+	}, nil
+}
+
+// differenceHash is a dHash: the image shrunk to 9x8 grey pixels, with one bit per pair of neighbours telling
+// whether it gets brighter to the right. Resizing and recompressing barely changes it.
+func differenceHash(img image.Image) uint64 {
+	const width, height = 9, 8
+
+	var cells [height][width]float64
+	var counts [height][width]int
+
+	bounds := img.Bounds()
+	// JPEGs decode to YCbCr, whose Y is the brightness we want without going through color.Color for every pixel
+	ycbcr, isYCbCr := img.(*image.YCbCr)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := (y - bounds.Min.Y) * height / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			column := (x - bounds.Min.X) * width / bounds.Dx()
+
+			var luma uint8
+			if isYCbCr {
+				luma = ycbcr.Y[ycbcr.YOffset(x, y)]
+			} else {
+				luma = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			}
+
+			cells[row][column] += float64(luma)
+			counts[row][column]++
+		}
+	}
+
+	var hash uint64
+	for row := 0; row < height; row++ {
+		for column := 0; column < width-1; column++ {
+			hash <<= 1
+			if average(cells[row][column], counts[row][column]) < average(cells[row][column+1], counts[row][column+1]) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func average(sum float64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// groupDuplicates puts images whose hashes are close together in groups, directly or through another image
+func groupDuplicates(images []hashedImage) []duplicateGroup {
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range images {
+		for j := i + 1; j < len(images); j++ {
+			if bits.OnesCount64(images[i].hash^images[j].hash) <= duplicateDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := make(map[int][]hashedImage)
+	var roots []int
+	for i, hashed := range images {
+		root := find(i)
+		if members[root] == nil {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], hashed)
+	}
+
+	groups := []duplicateGroup{}
+	for _, root := range roots {
+		files := members[root]
+		if len(files) < 2 {
+			continue
+		}
+
+		// The biggest copy is the one worth keeping
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].Width*files[i].Height > files[j].Width*files[j].Height
+		})
+		groups = append(groups, duplicateGroup{files})
+	}
+
+	return groups
+}
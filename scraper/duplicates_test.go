@@ -0,0 +1,164 @@
+package vsco
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// scene draws the same picture at any size: a bright blob on a gradient
+func scene(width int, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			u, v := float64(x)/float64(width), float64(y)/float64(height)
+			level := 200*u*v + 120*math.Exp(-((u-0.3)*(u-0.3)+(v-0.6)*(v-0.6))*20)
+			img.Set(x, y, color.RGBA{uint8(min(level, 255)), uint8(min(level*0.8, 255)), 60, 255})
+		}
+	}
+	return img
+}
+
+// otherScene is a different picture: stripes that get darker down the image
+func otherScene(width int, height int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{uint8(255 * (1 - float64(y)/float64(height)) * (0.5 + 0.5*math.Sin(float64(x)*12/float64(width))))})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDifferenceHash(t *testing.T) {
+	original := differenceHash(scene(1080, 1350))
+
+	// Smaller and recompressed, it's still the same photo
+	decoded, err := jpeg.Decode(bytes.NewReader(encodeJPEG(t, scene(480, 600), 40)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if distance := bits.OnesCount64(original ^ differenceHash(decoded)); distance > duplicateDistance {
+		t.Errorf("A resized copy is %d bits away", distance)
+	}
+
+	if distance := bits.OnesCount64(original ^ differenceHash(otherScene(1080, 1350))); distance <= duplicateDistance {
+		t.Errorf("A different photo is only %d bits away", distance)
+	}
+
+	// Images that don't start at 0, 0 hash the same
+	shifted := image.NewRGBA(image.Rect(10, 20, 490, 620))
+	small := scene(480, 600)
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 480; x++ {
+			shifted.Set(x+10, y+20, small.At(x, y))
+		}
+	}
+	if differenceHash(shifted) != differenceHash(small) {
+		t.Error("Moving the bounds changed the hash")
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	images := []hashedImage{
+		{Path: "a.jpg", Width: 480, Height: 600, hash: 0xff00},
+		{Path: "b.jpg", Width: 1080, Height: 1350, hash: 0xff03},
+		{Path: "c.jpg", Width: 100, Height: 100, hash: 0x00ff00ff00ff00ff},
+		// Close to b but not to a, so it's in their group through b
+		{Path: "d.jpg", Width: 720, Height: 900, hash: 0xff03 | 0x7f<<16},
+		{Path: "e.jpg", Width: 100, Height: 100, hash: 0xffffffff00000000},
+	}
+
+	groups := groupDuplicates(images)
+
+	var got [][]string
+	for _, group := range groups {
+		var paths []string
+		for _, file := range group.Files {
+			paths = append(paths, file.Path)
+		}
+		got = append(got, paths)
+	}
+	want := [][]string{{"b.jpg", "d.jpg", "a.jpg"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	if groups := groupDuplicates(nil); groups == nil || len(groups) != 0 {
+		t.Errorf("Got %v for no images, want an empty list", groups)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		t.Helper()
+
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, scene(360, 450)); err != nil {
+		t.Fatal(err)
+	}
+
+	write("alice/vsco1.jpg", encodeJPEG(t, scene(1080, 1350), 90))
+	write("alice/vsco2.jpg", encodeJPEG(t, otherScene(1080, 1350), 90))
+	write("bob/vsco3.png", pngData.Bytes())
+	write("bob/vsco4.jpg", []byte("not an image"))
+	// Posters, profile pictures and the trash aren't posts
+	write("alice/vsco5.jpg", encodeJPEG(t, scene(640, 800), 90))
+	write("alice/vsco5.mp4", nil)
+	write("alice/profile/vsco6.jpg", encodeJPEG(t, scene(200, 250), 90))
+	write("alice/trash/vsco7.jpg", encodeJPEG(t, scene(200, 250), 90))
+
+	if err := FindDuplicates(dir, Options{NumWorkers: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "duplicates.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var groups []duplicateGroup
+	if err := json.Unmarshal(data, &groups); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []duplicateGroup{{Files: []hashedImage{
+		{Path: filepath.Join("alice", "vsco1.jpg"), Width: 1080, Height: 1350},
+		{Path: filepath.Join("bob", "vsco3.png"), Width: 360, Height: 450, Size: int64(pngData.Len())},
+	}}}
+	if len(groups) == 1 && len(groups[0].Files) == 2 {
+		// The JPEG's size depends on the encoder
+		want[0].Files[0].Size = groups[0].Files[0].Size
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("Got %+v, want %+v", groups, want)
+	}
+}
@@ -0,0 +1,31 @@
+package vsco
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUserNotFound means VSCO has no profile by that name
+	ErrUserNotFound = errors.New("User not found")
+	// ErrInvalidUsername means a username can't be a VSCO one, so it wasn't looked up
+	ErrInvalidUsername = errors.New("Invalid username")
+	// ErrUserPrivate means the profile exists, but VSCO won't show us its media
+	ErrUserPrivate = errors.New("User is private")
+	// ErrBadMedia means the CDN answered with something that isn't the media, like an error page or a
+	// placeholder image
+	ErrBadMedia = errors.New("Not the media")
+	// ErrNothingToDo means there was nothing to sync, like a user list without any users in it
+	ErrNothingToDo = errors.New("Nothing to do")
+)
+
+// UserErrors is returned by GetMediaFromUserlist when some users couldn't be synced. The others still were.
+type UserErrors []error
+
+func (errs UserErrors) Error() string {
+	return fmt.Sprintf("Failed to sync %d users\n", len(errs))
+}
+
+func (errs UserErrors) Unwrap() []error {
+	return errs
+}
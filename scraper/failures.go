@@ -0,0 +1,129 @@
+package vsco
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+	"github.com/SilverMight/vsco-get/telemetry"
+)
+
+// Failure is one thing that went wrong in a run: a download, or a whole user when ID is empty
+type Failure struct {
+	Username string    `json:"username"`
+	ID       string    `json:"id,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Class    string    `json:"class"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// FailureLog collects the failures of a run, for writing them to errors.json at the end. Like ByteBudget it's
+// shared by every scraper in the run, and a nil *FailureLog records nothing.
+type FailureLog struct {
+	mu       sync.Mutex
+	failures []Failure
+}
+
+func NewFailureLog() *FailureLog {
+	return &FailureLog{failures: []Failure{}}
+}
+
+func (failures *FailureLog) add(username string, id string, failedURL string, err error) {
+	if failures == nil || err == nil {
+		return
+	}
+
+	failure := Failure{
+		Username: username,
+		ID:       id,
+		URL:      failedURL,
+		Class:    telemetry.Classify(err),
+		Error:    strings.TrimSpace(err.Error()),
+		Time:     time.Now(),
+	}
+
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) {
+		failure.Status = statusErr.Code
+	}
+
+	// Users that are gone for good, which the list they came from is better off without, and media the CDN
+	// didn't really send
+	switch {
+	case errors.Is(err, ErrInvalidUsername):
+		failure.Class = "invalid_username"
+	case errors.Is(err, ErrUserNotFound):
+		failure.Class = "user_not_found"
+	case errors.Is(err, ErrUserPrivate):
+		failure.Class = "user_private"
+	case errors.Is(err, ErrBadMedia):
+		failure.Class = "bad_media"
+	}
+
+	// Failed requests know which URL they were for
+	var urlErr *url.Error
+	if failure.URL == "" && errors.As(err, &urlErr) {
+		failure.URL = urlErr.URL
+	}
+
+	failures.mu.Lock()
+	failures.failures = append(failures.failures, failure)
+	failures.mu.Unlock()
+}
+
+// AddUserError records a user that couldn't be synced. A SyncError is left out, its downloads were recorded
+// one by one as they failed.
+func (failures *FailureLog) AddUserError(username string, err error) {
+	var syncErr *SyncError
+	if errors.As(err, &syncErr) {
+		return
+	}
+	failures.add(username, "", "", err)
+}
+
+func (failures *FailureLog) Len() int {
+	if failures == nil {
+		return 0
+	}
+
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+	return len(failures.failures)
+}
+
+// Write saves the failures to path as JSON, or removes the file from an earlier run if nothing failed,
+// so an old report is never mistaken for this run's
+func (failures *FailureLog) Write(path string, perm os.FileMode) error {
+	if failures.Len() == 0 {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Failed to remove %s: %w\n", path, err)
+		}
+		return nil
+	}
+
+	failures.mu.Lock()
+	data, err := json.MarshalIndent(failures.failures, "", "  ")
+	failures.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if perm == 0 {
+		perm = DefaultFileMode
+	}
+	err = os.WriteFile(path, data, perm)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", path, err)
+	}
+
+	return nil
+}
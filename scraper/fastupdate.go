@@ -0,0 +1,68 @@
+package vsco
+
+import (
+	"errors"
+	"log"
+)
+
+// errCaughtUp stops the paging once the rest of the profile is saved already, see Options.FastUpdate and
+// Options.NewerThanLocal
+var errCaughtUp = errors.New("Caught up with what's already saved")
+
+// pageSaved tells whether Options.FastUpdate should stop at page, because everything on it is already in userPath.
+// Pages come newest first, so everything older is taken to be saved too. Media that's filtered out is never
+// saved, so it doesn't count; a page with nothing but that tells us nothing.
+func (scraper *Scraper) pageSaved(page imageList, userPath string) (bool, error) {
+	if !scraper.options.FastUpdate {
+		return false, nil
+	}
+
+	wanted := scraper.filterMedia(page, userPath)
+	if len(wanted.Media) == 0 {
+		return false, nil
+	}
+
+	missing, err := scraper.stripExistingMedia(wanted, userPath)
+	if err != nil {
+		return false, err
+	}
+	if len(missing.Media) > 0 {
+		return false, nil
+	}
+	scraper.noteSaved(wanted, missing)
+
+	log.Printf("%s: caught up with what's already saved, not listing older media", scraper.username)
+	return true, nil
+}
+
+// fetchNewPages is fetchPages, stopping once the rest is already saved with Options.FastUpdate or Options.NewerThanLocal
+func (scraper *Scraper) fetchNewPages(pageUrl func(page int) string, userPath string) (imageList, error) {
+	var list imageList
+
+	err := scraper.walkPages(pageUrl, func(page imageList) error {
+		saved, err := scraper.pageSaved(page, userPath)
+		if err != nil {
+			return err
+		}
+		if saved {
+			return errCaughtUp
+		}
+
+		list.Media = append(list.Media, page.Media...)
+		list.Total += page.Total
+
+		_, reached, err := scraper.filterNewerThanLocal(page, userPath)
+		if err != nil {
+			return err
+		}
+		if reached {
+			return errCaughtUp
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errCaughtUp) {
+		return imageList{}, err
+	}
+
+	return list, nil
+}
@@ -0,0 +1,24 @@
+package vsco
+
+import (
+	"fmt"
+	"path"
+)
+
+// SaveFavorites downloads the media saved to the user's collection into a favorites/ folder.
+// Your own favorites are private, so this needs a logged in session (see httpclient.SetCookies).
+func (scraper *Scraper) SaveFavorites() error {
+	if scraper.site.Site_collection_id == "" {
+		return fmt.Errorf("User %s has no favorites collection (are you logged in as them?)\n", scraper.username)
+	}
+
+	userPath, err := scraper.userPath()
+	if err != nil {
+		return err
+	}
+
+	return scraper.saveMediaPages(func(page int) string {
+		// Collection pages start at 1
+		return fmt.Sprintf("%s/collections/%s/medias?page=%d&size=%d", apiURL, scraper.site.Site_collection_id, page+1, scraper.options.PageSize)
+	}, path.Join(userPath, "favorites"))
+}
@@ -0,0 +1,142 @@
+package vsco
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How many of the newest media the feed lists
+const feedLength = 50
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// fileURL is a file:// link to the local file at filePath
+func fileURL(filePath string) string {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+
+	// Windows paths (C:\...) need a slash in front too
+	slashed := filepath.ToSlash(absPath)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// feedTitle is the first line of the caption, or the filename if there is none
+func feedTitle(item galleryItem) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(item.Caption), "\n")
+	if title == "" {
+		return filepath.Base(item.path)
+	}
+	return title
+}
+
+// writeFeed writes feed.xml to the user's folder: an Atom feed of the newest media in it, linking to the local files,
+// so a feed reader can follow the user through the archive
+func (scraper *Scraper) writeFeed(userPath string) error {
+	items, err := galleryItems(userPath)
+	if err != nil {
+		return err
+	}
+	if len(items) > feedLength {
+		items = items[:feedLength]
+	}
+
+	feedPath := filepath.Join(userPath, "feed.xml")
+	feed := atomFeed{
+		ID:      fileURL(userPath),
+		Title:   fmt.Sprintf("%s on VSCO", scraper.username),
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  scraper.username,
+		Links: []atomLink{
+			{Href: fmt.Sprintf("https://vsco.co/%s/gallery", scraper.username)},
+			{Href: fileURL(feedPath), Rel: "self"},
+		},
+	}
+	if len(items) > 0 {
+		feed.Updated = items[0].Date.UTC().Format(time.RFC3339)
+	}
+
+	for _, item := range items {
+		link := fileURL(item.path)
+
+		// Videos without a poster have nothing to show
+		var preview string
+		if _, err := os.Stat(thumbPath(item.path)); err == nil {
+			preview = fileURL(thumbPath(item.path))
+		} else if !item.IsVideo {
+			preview = link
+		} else if item.Poster != "" {
+			preview = fileURL(posterPath(item.path))
+		}
+
+		content := fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(link), html.EscapeString(filepath.Base(item.path)))
+		if preview != "" {
+			content = fmt.Sprintf(`<p><a href="%s"><img src="%s"></a></p>`, html.EscapeString(link), html.EscapeString(preview))
+		}
+		if item.Caption != "" {
+			content += fmt.Sprintf("<p>%s</p>", strings.ReplaceAll(html.EscapeString(item.Caption), "\n", "<br>"))
+		}
+
+		entry := atomEntry{
+			ID:      link,
+			Title:   feedTitle(item),
+			Updated: item.Date.UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Href: link}},
+			Content: atomContent{Type: "html", Body: content},
+		}
+		if item.permalink != "" {
+			entry.ID = item.permalink
+			entry.Links = append(entry.Links, atomLink{Href: item.permalink, Rel: "related"})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(feedPath, append([]byte(xml.Header), data...), scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", feedPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package vsco
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID tells files apart by their data rather than their name, so hard links to the same file are one
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileLinks is the identity of the file behind info and how many names it has. ok is false where the
+// system doesn't say.
+func fileLinks(info fs.FileInfo) (id fileID, links uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, 1, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, uint64(stat.Nlink), true
+}
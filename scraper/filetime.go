@@ -0,0 +1,13 @@
+//go:build !windows
+
+package vsco
+
+import (
+	"os"
+	"time"
+)
+
+// setFileTimes stamps a saved file with its upload date
+func setFileTimes(filePath string, t time.Time) error {
+	return os.Chtimes(filePath, t, t)
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package vsco
+
+import (
+	"syscall"
+	"time"
+)
+
+// setFileTimes stamps a saved file with its upload date.
+// Explorer sorts by creation time, so set that too rather than just the modification time.
+func setFileTimes(filePath string, t time.Time) error {
+	pathp, err := syscall.UTF16PtrFromString(filePath)
+	if err != nil {
+		return err
+	}
+
+	handle, err := syscall.CreateFile(pathp, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(handle)
+
+	filetime := syscall.NsecToFiletime(t.UnixNano())
+
+	return syscall.SetFileTime(handle, &filetime, &filetime, &filetime)
+}
@@ -0,0 +1,81 @@
+package vsco
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ParseTypes reads a comma separated list of file types for Options.IncludeTypes, like "jpg,mp4".
+// Types are extensions, with or without the dot, and jpeg is the same as jpg.
+func ParseTypes(list string) (map[string]bool, error) {
+	types := make(map[string]bool)
+	for _, field := range strings.Split(list, ",") {
+		ext := normalizeType(field)
+		if ext == "" {
+			return nil, fmt.Errorf("Invalid type list %q, expected extensions like jpg,mp4\n", list)
+		}
+		types[ext] = true
+	}
+	return types, nil
+}
+
+func normalizeType(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+	if ext == "jpeg" {
+		return "jpg"
+	}
+	return ext
+}
+
+// mediaExtension is the type media is saved as, by the extension of its URL. Streamed videos are saved as MP4.
+func mediaExtension(media Media) string {
+	mediaUrl := getCorrectUrl(media)
+	if isHLS(mediaUrl) {
+		return "mp4"
+	}
+
+	parsed, err := url.Parse(mediaUrl)
+	if err != nil {
+		return ""
+	}
+	return normalizeType(path.Ext(parsed.Path))
+}
+
+// filterTypes applies Options.IncludeTypes
+func (scraper *Scraper) filterTypes(list imageList) imageList {
+	if scraper.options.IncludeTypes == nil {
+		return list
+	}
+
+	var filtered imageList
+	for _, media := range list.Media {
+		if scraper.options.IncludeTypes[mediaExtension(media)] {
+			filtered.Media = append(filtered.Media, media)
+		}
+	}
+
+	return filtered
+}
+
+// filterResolution applies Options.MinWidth and Options.MinHeight. Media the API has no dimensions for is kept,
+// we can't tell it's too small.
+func (scraper *Scraper) filterResolution(list imageList) imageList {
+	if scraper.options.MinWidth <= 0 && scraper.options.MinHeight <= 0 {
+		return list
+	}
+
+	var filtered imageList
+	for _, media := range list.Media {
+		if media.Width > 0 && media.Width < scraper.options.MinWidth {
+			continue
+		}
+		if media.Height > 0 && media.Height < scraper.options.MinHeight {
+			continue
+		}
+		filtered.Media = append(filtered.Media, media)
+	}
+
+	return filtered
+}
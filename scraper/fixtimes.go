@@ -0,0 +1,196 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// timesFixed is what FixTimes did in one user's folder
+type timesFixed struct {
+	fixed   int
+	correct int
+	// Media nothing knew the upload date of
+	unknown int
+	// Media hard linked from elsewhere, with the link store, whose time isn't only this folder's to change
+	shared int
+}
+
+// FixTimes walks the user folders in dir and sets the time of every media file back to its upload date, like
+// downloading it did, for archives copied somewhere that didn't keep file times. The date comes from the
+// file's metadata sidecar, else the folder's manifest.json, else the profile itself, looked up only for
+// folders that have files neither of those cover.
+func FixTimes(dir string, options Options) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Could not read directory %s: %w\n", dir, err)
+	}
+
+	var total timesFixed
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		fixed, err := fixUserTimes(filepath.Join(dir, entry.Name()), entry.Name(), options)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: fixed %d, %d already right, %d without an upload date, %d shared\n", entry.Name(), fixed.fixed, fixed.correct, fixed.unknown, fixed.shared)
+
+		total.fixed += fixed.fixed
+		total.correct += fixed.correct
+		total.unknown += fixed.unknown
+		total.shared += fixed.shared
+	}
+
+	fmt.Printf("Fixed the times of %d files (%d already right, %d without an upload date, %d left alone for being shared through the link store)\n", total.fixed, total.correct, total.unknown, total.shared)
+
+	return nil
+}
+
+// fixUserTimes fixes the times of the media directly in userPath, the folder of username
+func fixUserTimes(userPath string, username string, options Options) (timesFixed, error) {
+	var result timesFixed
+
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		return result, fmt.Errorf("Could not read directory %s: %w\n", userPath, err)
+	}
+
+	manifest, err := LoadManifest(userPath)
+	if err != nil {
+		return result, err
+	}
+	manifestTimes := make(map[string]time.Time)
+	if manifest != nil {
+		for _, entry := range manifest.Media {
+			manifestTimes[entry.File] = entry.UploadDate
+		}
+	}
+
+	uploaded := make(map[string]time.Time)
+	var missing []string
+	for _, entry := range entries {
+		mediaPath := filepath.Join(userPath, entry.Name())
+		if entry.IsDir() || !isMediaFile(entry.Name()) || (!isVideoFile(entry.Name()) && isPoster(mediaPath)) {
+			continue
+		}
+
+		if t := sidecarUploadDate(mediaPath); !t.IsZero() {
+			uploaded[entry.Name()] = t
+		} else if t := manifestTimes[entry.Name()]; !t.IsZero() {
+			uploaded[entry.Name()] = t
+		} else {
+			missing = append(missing, entry.Name())
+		}
+	}
+
+	if len(missing) > 0 {
+		remote, err := remoteUploadDates(username, options)
+		if err != nil {
+			fmt.Printf("Couldn't look up upload dates on %s's profile: %s\n", username, strings.TrimSpace(err.Error()))
+		}
+		for _, name := range missing {
+			if t := remote[name]; !t.IsZero() {
+				uploaded[name] = t
+			} else {
+				result.unknown++
+			}
+		}
+	}
+
+	for name, t := range uploaded {
+		// Downloads are stamped to the second
+		t = t.Truncate(time.Second)
+
+		mediaPath := filepath.Join(userPath, name)
+		files := []string{mediaPath}
+		if isVideoFile(name) {
+			files = append(files, posterPath(mediaPath), audioPath(mediaPath))
+		}
+
+		changed, shared := false, false
+		for i, filePath := range files {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				// Videos don't always have a poster or audio next to them
+				if i > 0 && os.IsNotExist(err) {
+					continue
+				}
+				return result, fmt.Errorf("Could not read %s: %w\n", filePath, err)
+			}
+			if info.ModTime().Equal(t) {
+				continue
+			}
+			if _, links, _ := fileLinks(info); i == 0 && links > 1 {
+				shared = true
+				break
+			}
+
+			if err := setFileTimes(filePath, t); err != nil {
+				return result, fmt.Errorf("Failed to set the time of %s: %w\n", filePath, err)
+			}
+			changed = true
+		}
+
+		switch {
+		case shared:
+			result.shared++
+		case changed:
+			result.fixed++
+		default:
+			result.correct++
+		}
+	}
+
+	return result, nil
+}
+
+// sidecarUploadDate is the upload date in the metadata sidecar of mediaPath, zero if there isn't one
+func sidecarUploadDate(mediaPath string) time.Time {
+	data, err := os.ReadFile(sidecarPath(mediaPath))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var metadata Metadata
+	if json.Unmarshal(data, &metadata) != nil {
+		return time.Time{}
+	}
+	return metadata.UploadDate
+}
+
+// remoteUploadDates lists username's profile for the upload date of each of its files, by filename
+func remoteUploadDates(username string, options Options) (map[string]time.Time, error) {
+	scraper := NewScraper(username, options)
+	if err := scraper.GetUserInfo(); err != nil {
+		return nil, err
+	}
+
+	imagelist, err := scraper.fetchImageList()
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make(map[string]time.Time)
+	for _, media := range imagelist.Media {
+		mediaFilename, err := scraper.getMediaFilename(media)
+		if err != nil {
+			return nil, err
+		}
+		dates[mediaFilename] = msToTime(media.Upload_date)
+	}
+	return dates, nil
+}
+
+func isVideoFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mp4", ".mov", ".m4v", ".ts":
+		return true
+	}
+	return false
+}
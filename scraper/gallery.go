@@ -0,0 +1,213 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0 auto; max-width: 1400px; padding: 16px; font-family: sans-serif; background: #fafafa; color: #222; }
+header { display: flex; gap: 16px; align-items: center; margin-bottom: 24px; }
+header img { width: 96px; height: 96px; border-radius: 50%; object-fit: cover; }
+header p { margin: 4px 0; white-space: pre-line; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(240px, 1fr)); gap: 16px; }
+figure { margin: 0; background: #fff; box-shadow: 0 1px 3px rgba(0, 0, 0, .15); }
+figure img, figure video { display: block; width: 100%; aspect-ratio: 1; object-fit: cover; background: #ddd; }
+figcaption { padding: 8px; font-size: 14px; white-space: pre-line; overflow-wrap: anywhere; }
+time { display: block; color: #777; font-size: 12px; margin-bottom: 4px; }
+</style>
+</head>
+<body>
+<header>
+{{if .ProfilePicture}}<img src="{{.ProfilePicture}}" alt="">{{end}}
+<div>
+<h1>{{.Title}}</h1>
+{{with .Profile}}{{if .Description}}<p>{{.Description}}</p>{{end}}{{if .External_link}}<p><a href="{{.External_link}}">{{or .External_link_text .External_link}}</a></p>{{end}}{{end}}
+<p>{{len .Items}} items</p>
+</div>
+</header>
+<div class="grid">
+{{range .Items}}<figure>
+{{if .IsVideo}}<video src="{{.Src}}" {{with or .Thumb .Poster}}poster="{{.}}" {{end}}controls preload="none"></video>
+{{else}}<a href="{{.Src}}"><img src="{{or .Thumb .Src}}" loading="lazy" alt="{{.Caption}}"></a>
+{{end}}<figcaption>{{if not .Date.IsZero}}<time datetime="{{.Date.Format "2006-01-02T15:04:05Z07:00"}}">{{.Date.Format "January 2, 2006"}}</time>{{end}}{{.Caption}}</figcaption>
+</figure>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// galleryItem is one downloaded file, as shown in the gallery
+type galleryItem struct {
+	Src     string
+	Poster  string
+	Thumb   string
+	IsVideo bool
+	Caption string
+	Date    time.Time
+	path    string
+	// From the sidecar, if there is one
+	permalink string
+}
+
+type galleryPage struct {
+	Title          string
+	Profile        *Site
+	ProfilePicture string
+	Items          []galleryItem
+}
+
+// galleryLink is a relative link to name that survives characters like '#' and '?' in filenames
+func galleryLink(name string) string {
+	return (&url.URL{Path: filepath.ToSlash(name)}).String()
+}
+
+// WriteGallery writes an index.html to dir, a user's download folder, showing everything in it newest first with
+// dates and captions. Captions and exact dates come from the metadata sidecars (-m), otherwise the file times are used.
+// Thumbnails missing from .thumbs/ are made first, so the page doesn't have to load every original.
+func WriteGallery(dir string, options Options) error {
+	options = withDefaults(options)
+
+	page := galleryPage{Title: filepath.Base(filepath.Clean(dir))}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "profile.json")); err == nil {
+		var site Site
+		if json.Unmarshal(data, &site) == nil {
+			page.Profile = &site
+			if site.Subdomain != "" {
+				page.Title = site.Subdomain
+			}
+		}
+	}
+
+	pictureName := filepath.Join("profile", page.Title+".jpg")
+	if _, err := os.Stat(filepath.Join(dir, pictureName)); err == nil {
+		page.ProfilePicture = galleryLink(pictureName)
+	}
+
+	items, err := galleryItems(dir)
+	if err != nil {
+		return err
+	}
+	page.Items = items
+
+	makeThumbnails(page.Items, options)
+	for i, item := range page.Items {
+		if _, err := os.Stat(thumbPath(item.path)); err == nil {
+			page.Items[i].Thumb = galleryLink(filepath.Join(".thumbs", filepath.Base(thumbPath(item.path))))
+		}
+	}
+
+	indexPath := filepath.Join(dir, "index.html")
+	file, err := os.OpenFile(indexPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", indexPath, err)
+	}
+	defer file.Close()
+
+	err = galleryTemplate.Execute(file, page)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", indexPath, err)
+	}
+
+	fmt.Printf("Wrote a gallery of %d items to %s\n", len(page.Items), indexPath)
+
+	return nil
+}
+
+// makeThumbnails makes the thumbnails items don't have yet, a few at once. Failures are logged, the gallery
+// shows the original instead.
+func makeThumbnails(items []galleryItem, options Options) {
+	group := new(errgroup.Group)
+	group.SetLimit(max(options.NumWorkers, 1))
+
+	for _, item := range items {
+		mediaPath := item.path
+		if _, err := os.Stat(thumbPath(mediaPath)); err == nil {
+			continue
+		}
+
+		group.Go(func() error {
+			if err := writeThumbnail(mediaPath, options); err != nil {
+				log.Print(err)
+			}
+			return nil
+		})
+	}
+
+	group.Wait()
+}
+
+// galleryItems lists the media in dir, newest first
+func galleryItems(dir string) ([]galleryItem, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read directory %s: %w\n", dir, err)
+	}
+
+	var items []galleryItem
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		filePath := filepath.Join(dir, name)
+
+		var item galleryItem
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+			if isPoster(filePath) {
+				continue
+			}
+		case ".mp4", ".mov", ".m4v":
+			item.IsVideo = true
+			if _, err := os.Stat(posterPath(filePath)); err == nil {
+				item.Poster = galleryLink(posterPath(name))
+			}
+		default:
+			continue
+		}
+
+		item.Src = galleryLink(name)
+		item.path = filePath
+
+		if info, err := entry.Info(); err == nil {
+			item.Date = info.ModTime()
+		}
+		if data, err := os.ReadFile(sidecarPath(filePath)); err == nil {
+			var metadata Metadata
+			if json.Unmarshal(data, &metadata) == nil {
+				item.Caption = metadata.Caption
+				item.permalink = metadata.Permalink
+				if !metadata.UploadDate.IsZero() {
+					item.Date = metadata.UploadDate
+				}
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Date.After(items[j].Date)
+	})
+
+	return items, nil
+}
@@ -0,0 +1,352 @@
+package vsco
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+	"github.com/SilverMight/vsco-get/remux"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// How many segments of a video to download at once
+const hlsSegmentWorkers = 4
+
+// Video qualities for Options.VideoQuality, besides a height like "720"
+const (
+	QualityBest  = "best"
+	QualityWorst = "worst"
+)
+
+// hlsVariant is one of the streams listed in a master playlist
+type hlsVariant struct {
+	url       string
+	bandwidth int
+	height    int
+}
+
+// hlsPlaylist is a media playlist, the segments to download in order
+type hlsPlaylist struct {
+	// fMP4 streams start with an initialization section
+	initURL  string
+	segments []string
+	// Length of the stream in seconds, going by the segments' #EXTINF
+	duration float64
+}
+
+func isHLS(mediaUrl string) bool {
+	parsed, err := url.Parse(mediaUrl)
+	return err == nil && strings.HasSuffix(strings.ToLower(parsed.Path), ".m3u8")
+}
+
+// ValidVideoQuality tells whether quality is something Options.VideoQuality understands
+func ValidVideoQuality(quality string) bool {
+	if quality == QualityBest || quality == QualityWorst {
+		return true
+	}
+	height, err := strconv.Atoi(quality)
+	return err == nil && height > 0
+}
+
+// parseAttributes splits an attribute list like BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseAttributes(list string) map[string]string {
+	attributes := make(map[string]string)
+
+	for list != "" {
+		name, rest, found := strings.Cut(list, "=")
+		if !found {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			value, rest = rest[1:end+1], rest[min(end+2, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attributes[strings.TrimSpace(name)] = value
+		list = strings.TrimPrefix(rest, ",")
+	}
+
+	return attributes
+}
+
+func resolveURL(base *url.URL, ref string) (string, error) {
+	refURL, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(refURL).String(), nil
+}
+
+// fetchPlaylist gets a playlist, returning its variants if it's a master playlist or its segments otherwise
+func fetchPlaylist(playlistURL string) ([]hlsVariant, hlsPlaylist, error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, hlsPlaylist{}, err
+	}
+
+	resp, err := client.Get(playlistURL)
+	if err != nil {
+		return nil, hlsPlaylist{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, hlsPlaylist{}, fmt.Errorf("Failed to get playlist %s: %w\n", playlistURL, httpclient.NewStatusError(resp))
+	}
+
+	var variants []hlsVariant
+	var playlist hlsPlaylist
+
+	// The tag before a URI says what the URI is
+	var pending *hlsVariant
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attributes := parseAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			variant := hlsVariant{}
+			variant.bandwidth, _ = strconv.Atoi(attributes["BANDWIDTH"])
+			if _, height, found := strings.Cut(attributes["RESOLUTION"], "x"); found {
+				variant.height, _ = strconv.Atoi(height)
+			}
+			pending = &variant
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			attributes := parseAttributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))
+			if _, ok := attributes["BYTERANGE"]; ok {
+				return nil, hlsPlaylist{}, fmt.Errorf("Playlist %s uses byte ranges, which aren't supported\n", playlistURL)
+			}
+			playlist.initURL, err = resolveURL(base, attributes["URI"])
+			if err != nil {
+				return nil, hlsPlaylist{}, err
+			}
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			if method := parseAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))["METHOD"]; method != "NONE" {
+				return nil, hlsPlaylist{}, fmt.Errorf("Playlist %s is encrypted (%s), which isn't supported\n", playlistURL, method)
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			seconds, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			if duration, err := strconv.ParseFloat(strings.TrimSpace(seconds), 64); err == nil {
+				playlist.duration += duration
+			}
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			return nil, hlsPlaylist{}, fmt.Errorf("Playlist %s uses byte ranges, which aren't supported\n", playlistURL)
+		case strings.HasPrefix(line, "#"):
+			// Nothing else matters for downloading
+		default:
+			uri, err := resolveURL(base, line)
+			if err != nil {
+				return nil, hlsPlaylist{}, err
+			}
+
+			if pending != nil {
+				pending.url = uri
+				variants = append(variants, *pending)
+				pending = nil
+			} else {
+				playlist.segments = append(playlist.segments, uri)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, hlsPlaylist{}, fmt.Errorf("Failed to read playlist %s: %w\n", playlistURL, err)
+	}
+
+	return variants, playlist, nil
+}
+
+// pickVariant chooses the stream for quality: the best or worst one, or for a height the biggest that
+// isn't taller (or the smallest there is, if they all are)
+func pickVariant(variants []hlsVariant, quality string) hlsVariant {
+	sorted := append([]hlsVariant(nil), variants...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].height != sorted[j].height {
+			return sorted[i].height < sorted[j].height
+		}
+		return sorted[i].bandwidth < sorted[j].bandwidth
+	})
+
+	switch quality {
+	case QualityWorst:
+		return sorted[0]
+	case QualityBest, "":
+		return sorted[len(sorted)-1]
+	}
+
+	maxHeight, _ := strconv.Atoi(quality)
+	picked := sorted[0]
+	for _, variant := range sorted {
+		if variant.height <= maxHeight {
+			picked = variant
+		}
+	}
+	return picked
+}
+
+// hlsFilename names a video saved from a playlist, whose own name ("playlist.m3u8" and the like) says nothing.
+// Streams are always saved as MP4, transport streams get remuxed.
+func hlsFilename(media Media) string {
+	return media.Id + ".mp4"
+}
+
+// downloadHLS saves the stream at playlistURL to file, picking the variant for Options.VideoQuality. It's
+// put together in a hidden .part file next to it and only renamed to file once complete, so a stream that
+// fails halfway doesn't leave a video that looks downloaded.
+func (scraper *Scraper) downloadHLS(playlistURL string, file string, progress func(written int64, total int64)) (written int64, err error) {
+	variants, playlist, err := fetchPlaylist(playlistURL)
+	if err != nil {
+		return 0, err
+	}
+
+	var bandwidth int
+	if len(variants) > 0 {
+		variant := pickVariant(variants, scraper.options.VideoQuality)
+		bandwidth = variant.bandwidth
+		variants, playlist, err = fetchPlaylist(variant.url)
+		if err != nil {
+			return 0, err
+		}
+		if len(variants) > 0 {
+			return 0, fmt.Errorf("Playlist %s points to another master playlist\n", variant.url)
+		}
+	}
+
+	if len(playlist.segments) == 0 {
+		return 0, fmt.Errorf("Playlist %s has no segments\n", playlistURL)
+	}
+
+	// The size of a stream isn't known until it's in, but the bandwidth it was listed with over its length
+	// comes close. Without that it's stopped once it goes over.
+	maxSize := scraper.options.MaxFileSize
+	if estimate := int64(float64(bandwidth) / 8 * playlist.duration); maxSize > 0 && estimate > maxSize {
+		return 0, fmt.Errorf("%w (about %d bytes)", httpclient.ErrTooLarge, estimate)
+	}
+
+	partPath := path.Join(path.Dir(file), "."+path.Base(file)+".part")
+	out, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, scraper.options.FileMode)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(partPath)
+	defer out.Close()
+
+	// fMP4 segments are already an MP4 when put together
+	if playlist.initURL != "" {
+		written, err = downloadSegments(append([]string{playlist.initURL}, playlist.segments...), out, maxSize, progress)
+	} else {
+		written, err = remuxSegments(playlist.segments, out, maxSize, progress)
+	}
+	if err != nil {
+		return written, err
+	}
+
+	if err := out.Close(); err != nil {
+		return written, err
+	}
+	return written, os.Rename(partPath, file)
+}
+
+// remuxSegments downloads MPEG-TS segments and remuxes them into an MP4 in out as they come in
+func remuxSegments(segments []string, out io.Writer, maxSize int64, progress func(written int64, total int64)) (written int64, err error) {
+	reader, writer := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		written, err = downloadSegments(segments, writer, maxSize, progress)
+		writer.CloseWithError(err)
+		done <- err
+	}()
+
+	remuxErr := remux.Remux(out, reader)
+	// Stops the download if remuxing gave up early
+	reader.Close()
+
+	err = <-done
+	if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return written, err
+	}
+	if remuxErr != nil {
+		return written, fmt.Errorf("Failed to remux video to MP4: %w\n", remuxErr)
+	}
+	return written, nil
+}
+
+// downloadSegments fetches a few segments at once, writing them to out in order as they come in. It stops
+// with httpclient.ErrTooLarge once more than maxSize bytes came in, if maxSize isn't 0.
+func downloadSegments(segments []string, out io.Writer, maxSize int64, progress func(written int64, total int64)) (written int64, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	group, ctx := errgroup.WithContext(ctx)
+
+	results := make([]chan []byte, len(segments))
+	next := 0
+
+	for i := range segments {
+		// Only keep a few segments ahead of the one we're writing in memory
+		for ; next < len(segments) && next <= i+hlsSegmentWorkers; next++ {
+			segment, result := segments[next], make(chan []byte, 1)
+			results[next] = result
+
+			group.Go(func() error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				var buf bytes.Buffer
+				_, err := client.DownloadTo(segment, &buf)
+				if err != nil {
+					return fmt.Errorf("Failed to download segment %s: %w\n", path.Base(segment), err)
+				}
+
+				result <- buf.Bytes()
+				return nil
+			})
+		}
+
+		select {
+		case data := <-results[i]:
+			n, err := out.Write(data)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			results[i] = nil
+		case <-ctx.Done():
+			return written, group.Wait()
+		}
+
+		if maxSize > 0 && written > maxSize {
+			return written, fmt.Errorf("%w (over %d bytes)", httpclient.ErrTooLarge, maxSize)
+		}
+
+		if progress != nil {
+			progress(written, -1)
+		}
+	}
+
+	return written, group.Wait()
+}
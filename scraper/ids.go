@@ -0,0 +1,58 @@
+package vsco
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadIDList reads media IDs (or post URLs) from a file, one per line. Blank lines and lines starting with # are ignored.
+func ReadIDList(file string) (map[string]bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file %s: %w\n", file, err)
+	}
+	defer f.Close()
+
+	ids := make(map[string]bool)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, id, ok := ParseMediaURL(line); ok {
+			line = id
+		}
+		ids[line] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read file %s: %w\n", file, err)
+	}
+
+	return ids, nil
+}
+
+// filterIDs applies Options.IDs and Options.ExcludeIDs
+func (scraper *Scraper) filterIDs(list imageList) imageList {
+	if scraper.options.IDs == nil && scraper.options.ExcludeIDs == nil {
+		return list
+	}
+
+	var filtered imageList
+	for _, media := range list.Media {
+		if scraper.options.IDs != nil && !scraper.options.IDs[media.Id] {
+			continue
+		}
+		if scraper.options.ExcludeIDs[media.Id] {
+			continue
+		}
+		filtered.Media = append(filtered.Media, media)
+	}
+
+	return filtered
+}
@@ -0,0 +1,43 @@
+package vsco
+
+import (
+	"context"
+)
+
+// MediaInfo describes one item on a profile, so callers can pick what to save before calling SaveMediaToFile
+type MediaInfo struct {
+	Metadata
+	// "image" or "video"
+	Type string `json:"type"`
+	// What to hand to SaveMediaToFile
+	Media Media `json:"-"`
+}
+
+// ListMedia returns every item on the profile, newest first, without downloading anything. GetUserInfo has to
+// be called first. Listing stops between pages once ctx is done.
+func (scraper *Scraper) ListMedia(ctx context.Context) ([]MediaInfo, error) {
+	var infos []MediaInfo
+
+	scraper.listOnly = true
+	defer func() { scraper.listOnly = false }()
+
+	err := scraper.walkPages(scraper.mediaPageUrl, func(page imageList) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for _, media := range page.Media {
+			infos = append(infos, MediaInfo{
+				Metadata: scraper.newMetadata(media),
+				Type:     mediaType(media),
+				Media:    media,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
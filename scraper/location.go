@@ -0,0 +1,183 @@
+package vsco
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Location is where a photo was taken, as the uploader tagged it
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// mediaLocation is the location of media, nil if it has none. The API gives it longitude first, like GeoJSON.
+func mediaLocation(media Media) *Location {
+	if len(media.Location_coords) != 2 {
+		return nil
+	}
+
+	location := Location{Latitude: media.Location_coords[1], Longitude: media.Location_coords[0]}
+	if math.Abs(location.Latitude) > 90 || math.Abs(location.Longitude) > 180 {
+		return nil
+	}
+	// Zero is what some items have for no location
+	if location.Latitude == 0 && location.Longitude == 0 {
+		return nil
+	}
+	return &location
+}
+
+// xmpCoordinate writes value the way XMP wants GPS coordinates, like "37,46.4940N"
+func xmpCoordinate(value float64, positive byte, negative byte) string {
+	ref := positive
+	if value < 0 {
+		ref, value = negative, -value
+	}
+
+	degrees := math.Floor(value)
+	return fmt.Sprintf("%d,%.4f%c", int(degrees), (value-degrees)*60, ref)
+}
+
+// embedLocation writes location into the EXIF of the JPEG at imagePath. Images from the CDN don't have EXIF,
+// one that does is left alone rather than risk breaking it, the sidecars still have the location.
+func embedLocation(imagePath string, location *Location, mode os.FileMode) error {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return err
+	}
+
+	insertAt, hasExif := exifInsertOffset(data)
+	if insertAt < 0 || hasExif {
+		return nil
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:insertAt])
+	out.Write(gpsExifSegment(location))
+	out.Write(data[insertAt:])
+
+	tmp, err := os.CreateTemp(filepath.Dir(imagePath), ".location-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(out.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), imagePath)
+}
+
+// exifInsertOffset finds where an EXIF segment goes in the JPEG data: after the start of image and any
+// JFIF header. It's -1 if data isn't a JPEG, and hasExif tells whether there is one already.
+func exifInsertOffset(data []byte) (offset int, hasExif bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return -1, false
+	}
+
+	offset = 2
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		// Start of scan, the image data follows
+		if marker == 0xDA {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return -1, false
+		}
+
+		if marker == 0xE1 && bytes.HasPrefix(data[pos+4:end], []byte("Exif\x00\x00")) {
+			return offset, true
+		}
+		if marker == 0xE0 && pos == offset {
+			offset = end
+		}
+		pos = end
+	}
+
+	return offset, false
+}
+
+// gpsExifSegment is an APP1 segment with just the GPS tags for location
+func gpsExifSegment(location *Location) []byte {
+	const (
+		typeByte     = 1
+		typeASCII    = 2
+		typeLong     = 4
+		typeRational = 5
+
+		// Offsets in the TIFF data: its header, IFD0 with the pointer to the GPS IFD, then the GPS IFD
+		// with 5 entries, then the coordinates it points to
+		gpsIFD    = 8 + 2 + 12 + 4
+		latitude  = gpsIFD + 2 + 5*12 + 4
+		longitude = latitude + 3*8
+	)
+
+	var tiff bytes.Buffer
+	order := binary.BigEndian
+	write := func(v any) { binary.Write(&tiff, order, v) }
+	entry := func(tag uint16, kind uint16, count uint32, value []byte) {
+		write(tag)
+		write(kind)
+		write(count)
+		tiff.Write(append(value, make([]byte, 4-len(value))...))
+	}
+	offset := func(v uint32) []byte { return order.AppendUint32(nil, v) }
+
+	latRef, lonRef := []byte("N\x00"), []byte("E\x00")
+	if location.Latitude < 0 {
+		latRef = []byte("S\x00")
+	}
+	if location.Longitude < 0 {
+		lonRef = []byte("W\x00")
+	}
+
+	tiff.WriteString("MM")
+	write(uint16(42))
+	write(uint32(8))
+
+	// IFD0: GPSInfo
+	write(uint16(1))
+	entry(0x8825, typeLong, 1, offset(gpsIFD))
+	write(uint32(0))
+
+	// GPS IFD: version, latitude and longitude
+	write(uint16(5))
+	entry(0x0000, typeByte, 4, []byte{2, 3, 0, 0})
+	entry(0x0001, typeASCII, 2, latRef)
+	entry(0x0002, typeRational, 3, offset(latitude))
+	entry(0x0003, typeASCII, 2, lonRef)
+	entry(0x0004, typeRational, 3, offset(longitude))
+	write(uint32(0))
+
+	for _, value := range []float64{location.Latitude, location.Longitude} {
+		value = math.Abs(value)
+		degrees := math.Floor(value)
+		minutes := math.Floor((value - degrees) * 60)
+		seconds := ((value-degrees)*60 - minutes) * 60
+		write([]uint32{uint32(degrees), 1, uint32(minutes), 1, uint32(math.Round(seconds * 10000)), 10000})
+	}
+
+	var segment bytes.Buffer
+	segment.Write([]byte{0xFF, 0xE1})
+	binary.Write(&segment, order, uint16(2+6+tiff.Len()))
+	segment.WriteString("Exif\x00\x00")
+	segment.Write(tiff.Bytes())
+	return segment.Bytes()
+}
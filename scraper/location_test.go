@@ -0,0 +1,196 @@
+package vsco
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withJFIF puts a JFIF APP0 segment after the start of image, like most cameras and editors write
+func withJFIF(data []byte) []byte {
+	app0 := []byte{0xFF, 0xE0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0}
+	return append(append(append([]byte(nil), data[:2]...), app0...), data[2:]...)
+}
+
+// readGPS reads the coordinates back out of the EXIF of a JPEG, failing the test if they aren't there
+func readGPS(t *testing.T, data []byte) (latitude float64, longitude float64) {
+	t.Helper()
+
+	start := bytes.Index(data, []byte("Exif\x00\x00"))
+	if start < 4 || data[start-4] != 0xFF || data[start-3] != 0xE1 {
+		t.Fatal("No EXIF segment")
+	}
+	length := int(binary.BigEndian.Uint16(data[start-2:]))
+	tiff := data[start+6 : start-2+length]
+	if string(tiff[:2]) != "MM" {
+		t.Fatalf("TIFF data starts with %q", tiff[:2])
+	}
+	order := binary.BigEndian
+
+	// Each IFD entry is tag, type, count, then the value or where it is
+	entries := func(offset uint32) map[uint16][]byte {
+		found := make(map[uint16][]byte)
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			entry := tiff[int(offset)+2+12*i:]
+			found[order.Uint16(entry)] = entry[8:12]
+		}
+		return found
+	}
+	coordinate := func(offset uint32, ref byte, negative byte) float64 {
+		var parts [3]float64
+		for i := range parts {
+			parts[i] = float64(order.Uint32(tiff[offset+8*uint32(i):])) / float64(order.Uint32(tiff[offset+8*uint32(i)+4:]))
+		}
+		value := parts[0] + parts[1]/60 + parts[2]/3600
+		if ref == negative {
+			value = -value
+		}
+		return value
+	}
+
+	ifd0 := entries(order.Uint32(tiff[4:]))
+	gpsOffset, ok := ifd0[0x8825]
+	if !ok {
+		t.Fatal("No GPS IFD")
+	}
+	gps := entries(order.Uint32(gpsOffset))
+	if !bytes.Equal(gps[0x0000], []byte{2, 3, 0, 0}) {
+		t.Errorf("Got GPS version %v", gps[0x0000])
+	}
+
+	latitude = coordinate(order.Uint32(gps[0x0002]), gps[0x0001][0], 'S')
+	longitude = coordinate(order.Uint32(gps[0x0004]), gps[0x0003][0], 'W')
+	return latitude, longitude
+}
+
+func TestEmbedLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		location Location
+	}{
+		{"north west", testJPEG(t), Location{Latitude: 37.7749, Longitude: -122.4194}},
+		{"south east", testJPEG(t), Location{Latitude: -33.856784, Longitude: 151.215297}},
+		{"after JFIF", withJFIF(testJPEG(t)), Location{Latitude: 51.5, Longitude: -0.1276}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imagePath := filepath.Join(t.TempDir(), "vsco123.jpg")
+			if err := os.WriteFile(imagePath, test.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := embedLocation(imagePath, &test.location, 0640); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(imagePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			latitude, longitude := readGPS(t, data)
+			// Seconds are kept to 4 decimals
+			if math.Abs(latitude-test.location.Latitude) > 1e-7 || math.Abs(longitude-test.location.Longitude) > 1e-7 {
+				t.Errorf("Got %f, %f, want %f, %f", latitude, longitude, test.location.Latitude, test.location.Longitude)
+			}
+
+			// The EXIF goes after the JFIF header, and the rest of the image is untouched
+			insertAt, _ := exifInsertOffset(test.data)
+			if !bytes.Equal(data[:insertAt], test.data[:insertAt]) || !bytes.HasSuffix(data, test.data[insertAt:]) {
+				t.Error("The image around the EXIF changed")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("The image doesn't decode anymore: %v", err)
+			}
+
+			if info, err := os.Stat(imagePath); err == nil && runtime.GOOS != "windows" && info.Mode().Perm() != 0640 {
+				t.Errorf("Got mode %v, want 0640", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestEmbedLocationLeavesAlone(t *testing.T) {
+	withExif := testJPEG(t)
+	withExif = append(append(append([]byte(nil), withExif[:2]...), gpsExifSegment(&Location{Latitude: 1, Longitude: 2})...), withExif[2:]...)
+
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewGray(image.Rect(0, 0, 4, 4)))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"has EXIF", withExif},
+		{"PNG", pngData.Bytes()},
+		{"broken JPEG", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x10, 0x00}},
+	}
+
+	for _, test := range tests {
+		imagePath := filepath.Join(t.TempDir(), "vsco123.jpg")
+		if err := os.WriteFile(imagePath, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := embedLocation(imagePath, &Location{Latitude: 10, Longitude: 20}, 0644); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if data, _ := os.ReadFile(imagePath); !bytes.Equal(data, test.data) {
+			t.Errorf("%s: the file was changed", test.name)
+		}
+	}
+}
+
+func TestMediaLocation(t *testing.T) {
+	tests := []struct {
+		coords []float64
+		want   *Location
+	}{
+		// Longitude first
+		{[]float64{-122.4194, 37.7749}, &Location{Latitude: 37.7749, Longitude: -122.4194}},
+		{nil, nil},
+		{[]float64{0, 0}, nil},
+		{[]float64{1}, nil},
+		{[]float64{200, 10}, nil},
+		{[]float64{10, -95}, nil},
+	}
+
+	for _, test := range tests {
+		got := mediaLocation(Media{Location_coords: test.coords})
+		if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Errorf("%v: got %v, want %v", test.coords, got, test.want)
+		}
+	}
+}
+
+func TestXMPCoordinate(t *testing.T) {
+	if got := xmpCoordinate(37.7749, 'N', 'S'); got != "37,46.4940N" {
+		t.Errorf("Got %q", got)
+	}
+	if got := xmpCoordinate(-122.4194, 'E', 'W'); got != "122,25.1640W" {
+		t.Errorf("Got %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// Metadata is what we write to the .json sidecar next to each saved file
+type Metadata struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	Caption     string     `json:"caption,omitempty"`
+	UploadDate  time.Time  `json:"upload_date"`
+	CaptureDate *time.Time `json:"capture_date,omitempty"`
+	Width       int        `json:"width,omitempty"`
+	Height      int        `json:"height,omitempty"`
+	IsVideo     bool       `json:"is_video"`
+	URL         string     `json:"url"`
+	Permalink   string     `json:"permalink,omitempty"`
+	// Only with Options.WriteLocation
+	Location *Location `json:"location,omitempty"`
+	Preset   string    `json:"preset,omitempty"`
+	Camera   *Camera   `json:"camera,omitempty"`
+}
+
+func msToTime(ms int) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(ms))
+}
+
+// optionalTime is t, or nil if it's zero, for fields left out when we don't know them
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (scraper *Scraper) newMetadata(media Media) Metadata {
+	var location *Location
+	if scraper.options.WriteLocation {
+		location = mediaLocation(media)
+	}
+
+	return Metadata{
+		ID:          media.Id,
+		Username:    scraper.username,
+		Caption:     media.Caption,
+		UploadDate:  msToTime(media.Upload_date),
+		CaptureDate: optionalTime(msToTime(media.Capture_date)),
+		Width:       media.Width,
+		Height:      media.Height,
+		IsVideo:     media.Is_video,
+		URL:         fixUrl(getCorrectUrl(media)),
+		Permalink:   media.Permalink,
+		Location:    location,
+		Preset:      presetName(media),
+		Camera:      mediaCamera(media),
+	}
+}
+
+func sidecarPath(mediaPath string) string {
+	return mediaPath + ".json"
+}
+
+func (scraper *Scraper) writeMetadata(media Media, mediaPath string) error {
+	data, err := json.MarshalIndent(scraper.newMetadata(media), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(sidecarPath(mediaPath), data, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write metadata for %s: %w\n", mediaPath, err)
+	}
+
+	if scraper.options.WriteXMP {
+		return scraper.writeXMP(media, mediaPath)
+	}
+
+	return nil
+}
+
+// BackfillMetadata writes sidecars for media that was already downloaded, without downloading it again
+func (scraper *Scraper) BackfillMetadata() error {
+	userPath, err := scraper.userPath()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(userPath); err != nil {
+		return fmt.Errorf("No downloads found for user %s: %w\n", scraper.username, err)
+	}
+
+	// Only the sidecars are written, not what a sync keeps from the listing
+	scraper.listOnly = true
+	imagelist, err := scraper.fetchImageList()
+	scraper.listOnly = false
+	if err != nil {
+		return err
+	}
+
+	written, err := scraper.writeExistingMetadata(imagelist, userPath)
+	if err != nil {
+		return err
+	}
+
+	if scraper.options.DryRun {
+		fmt.Printf("Would write metadata for %d of %d items from %s\n", written, len(imagelist.Media), scraper.username)
+		return nil
+	}
+
+	err = scraper.writeProfile(userPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote metadata for %d of %d items from %s\n", written, len(imagelist.Media), scraper.username)
+
+	return nil
+}
+
+// writeExistingMetadata (re)writes the sidecars of every item in list that has been downloaded. A dry run only
+// counts them.
+func (scraper *Scraper) writeExistingMetadata(list imageList, userPath string) (int, error) {
+	written := 0
+	for _, media := range list.Media {
+		mediaFilename, err := scraper.getMediaFilename(media)
+		if err != nil {
+			return written, err
+		}
+
+		mediaPath := path.Join(userPath, mediaFilename)
+		if _, err := os.Stat(mediaPath); err != nil {
+			continue
+		}
+
+		if !scraper.options.DryRun {
+			err = scraper.writeMetadata(media, mediaPath)
+			if err != nil {
+				return written, err
+			}
+		}
+		written++
+	}
+
+	return written, nil
+}
@@ -0,0 +1,86 @@
+package vsco
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// newestLocal returns when the newest media saved in userPath was uploaded, going by the file times vsco-get sets
+// to the upload date. With Options.NoMtime they can't be trusted, so it's the newest media of the last sync
+// in the sync state. It's zero if nothing is saved yet. The answer is remembered for the rest of the sync.
+func (scraper *Scraper) newestLocal(userPath string) (time.Time, error) {
+	if newest, ok := scraper.localNewest[userPath]; ok {
+		return newest, nil
+	}
+	if scraper.localNewest == nil {
+		scraper.localNewest = make(map[string]time.Time)
+	}
+
+	if scraper.options.NoMtime {
+		state, err := LoadSyncState(userPath)
+		if err != nil || state == nil {
+			return time.Time{}, err
+		}
+		scraper.localNewest[userPath] = state.NewestUpload
+		return state.NewestUpload, nil
+	}
+
+	entries, err := os.ReadDir(userPath)
+	if err != nil && !os.IsNotExist(err) {
+		return time.Time{}, fmt.Errorf("Could not read directory %s: %w\n", userPath, err)
+	}
+
+	var newest time.Time
+	for _, entry := range entries {
+		// Sidecars, posters and thumbnails don't have the upload date, and profile pictures are in subfolders
+		if entry.IsDir() || !isMediaFile(entry.Name()) || isPoster(filepath.Join(userPath, entry.Name())) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+
+	scraper.localNewest[userPath] = newest
+	return newest, nil
+}
+
+// isMediaFile tells whether filename is an image or video by its extension
+func isMediaFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".mp4", ".mov", ".m4v", ".ts":
+		return true
+	}
+	return false
+}
+
+// filterNewerThanLocal applies Options.NewerThanLocal. It also tells whether list got as far back as what's
+// saved, since the pages after it can't have anything newer.
+func (scraper *Scraper) filterNewerThanLocal(list imageList, userPath string) (imageList, bool, error) {
+	if !scraper.options.NewerThanLocal {
+		return list, false, nil
+	}
+
+	newest, err := scraper.newestLocal(userPath)
+	if err != nil || newest.IsZero() {
+		return list, false, err
+	}
+
+	var filtered imageList
+	for _, media := range list.Media {
+		// File times can lose the milliseconds
+		if msToTime(media.Upload_date).Truncate(time.Second).After(newest.Truncate(time.Second)) {
+			filtered.Media = append(filtered.Media, media)
+		}
+	}
+
+	return filtered, len(filtered.Media) < len(list.Media), nil
+}
@@ -0,0 +1,165 @@
+package vsco
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Destination is somewhere downloads are sent instead of being kept, like a tar stream or cloud storage
+type Destination interface {
+	// Store takes the complete file named name (its slash separated path under the download directory).
+	// It may be called from several downloads at once.
+	Store(name string, file *os.File, info fs.FileInfo) error
+	// Close is called once everything has been stored
+	Close() error
+}
+
+// StoredChecker is a Destination that can tell which files it has already, so an item that was sent there
+// on an earlier run isn't downloaded again
+type StoredChecker interface {
+	Stored(name string) (bool, error)
+}
+
+// Offload sends downloads to a Destination instead of keeping them. Each item is downloaded into root as
+// usual, then stored and removed as soon as it's complete, so only the downloads in progress take up space.
+// A nil *Offload keeps everything on disk.
+type Offload struct {
+	root        string
+	destination Destination
+}
+
+func NewOffload(destination Destination, root string) *Offload {
+	return &Offload{root: root, destination: destination}
+}
+
+// stored tells whether the file at filePath under root was sent to the destination before. Destinations
+// that can't tell (a tar stream starts out empty every time) have nothing.
+func (offload *Offload) stored(filePath string) (bool, error) {
+	if offload == nil {
+		return false, nil
+	}
+	checker, ok := offload.destination.(StoredChecker)
+	if !ok {
+		return false, nil
+	}
+
+	name, err := filepath.Rel(offload.root, filePath)
+	if err != nil {
+		return false, err
+	}
+	stored, err := checker.Stored(filepath.ToSlash(name))
+	if err != nil {
+		return false, destinationError(err)
+	}
+	return stored, nil
+}
+
+// addMedia stores the media at mediaPath and everything saved along with it (sidecars, poster, audio,
+// thumbnail), then removes them
+func (offload *Offload) addMedia(mediaPath string) error {
+	if offload == nil {
+		return nil
+	}
+
+	dir := filepath.Dir(mediaPath)
+	stem := strings.TrimSuffix(filepath.Base(mediaPath), filepath.Ext(mediaPath))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && (entry.Name() == stem || strings.HasPrefix(entry.Name(), stem+".")) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if _, err := os.Stat(thumbPath(mediaPath)); err == nil {
+		files = append(files, thumbPath(mediaPath))
+	}
+
+	for _, file := range files {
+		if err := offload.addFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFile stores the file at filePath, named by its path under root, and removes it
+func (offload *Offload) addFile(filePath string) error {
+	name, err := filepath.Rel(offload.root, filePath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = offload.destination.Store(filepath.ToSlash(name), file, info)
+	if err != nil {
+		return destinationError(err)
+	}
+
+	file.Close()
+	return os.Remove(filePath)
+}
+
+// destinationError makes failing to store a file stop the downloads, like a full disk would. There's
+// no point downloading what can't be sent anywhere.
+func destinationError(err error) error {
+	if _, ok := err.(*fs.PathError); ok {
+		return err
+	}
+	return &fs.PathError{Op: "store", Path: "destination", Err: err}
+}
+
+// Flush stores whatever else is left under root, like profile pictures and profile.json
+func (offload *Offload) Flush() error {
+	if offload == nil {
+		return nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(offload.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Could not read directory %s: %w\n", offload.root, err)
+	}
+
+	sort.Strings(files)
+	for _, file := range files {
+		if err := offload.addFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes what's left and closes the destination
+func (offload *Offload) Close() error {
+	if err := offload.Flush(); err != nil {
+		return err
+	}
+	return offload.destination.Close()
+}
@@ -0,0 +1,76 @@
+package vsco
+
+import (
+	"sort"
+)
+
+// Values for Options.Order
+const (
+	// Smallest files first, so an interrupted run has saved as many items as it could
+	OrderSizeAsc = "size-asc"
+	// By upload date, so an interrupted run has saved one unbroken stretch of the profile
+	OrderOldest = "oldest"
+	OrderNewest = "newest"
+)
+
+// ValidOrder tells whether order is something Options.Order understands
+func ValidOrder(order string) bool {
+	switch order {
+	case "", OrderSizeAsc, OrderOldest, OrderNewest:
+		return true
+	}
+	return false
+}
+
+// listsWhole tells whether Options.Order needs the whole profile listed before downloading starts.
+// Newest first is the order the pages come in.
+func (scraper *Scraper) listsWhole() bool {
+	return scraper.options.Order != "" && scraper.options.Order != OrderNewest
+}
+
+// sortByDate puts list in upload date order for OrderOldest and OrderNewest. It happens before the pending
+// media is picked, so Options.MaxItems takes the oldest items when going oldest first.
+func (scraper *Scraper) sortByDate(list imageList) imageList {
+	if scraper.options.Order != OrderOldest && scraper.options.Order != OrderNewest {
+		return list
+	}
+
+	sorted := imageList{Media: append([]Media(nil), list.Media...)}
+	sort.SliceStable(sorted.Media, func(i, j int) bool {
+		if scraper.options.Order == OrderOldest {
+			return sorted.Media[i].Upload_date < sorted.Media[j].Upload_date
+		}
+		return sorted.Media[i].Upload_date > sorted.Media[j].Upload_date
+	})
+	return sorted
+}
+
+// orderMedia sorts the pending media into the order Options.Order asks to download it in, for orders that
+// need to look at more than the listing
+func (scraper *Scraper) orderMedia(list imageList) imageList {
+	switch scraper.options.Order {
+	case OrderSizeAsc:
+		sizes := scraper.mediaSizes(list)
+
+		// Anything we don't know the size of goes last, in the order it came
+		indexes := make([]int, len(list.Media))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			a, b := sizes[indexes[i]], sizes[indexes[j]]
+			if a < 0 || b < 0 {
+				return b < 0 && a >= 0
+			}
+			return a < b
+		})
+
+		var ordered imageList
+		for _, i := range indexes {
+			ordered.Media = append(ordered.Media, list.Media[i])
+		}
+		return ordered
+	}
+
+	return list
+}
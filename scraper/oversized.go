@@ -0,0 +1,79 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// oversizedPath is where the media skipped for Options.MaxFileSize is remembered, by ID with the limit it
+// went over, so it isn't downloaded again just to be thrown away on every run
+func oversizedPath(userPath string) string {
+	return filepath.Join(stateDir(userPath), "oversized.json")
+}
+
+// loadOversized reads what was skipped for being too big in userPath, once per sync. A list that can't be
+// read only costs us downloading those again.
+func (scraper *Scraper) loadOversized(userPath string) map[string]int64 {
+	if scraper.oversized != nil {
+		return scraper.oversized
+	}
+	scraper.oversized = make(map[string]int64)
+
+	data, err := os.ReadFile(oversizedPath(userPath))
+	if err != nil {
+		return scraper.oversized
+	}
+	json.Unmarshal(data, &scraper.oversized)
+	return scraper.oversized
+}
+
+// filterOversized leaves out media that went over Options.MaxFileSize before. Once the limit is raised or
+// taken away it's tried again.
+func (scraper *Scraper) filterOversized(list imageList, userPath string) imageList {
+	limit := scraper.options.MaxFileSize
+	if limit <= 0 {
+		return list
+	}
+
+	oversized := scraper.loadOversized(userPath)
+	if len(oversized) == 0 {
+		return list
+	}
+
+	var filtered imageList
+	for _, media := range list.Media {
+		if skippedAt, ok := oversized[media.Id]; !ok || skippedAt < limit {
+			filtered.Media = append(filtered.Media, media)
+		}
+	}
+	return filtered
+}
+
+// saveOversized adds what the pool skipped for being too big to the list
+func (scraper *Scraper) saveOversized(pool *downloadPool) error {
+	if len(pool.tooLargeMedia) == 0 {
+		return nil
+	}
+
+	oversized := scraper.loadOversized(pool.userPath)
+	for _, media := range pool.tooLargeMedia {
+		oversized[media.Id] = scraper.options.MaxFileSize
+	}
+
+	data, err := json.MarshalIndent(oversized, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(stateDir(pool.userPath), scraper.options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", stateDir(pool.userPath), err)
+	}
+	err = os.WriteFile(oversizedPath(pool.userPath), data, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", oversizedPath(pool.userPath), err)
+	}
+	return nil
+}
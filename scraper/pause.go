@@ -0,0 +1,60 @@
+package vsco
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// How often a paused run checks whether it may go on
+const pausePoll = time.Second
+
+// Pause holds back new downloads while it's on, so a long run can be quieted for a while without losing its place.
+// It's switched by Toggle (on SIGUSR1) or by a control file existing. Like ByteBudget it's shared by every scraper
+// in the run, and a nil *Pause is never paused.
+type Pause struct {
+	paused atomic.Bool
+	// The run is also paused while this file exists
+	file string
+}
+
+func NewPause(file string) *Pause {
+	return &Pause{file: file}
+}
+
+// Toggle pauses the run if it's going, or resumes it if it was paused by Toggle, and says whether it's paused now
+func (pause *Pause) Toggle() bool {
+	for {
+		old := pause.paused.Load()
+		if pause.paused.CompareAndSwap(old, !old) {
+			return !old
+		}
+	}
+}
+
+func (pause *Pause) Paused() bool {
+	if pause == nil {
+		return false
+	}
+	if pause.paused.Load() {
+		return true
+	}
+	if pause.file != "" {
+		if _, err := os.Stat(pause.file); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// wait returns once the run isn't paused anymore, or ctx is done
+func (pause *Pause) wait(ctx context.Context) {
+	for pause.Paused() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pausePoll):
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package vsco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+	"golang.org/x/sync/errgroup"
+)
+
+// SyncError is returned when some of the media couldn't be downloaded. Everything else was still saved,
+// and running again picks up what's missing.
+type SyncError struct {
+	Username string
+	Failed   []error
+}
+
+func (err *SyncError) Error() string {
+	return fmt.Sprintf("Failed to download %d files from %s\n", len(err.Failed), err.Username)
+}
+
+func (err *SyncError) Unwrap() []error {
+	return err.Failed
+}
+
+// downloadPool runs up to Options.NumWorkers downloads at once. A failed download is logged and skipped,
+// but once the disk is full or read-only the pool stops, since every other download would fail the same way.
+type downloadPool struct {
+	scraper  *Scraper
+	userPath string
+	bar      *mediaProgress
+
+	group   *errgroup.Group
+	ctx     context.Context
+	started time.Time
+	// Sizes up the workers with Options.AutoWorkers
+	scale *AutoScaler
+
+	mu           sync.Mutex
+	downloaded   int
+	failed       []error
+	tooLarge     int
+	quotaReached bool
+	pauseLogged  bool
+
+	// The media behind each error in failed, for the retry queue
+	failedMedia []Media
+	// What was skipped for Options.MaxFileSize, remembered for the next run
+	tooLargeMedia []Media
+	// The retry queue as the run found it
+	retries []retryEntry
+}
+
+func (scraper *Scraper) newDownloadPool(userPath string, bar *mediaProgress) *downloadPool {
+	group, ctx := errgroup.WithContext(context.Background())
+	group.SetLimit(scraper.options.NumWorkers)
+
+	pool := &downloadPool{
+		scraper:  scraper,
+		userPath: userPath,
+		bar:      bar,
+		group:    group,
+		ctx:      ctx,
+		started:  time.Now(),
+		scale:    scraper.options.AutoWorkers,
+	}
+
+	return pool
+}
+
+// add downloads media once a worker is free. It only returns an error once the pool has stopped.
+func (pool *downloadPool) add(media Media) error {
+	if err := pool.ctx.Err(); err != nil {
+		return err
+	}
+
+	if pool.scraper.options.Budget.Exhausted() {
+		if !pool.quotaReached {
+			pool.bar.log(fmt.Sprintf("Download quota reached, stopping. Run again to get the rest of %s.", pool.scraper.username))
+			pool.quotaReached = true
+		}
+		pool.scraper.truncated = true
+		return nil
+	}
+
+	if client.RequestLimitReached() {
+		pool.scraper.requestLimitReached(pool.bar.log)
+		return nil
+	}
+
+	pool.group.Go(func() error {
+		pool.waitWhilePaused()
+		pool.scraper.sleepBetween(pool.ctx)
+		pool.scale.acquire()
+
+		// Don't start anything new once we're stopping
+		if pool.ctx.Err() != nil {
+			pool.scale.release(false, pool.bar.log)
+			pool.bar.add(1)
+			return nil
+		}
+
+		filename, err := pool.scraper.getMediaFilename(media)
+		if err != nil {
+			filename = media.Id
+		}
+
+		file := pool.bar.startFile(filename)
+		err = pool.scraper.saveMediaToFile(media, pool.userPath, file.update)
+		pool.bar.finishFile(file)
+		pool.scale.release(err != nil && !errors.Is(err, httpclient.ErrTooLarge) && !errors.Is(err, httpclient.ErrRequestLimit), pool.bar.log)
+		if err == nil {
+			pool.scraper.saved(media)
+			pool.mu.Lock()
+			pool.downloaded++
+			pool.mu.Unlock()
+			return nil
+		}
+
+		// Not the download's fault, it's picked up next run
+		if errors.Is(err, httpclient.ErrRequestLimit) {
+			pool.scraper.requestLimitReached(pool.bar.log)
+			return nil
+		}
+
+		// Skipped on purpose, not a failure
+		if errors.Is(err, httpclient.ErrTooLarge) {
+			pool.mu.Lock()
+			pool.tooLarge++
+			pool.tooLargeMedia = append(pool.tooLargeMedia, media)
+			pool.mu.Unlock()
+			return nil
+		}
+
+		// Keeps going and logs if one fails
+		pool.bar.log(err)
+		pool.scraper.options.Failures.add(pool.scraper.username, media.Id, fixUrl(getCorrectUrl(media)), err)
+
+		pool.mu.Lock()
+		pool.failed = append(pool.failed, err)
+		pool.failedMedia = append(pool.failedMedia, media)
+		pool.mu.Unlock()
+
+		if diskUnusable(err) {
+			return err
+		}
+		return nil
+	})
+
+	return nil
+}
+
+// diskUnusable tells whether err means nothing more can be saved, like a full or read-only disk, so every
+// other download would fail the same way. A file that couldn't be written for its own reasons is only that
+// item failing.
+func diskUnusable(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.EDQUOT)
+}
+
+// waitWhilePaused holds back a download until the run is resumed. Downloads that already started finish.
+func (pool *downloadPool) waitWhilePaused() {
+	pause := pool.scraper.options.Pause
+	if !pause.Paused() {
+		return
+	}
+
+	pool.mu.Lock()
+	if !pool.pauseLogged {
+		pool.bar.log("Paused, waiting to be resumed...")
+		pool.pauseLogged = true
+	}
+	pool.mu.Unlock()
+
+	pause.wait(pool.ctx)
+
+	pool.mu.Lock()
+	if pool.pauseLogged {
+		pool.bar.log("Resuming")
+		pool.pauseLogged = false
+	}
+	pool.mu.Unlock()
+}
+
+// wait waits for the running downloads, and returns the error that stopped the pool or a SyncError listing every failed download
+func (pool *downloadPool) wait() error {
+	err := pool.group.Wait()
+	pool.bar.close()
+	if err != nil {
+		return err
+	}
+
+	if len(pool.failed) > 0 {
+		return &SyncError{Username: pool.scraper.username, Failed: pool.failed}
+	}
+
+	return nil
+}
+
+// printSummary says how a sync went, once its pool is done, and records its stats
+func (scraper *Scraper) printSummary(pool *downloadPool) {
+	stats := UserStats{
+		Username: scraper.username,
+		Items:    pool.downloaded,
+		Bytes:    scraper.written.Load(),
+		Failures: len(pool.failed),
+		Duration: time.Since(pool.started),
+		Finished: time.Now(),
+	}
+	scraper.options.Stats.add(stats)
+
+	summary := fmt.Sprintf("%s: downloaded %d new files", scraper.username, pool.downloaded)
+	if stats.Bytes > 0 {
+		summary += fmt.Sprintf(" (%s in %s, %s/s)", formatBytes(stats.Bytes), stats.Duration.Round(time.Second), formatBytes(int64(stats.Speed())))
+	}
+	if len(pool.failed) > 0 {
+		summary += fmt.Sprintf(", %d failed", len(pool.failed))
+	}
+	if pool.tooLarge > 0 {
+		summary += fmt.Sprintf(", skipped %d over the size limit", pool.tooLarge)
+	}
+	if scraper.unknownCount > 0 {
+		summary += fmt.Sprintf(", skipped %d of a type we don't know how to download", scraper.unknownCount)
+	}
+	fmt.Println(summary)
+}
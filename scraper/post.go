@@ -0,0 +1,90 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+)
+
+// ParseMediaURL pulls the username and media ID out of a post URL like https://vsco.co/<user>/media/<id>
+func ParseMediaURL(rawURL string) (username string, id string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !isVSCOHost(u.Hostname()) {
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 || parts[1] != "media" {
+		return "", "", false
+	}
+
+	return parts[0], parts[2], true
+}
+
+// isVSCOHost tells whether host is vsco.co or one of its subdomains, and not just a name ending in it
+func isVSCOHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "vsco.co" || strings.HasSuffix(host, ".vsco.co")
+}
+
+func (scraper *Scraper) fetchMedia(id string) (Media, error) {
+	resp, err := client.Get(fmt.Sprintf("%s/medias/%s", apiURL, url.PathEscape(id)))
+	if err != nil {
+		return Media{}, fmt.Errorf("Failed to get media %s: %w\n", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Media{}, fmt.Errorf("Failed to get media %s: %w\n", id, httpclient.NewStatusError(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Media{}, fmt.Errorf("Failed to get media %s: %w\n", id, err)
+	}
+
+	var body struct {
+		Media Media `json:"media"`
+	}
+	err = json.Unmarshal(data, &body)
+	if err != nil {
+		return Media{}, fmt.Errorf("Failed to decode JSON response for media %s: %w\n", id, err)
+	}
+
+	if err := scraper.saveAPIResponse(fmt.Sprintf("media-%s.json", id), data); err != nil {
+		return Media{}, err
+	}
+
+	return body.Media, nil
+}
+
+// SaveMediaByID downloads a single post, along with its metadata sidecar
+func (scraper *Scraper) SaveMediaByID(id string) error {
+	media, err := scraper.fetchMedia(id)
+	if err != nil {
+		return err
+	}
+
+	if scraper.options.GetURLs {
+		fmt.Println(fixUrl(getCorrectUrl(media)))
+		return nil
+	}
+
+	if scraper.options.DryRun {
+		return scraper.printDryRun(imageList{Media: []Media{media}})
+	}
+
+	userPath, err := scraper.createUserDirectory()
+	if err != nil {
+		return err
+	}
+
+	scraper.options.WriteMetadata = true
+
+	return scraper.SaveMediaToFile(media, userPath)
+}
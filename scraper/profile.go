@@ -0,0 +1,232 @@
+package vsco
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// profilePictureURL is the profile image at the given width, or without the size params (so we get the full resolution) for 0
+func (scraper *Scraper) profilePictureURL(width int) (string, error) {
+	u, err := url.Parse(scraper.site.Profile_image)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse profile image URL %s: %w\n", scraper.site.Profile_image, err)
+	}
+
+	// Delete width and height params
+	q := u.Query()
+	q.Del("w")
+	q.Del("h")
+
+	// Profile pictures are square
+	if width > 0 {
+		q.Set("w", strconv.Itoa(width))
+		q.Set("h", strconv.Itoa(width))
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+type profilePicture struct {
+	url      string
+	filename string
+}
+
+// profilePictures lists the original, plus each of Options.ProfilePictureSizes
+func (scraper *Scraper) profilePictures() ([]profilePicture, error) {
+	var pictures []profilePicture
+
+	for _, width := range append([]int{0}, scraper.options.ProfilePictureSizes...) {
+		pictureURL, err := scraper.profilePictureURL(width)
+		if err != nil {
+			return nil, err
+		}
+
+		filename := fmt.Sprintf("%s.jpg", scraper.username)
+		if width > 0 {
+			filename = fmt.Sprintf("%s_%d.jpg", scraper.username, width)
+		}
+
+		pictures = append(pictures, profilePicture{pictureURL, filename})
+	}
+
+	return pictures, nil
+}
+
+func (scraper *Scraper) SaveProfilePicture() error {
+	pictures, err := scraper.profilePictures()
+	if err != nil {
+		return err
+	}
+
+	if scraper.options.GetURLs {
+		for _, picture := range pictures {
+			fmt.Println(picture.url)
+		}
+		return nil
+	}
+
+	if scraper.options.DryRun {
+		for _, picture := range pictures {
+			fmt.Printf("Would download profile picture of %s: %s\n", scraper.username, picture.url)
+		}
+		return nil
+	}
+
+	userPath, err := scraper.createUserDirectory()
+	if err != nil {
+		return err
+	}
+
+	if err := scraper.saveSiteResponse(); err != nil {
+		return err
+	}
+
+	profileFolder := path.Join(userPath, "profile")
+
+	bar := progressbar.Default(int64(len(pictures)), fmt.Sprintf("Downloading profile picture of %s...", scraper.username))
+
+	err = os.MkdirAll(profileFolder, scraper.options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", profileFolder, err)
+	}
+
+	for _, picture := range pictures {
+		picturePath := path.Join(profileFolder, picture.filename)
+		if scraper.options.ProfilePictureHistory {
+			picturePath = latestProfilePictureVersion(picture, profileFolder)
+		}
+
+		switch {
+		case !profilePictureChanged(picture.url, picturePath):
+			err = nil
+		case scraper.options.ProfilePictureHistory:
+			err = scraper.saveProfilePictureVersion(picture, profileFolder)
+		default:
+			var written int64
+			written, err = client.DownloadFile(picture.url, picturePath, scraper.options.FileMode)
+			scraper.options.Budget.Add(written)
+			if errors.Is(err, httpclient.ErrNotModified) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to download profile picture %s: %w\n", picture.url, err)
+		}
+
+		bar.Add(1)
+	}
+
+	return nil
+}
+
+// profilePictureChanged asks with a HEAD request whether the picture at url differs from the copy we have in file.
+// Anything we can't tell for sure counts as changed.
+func profilePictureChanged(url string, file string) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return true
+	}
+
+	resp, err := client.Head(url)
+	if err != nil {
+		return true
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 || resp.ContentLength != info.Size() {
+		return true
+	}
+
+	// Same size, but a newer picture can still happen to be the same size
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && modified.After(info.ModTime()) {
+		return true
+	}
+
+	return false
+}
+
+// latestProfilePictureVersion is the path of the newest version saved by saveProfilePictureVersion, or "" if there is none
+func latestProfilePictureVersion(picture profilePicture, profileFolder string) string {
+	ext := path.Ext(picture.filename)
+	base := strings.TrimSuffix(picture.filename, ext)
+	version := regexp.MustCompile("^" + regexp.QuoteMeta(base) + `_(\d{8})_[0-9a-f]{8}` + regexp.QuoteMeta(ext) + "$")
+
+	entries, err := os.ReadDir(profileFolder)
+	if err != nil {
+		return ""
+	}
+
+	var latest, latestDate string
+	for _, entry := range entries {
+		match := version.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] < latestDate {
+			continue
+		}
+
+		// Same day means we can't tell from the name, go by which one we wrote last
+		if match[1] == latestDate && !newerFile(path.Join(profileFolder, entry.Name()), latest) {
+			continue
+		}
+
+		latest, latestDate = path.Join(profileFolder, entry.Name()), match[1]
+	}
+
+	return latest
+}
+
+func newerFile(a string, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return true
+	}
+	return aInfo.ModTime().After(bInfo.ModTime())
+}
+
+// saveProfilePictureVersion keeps every profile picture the user has had, named like user_20240131_1a2b3c4d.jpg
+// (date first seen and content hash). Nothing is kept if the picture is one we already have.
+func (scraper *Scraper) saveProfilePictureVersion(picture profilePicture, profileFolder string) error {
+	tempPath := path.Join(profileFolder, "."+picture.filename+".part")
+
+	written, err := client.DownloadFile(picture.url, tempPath, scraper.options.FileMode)
+	scraper.options.Budget.Add(written)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	data, err := os.ReadFile(tempPath)
+	if err != nil {
+		return err
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))[:8]
+
+	ext := path.Ext(picture.filename)
+	base := strings.TrimSuffix(picture.filename, ext)
+
+	seen, err := filepath.Glob(path.Join(profileFolder, fmt.Sprintf("%s_*_%s%s", base, hash, ext)))
+	if err == nil && len(seen) > 0 {
+		return os.Remove(tempPath)
+	}
+
+	return os.Rename(tempPath, path.Join(profileFolder, fmt.Sprintf("%s_%s_%s%s", base, time.Now().Format("20060102"), hash, ext)))
+}
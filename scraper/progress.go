@@ -0,0 +1,246 @@
+package vsco
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// How often the multi line display is redrawn at most
+const progressInterval = 100 * time.Millisecond
+
+// mediaProgress shows how many files are done. On a terminal it also shows how much was downloaded, the speed and
+// an ETA, and every file being downloaded gets a line of its own with its byte progress (like docker pull),
+// so a stalled download stands out. The total can grow while downloads are already running.
+type mediaProgress struct {
+	mu sync.Mutex
+
+	// Plain single bar, when stderr isn't a terminal we can redraw
+	bar *progressbar.ProgressBar
+
+	description string
+	done        int
+	max         int
+	files       []*fileProgress
+	started     time.Time
+	// Bytes of the files that are done, the ones in files are added on top
+	finishedBytes int64
+	// Lines drawn last time, to go back up over
+	lines    int
+	lastDraw time.Time
+}
+
+// fileProgress is one file being downloaded
+type fileProgress struct {
+	progress *mediaProgress
+	name     string
+	written  int64
+	total    int64
+}
+
+func newMediaProgress(max int, description string) *mediaProgress {
+	if !term.IsTerminal(int(os.Stderr.Fd())) || !enableANSI() {
+		return &mediaProgress{bar: progressbar.Default(int64(max), description)}
+	}
+
+	progress := &mediaProgress{description: description, max: max, started: time.Now()}
+	progress.draw(true)
+	return progress
+}
+
+func (progress *mediaProgress) add(n int) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	if progress.bar != nil {
+		progress.bar.Add(n)
+		return
+	}
+
+	progress.done += n
+	progress.draw(false)
+}
+
+func (progress *mediaProgress) grow(n int) {
+	if n == 0 {
+		return
+	}
+
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	if progress.bar != nil {
+		progress.bar.ChangeMax64(progress.bar.GetMax64() + int64(n))
+		return
+	}
+
+	progress.max += n
+	progress.draw(false)
+}
+
+// startFile adds a line for a download, update it as the file comes in and hand it to finishFile when it's done
+func (progress *mediaProgress) startFile(name string) *fileProgress {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	file := &fileProgress{progress: progress, name: name, total: -1}
+	if progress.bar == nil {
+		progress.files = append(progress.files, file)
+		progress.draw(false)
+	}
+
+	return file
+}
+
+func (file *fileProgress) update(written int64, total int64) {
+	file.progress.mu.Lock()
+	defer file.progress.mu.Unlock()
+
+	file.written, file.total = written, total
+	file.progress.draw(false)
+}
+
+// finishFile removes the file's line and counts it as done
+func (progress *mediaProgress) finishFile(file *fileProgress) {
+	progress.mu.Lock()
+	for i, f := range progress.files {
+		if f == file {
+			progress.files = append(progress.files[:i], progress.files[i+1:]...)
+			progress.finishedBytes += file.written
+			break
+		}
+	}
+	progress.mu.Unlock()
+
+	progress.add(1)
+}
+
+// log prints v without tearing up the display
+func (progress *mediaProgress) log(v ...any) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	if progress.bar != nil {
+		log.Print(v...)
+		return
+	}
+
+	progress.clear()
+	log.Print(v...)
+	progress.draw(true)
+}
+
+// close leaves only the final count behind
+func (progress *mediaProgress) close() {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	if progress.bar != nil {
+		return
+	}
+
+	progress.files = nil
+	progress.draw(true)
+	progress.lines = 0
+}
+
+// clear moves back up over what was drawn last and erases it
+func (progress *mediaProgress) clear() {
+	if progress.lines > 0 {
+		fmt.Fprintf(os.Stderr, "\x1b[%dA\x1b[J", progress.lines)
+	}
+	progress.lines = 0
+}
+
+// draw redraws the display, at most every progressInterval unless forced. Must be called with mu held.
+func (progress *mediaProgress) draw(force bool) {
+	if !force && time.Since(progress.lastDraw) < progressInterval {
+		return
+	}
+	progress.lastDraw = time.Now()
+
+	width, height, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	lines := []string{fmt.Sprintf("%s %s (%d/%d) %s", progress.description, progressBar(int64(progress.done), int64(progress.max)), progress.done, progress.max, progress.transfer())}
+
+	// Lines that scroll off the screen can't be drawn over anymore
+	shown := progress.files
+	if len(shown) > height-2 {
+		shown = shown[:max(height-3, 0)]
+	}
+	for _, file := range shown {
+		lines = append(lines, file.line())
+	}
+	if hidden := len(progress.files) - len(shown); hidden > 0 {
+		lines = append(lines, fmt.Sprintf("  ... and %d more", hidden))
+	}
+
+	var out strings.Builder
+	if progress.lines > 0 {
+		fmt.Fprintf(&out, "\x1b[%dA", progress.lines)
+	}
+	for _, line := range lines {
+		// A wrapped line would throw off how far up we go next time
+		if runes := []rune(line); len(runes) >= width {
+			line = string(runes[:max(width-1, 0)])
+		}
+		fmt.Fprintf(&out, "\r\x1b[K%s\n", line)
+	}
+	out.WriteString("\x1b[J")
+
+	os.Stderr.WriteString(out.String())
+	progress.lines = len(lines)
+}
+
+// transfer is how much was downloaded, how fast, and when we'll be done at that speed.
+// We don't know the size of files before they start, so the ETA assumes they're the size of the ones so far.
+func (progress *mediaProgress) transfer() string {
+	written := progress.finishedBytes
+	for _, file := range progress.files {
+		written += file.written
+	}
+
+	elapsed := time.Since(progress.started).Seconds()
+	if written == 0 || elapsed <= 0 {
+		return ""
+	}
+	speed := float64(written) / elapsed
+
+	status := fmt.Sprintf("%s, %s/s", formatBytes(written), formatBytes(int64(speed)))
+
+	if progress.done > 0 && progress.done < progress.max {
+		averageSize := float64(progress.finishedBytes) / float64(progress.done)
+		left := averageSize*float64(progress.max-progress.done) - float64(written-progress.finishedBytes)
+		eta := time.Duration(max(left, 0) / speed * float64(time.Second))
+		status += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+
+	return status
+}
+
+func (file *fileProgress) line() string {
+	if file.total < 0 {
+		return fmt.Sprintf("  %-30s %s", file.name, formatBytes(file.written))
+	}
+	return fmt.Sprintf("  %-30s %s %s / %s", file.name, progressBar(file.written, file.total), formatBytes(file.written), formatBytes(file.total))
+}
+
+func progressBar(n int64, total int64) string {
+	const width = 20
+
+	filled := 0
+	if total > 0 {
+		filled = int(min(n, total) * width / total)
+	}
+
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package vsco
+
+// enableANSI makes sure the terminal understands the escape codes the progress display uses
+func enableANSI() bool {
+	return true
+}
@@ -0,0 +1,20 @@
+package vsco
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableANSI makes sure the terminal understands the escape codes the progress display uses.
+// Older consoles don't, and get the plain progress bar.
+func enableANSI() bool {
+	handle := windows.Handle(os.Stderr.Fd())
+
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
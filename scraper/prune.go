@@ -0,0 +1,137 @@
+package vsco
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Files saved with ConflictRename look like "name (1).jpg"
+var renamedSuffix = regexp.MustCompile(` \(\d+\)$`)
+
+// Files vsco-get generates in a user's folder that aren't media
+var generatedFiles = map[string]bool{"index.html": true, "feed.xml": true}
+
+func originalFilename(filename string) string {
+	ext := path.Ext(filename)
+	return renamedSuffix.ReplaceAllString(strings.TrimSuffix(filename, ext), "") + ext
+}
+
+// isSidecar tells whether filename is a JSON or XMP sidecar rather than media
+func isSidecar(filename string) bool {
+	return strings.HasSuffix(filename, ".json") || path.Ext(filename) == ".xmp"
+}
+
+// addRemoteFiles adds the filenames the media in list is saved under to remote, which is all pruning needs to know.
+// Files saved next to videos (poster, audio) count as part of the video. The name without a caption is added
+// too, since media saved under another caption is still on the profile (see renameCaptioned).
+func (scraper *Scraper) addRemoteFiles(remote map[string]bool, list imageList) error {
+	for _, media := range list.Media {
+		mediaFilename, err := scraper.getMediaFilename(media)
+		if err != nil {
+			return err
+		}
+		plain, err := scraper.plainMediaFilename(media)
+		if err != nil {
+			return err
+		}
+
+		for _, filename := range []string{mediaFilename, plain} {
+			remote[filename] = true
+			if media.Is_video {
+				remote[posterPath(filename)] = true
+				remote[audioPath(filename)] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// staleFiles lists the files in userPath that aren't among the remote filenames anymore
+func (scraper *Scraper) staleFiles(remote map[string]bool, userPath string) ([]string, error) {
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read directory %s: %w\n", userPath, err)
+	}
+
+	var stale []string
+	for _, entry := range entries {
+		name := entry.Name()
+		// Subfolders (profile pictures etc.) and sidecars aren't media, sidecars go with their media below
+		if entry.IsDir() || isSidecar(name) || generatedFiles[name] {
+			continue
+		}
+
+		if !remote[name] && !remote[originalFilename(name)] && !remote[withoutCaptionSlug(originalFilename(name))] {
+			stale = append(stale, name)
+		}
+	}
+
+	return stale, nil
+}
+
+// pruneMedia removes (or moves to trash/) local media that was deleted from the profile
+func (scraper *Scraper) pruneMedia(remote map[string]bool, userPath string) error {
+	// An empty list is far more likely to be an API problem than a profile with everything deleted
+	if len(remote) == 0 {
+		log.Printf("Got no media for %s, not pruning anything", scraper.username)
+		return nil
+	}
+
+	stale, err := scraper.staleFiles(remote, userPath)
+	if err != nil {
+		return err
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if scraper.options.DryRun {
+		for _, filename := range stale {
+			fmt.Printf("Would remove %s\n", filename)
+		}
+		return nil
+	}
+
+	trashPath := path.Join(userPath, "trash")
+	if scraper.options.PruneToTrash {
+		err = os.MkdirAll(trashPath, scraper.options.DirMode)
+		if err != nil {
+			return fmt.Errorf("Could not create directory %s: %w\n", trashPath, err)
+		}
+	}
+
+	for _, filename := range stale {
+		for _, name := range []string{filename, sidecarPath(filename), xmpPath(filename)} {
+			filePath := path.Join(userPath, name)
+			if _, err := os.Stat(filePath); err != nil {
+				continue
+			}
+
+			if scraper.options.PruneToTrash {
+				err = os.Rename(filePath, path.Join(trashPath, name))
+			} else {
+				err = os.Remove(filePath)
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to prune %s: %w\n", filePath, err)
+			}
+		}
+
+		// Thumbnails can always be made again, no need to keep them in the trash
+		os.Remove(thumbPath(path.Join(userPath, filename)))
+	}
+
+	action := "Removed"
+	if scraper.options.PruneToTrash {
+		action = "Moved to trash"
+	}
+	fmt.Printf("%s %d items deleted from %s's profile:\n\t%s\n", action, len(stale), scraper.username, strings.Join(stale, "\n\t"))
+
+	return nil
+}
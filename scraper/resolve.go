@@ -0,0 +1,49 @@
+package vsco
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+)
+
+// How many times looking up a user from a -l list is tried, and how long to wait before trying again.
+// The wait doubles after each failure.
+const (
+	resolveAttempts = 4
+	resolveBackoff  = 2 * time.Second
+)
+
+// resolveUser is GetUserInfo, trying again with growing waits in between when it fails in a way that can go
+// away by itself, like a rate limit or a dropped connection
+func (scraper *Scraper) resolveUser() error {
+	wait := resolveBackoff
+	for attempt := 1; ; attempt++ {
+		err := scraper.GetUserInfo()
+		if err == nil || attempt == resolveAttempts || !temporaryError(err) {
+			return err
+		}
+
+		log.Printf("Failed to look up %s (%s), trying again in %s", scraper.username, strings.TrimSpace(err.Error()), wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// temporaryError tells whether the request that failed with err may work if made again
+func temporaryError(err error) bool {
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidUsername) || errors.Is(err, httpclient.ErrRequestLimit) {
+		return false
+	}
+
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= 500
+	}
+
+	// Network errors, and responses cut off halfway
+	return true
+}
@@ -0,0 +1,170 @@
+package vsco
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Runs in a row a download can fail before it's dropped from the retry queue, so media that is gone for good
+// isn't tried forever
+const maxRetryAttempts = 5
+
+// retryEntry is a download that failed, waiting in the retry queue for the next run
+type retryEntry struct {
+	Media    Media  `json:"media"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+}
+
+// stateDir is where vsco-get keeps what it remembers about a folder between runs. Being a dot-dir, pruning,
+// the gallery and duplicates all leave it alone.
+func stateDir(userPath string) string {
+	return filepath.Join(userPath, ".vsco-get")
+}
+
+func retryQueuePath(userPath string) string {
+	return filepath.Join(stateDir(userPath), "retry.json")
+}
+
+func loadRetryQueue(userPath string) ([]retryEntry, error) {
+	queuePath := retryQueuePath(userPath)
+	data, err := os.ReadFile(queuePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read retry queue %s: %w\n", queuePath, err)
+	}
+
+	var queue []retryEntry
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return nil, fmt.Errorf("Failed to read retry queue %s: %w\n", queuePath, err)
+	}
+	return queue, nil
+}
+
+// queueRetries adds what failed last time to the pool ahead of everything else. It's left out of the pages
+// that come after, so nothing is downloaded twice. A queue that can't be read only costs us the retries,
+// the listing still finds anything that's missing.
+func (scraper *Scraper) queueRetries(pool *downloadPool) {
+	scraper.retried = nil
+
+	queue, err := loadRetryQueue(pool.userPath)
+	if err != nil {
+		pool.bar.log(err)
+		return
+	}
+	pool.retries = queue
+	if len(queue) == 0 {
+		return
+	}
+
+	var list imageList
+	for _, entry := range queue {
+		list.Media = append(list.Media, entry.Media)
+	}
+	pending, err := scraper.pendingMedia(list, pool.userPath)
+	if err != nil {
+		pool.bar.log(err)
+		return
+	}
+
+	scraper.retried = make(map[string]bool)
+	for _, media := range pending.Media {
+		scraper.retried[media.Id] = true
+	}
+
+	if len(pending.Media) > 0 {
+		pool.bar.log(fmt.Sprintf("Retrying %d files that failed last time", len(pending.Media)))
+	}
+	pool.bar.grow(len(pending.Media))
+	for _, media := range pending.Media {
+		// If the pool stopped, the listing finds out too
+		if pool.add(media) != nil {
+			return
+		}
+	}
+}
+
+// skipRetried leaves out the media queueRetries already added
+func (scraper *Scraper) skipRetried(list imageList) imageList {
+	if len(scraper.retried) == 0 {
+		return list
+	}
+
+	var filtered imageList
+	for _, media := range list.Media {
+		if !scraper.retried[media.Id] {
+			filtered.Media = append(filtered.Media, media)
+		}
+	}
+	return filtered
+}
+
+// saveRetryQueue writes what failed in this run to the retry queue, along with anything from the last queue
+// that wasn't got to (the run stopped early) and still isn't on disk. It removes the queue once it's empty.
+func (scraper *Scraper) saveRetryQueue(pool *downloadPool) error {
+	previous := make(map[string]retryEntry)
+	for _, entry := range pool.retries {
+		previous[entry.Media.Id] = entry
+	}
+
+	var queue []retryEntry
+	failed := make(map[string]bool)
+	for i, media := range pool.failedMedia {
+		failed[media.Id] = true
+
+		entry := retryEntry{
+			Media:    media,
+			Attempts: previous[media.Id].Attempts + 1,
+			Error:    strings.TrimSpace(pool.failed[i].Error()),
+		}
+		if entry.Attempts >= maxRetryAttempts {
+			fmt.Printf("Giving up on %s after %d failed attempts\n", media.Id, entry.Attempts)
+			continue
+		}
+		queue = append(queue, entry)
+	}
+
+	for _, entry := range pool.retries {
+		if failed[entry.Media.Id] {
+			continue
+		}
+		filename, err := scraper.getMediaFilename(entry.Media)
+		if err != nil {
+			continue
+		}
+		if saved, _ := scraper.mediaSaved(filepath.Join(pool.userPath, filename)); !saved {
+			queue = append(queue, entry)
+		}
+	}
+
+	queuePath := retryQueuePath(pool.userPath)
+	if len(queue) == 0 {
+		err := os.Remove(queuePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Failed to remove %s: %w\n", queuePath, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(stateDir(pool.userPath), scraper.options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", stateDir(pool.userPath), err)
+	}
+	err = os.WriteFile(queuePath, data, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", queuePath, err)
+	}
+
+	return nil
+}
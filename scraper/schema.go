@@ -0,0 +1,148 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// schemaShape maps a media type to the JSON kind of every field seen on it
+type schemaShape map[string]map[string]string
+
+// Fields missing from fewer items than this could just be optional
+const minItemsForRemoval = 20
+
+var schemaMutex sync.Mutex
+
+func jsonKind(raw json.RawMessage) string {
+	switch strings.TrimSpace(string(raw))[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+func mediaType(media Media) string {
+	if media.Is_video {
+		return "video"
+	}
+	return "image"
+}
+
+func (shape schemaShape) observe(mediaType string, raw json.RawMessage) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return
+	}
+
+	if shape[mediaType] == nil {
+		shape[mediaType] = make(map[string]string)
+	}
+
+	for name, value := range fields {
+		kind := jsonKind(value)
+		// null tells us nothing about the type
+		if _, known := shape[mediaType][name]; kind == "null" && known {
+			continue
+		}
+		shape[mediaType][name] = kind
+	}
+}
+
+func schemaPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "vsco-get", "schema.json"), nil
+}
+
+// checkSchemaDrift compares the shapes seen in this run against the last recorded ones and warns about any differences.
+// With write, the new shape is saved so the same change is only reported once, with a copy left in the working directory for
+// bug reports, written with fileMode.
+func checkSchemaDrift(seen schemaShape, counts map[string]int, write bool, fileMode os.FileMode) {
+	schemaMutex.Lock()
+	defer schemaMutex.Unlock()
+
+	fingerprintPath, err := schemaPath()
+	if err != nil {
+		return
+	}
+
+	known := make(schemaShape)
+	data, err := os.ReadFile(fingerprintPath)
+	firstRun := err != nil
+	if !firstRun {
+		json.Unmarshal(data, &known)
+	}
+
+	var changes []string
+	for mediaType, fields := range seen {
+		if known[mediaType] == nil {
+			if !firstRun {
+				changes = append(changes, fmt.Sprintf("new media type %q", mediaType))
+			}
+			known[mediaType] = make(map[string]string)
+		}
+
+		for name, kind := range fields {
+			oldKind, ok := known[mediaType][name]
+			switch {
+			case !ok && !firstRun:
+				changes = append(changes, fmt.Sprintf("%s: new field %q (%s)", mediaType, name, kind))
+			case ok && kind != oldKind && kind != "null" && oldKind != "null":
+				changes = append(changes, fmt.Sprintf("%s: field %q changed from %s to %s", mediaType, name, oldKind, kind))
+			}
+			if !ok || kind != "null" {
+				known[mediaType][name] = kind
+			}
+		}
+
+		if counts[mediaType] < minItemsForRemoval {
+			continue
+		}
+		for name := range known[mediaType] {
+			if _, ok := fields[name]; !ok {
+				changes = append(changes, fmt.Sprintf("%s: field %q is no longer sent", mediaType, name))
+				delete(known[mediaType], name)
+			}
+		}
+	}
+
+	if len(changes) > 0 {
+		sort.Strings(changes)
+		log.Printf("WARNING: The VSCO API response format has changed, media may be saved incompletely. Please check for a vsco-get update.\n\t%s", strings.Join(changes, "\n\t"))
+
+		report, err := json.MarshalIndent(struct {
+			Changes []string    `json:"changes"`
+			Shape   schemaShape `json:"shape"`
+		}{changes, seen}, "", "  ")
+		if err == nil && write && os.WriteFile("vsco-get-schema-report.json", report, fileMode) == nil {
+			log.Print("The new response format was written to vsco-get-schema-report.json, please include it when reporting the issue.")
+		}
+	}
+
+	if !write {
+		return
+	}
+	data, err = json.MarshalIndent(known, "", "  ")
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(fingerprintPath), 0755)
+	os.WriteFile(fingerprintPath, data, 0644)
+}
@@ -1,9 +1,12 @@
 package vsco
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"net/url"
@@ -11,21 +14,49 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/SilverMight/vsco-get/httpclient"
+	"github.com/SilverMight/vsco-get/telemetry"
 
-	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
 )
 
 var client = httpclient.NewClient()
 
-// all we care about is the ID
+// SetClient replaces the HTTP client used for every request the package makes
+func SetClient(c *httpclient.HttpClient) {
+	client = c
+}
+
+// Where API requests go, see SetAPIURL
+var apiURL = "https://vsco.co/api/2.0"
+
+// SetAPIURL points every API request at another server, like the fake one in internal/vscotest
+func SetAPIURL(u string) {
+	apiURL = strings.TrimSuffix(u, "/")
+}
+
+// Site is a user's profile as the API describes it. The counts are only filled in when VSCO sends them. Followers
+// are only a count, VSCO has no endpoint listing who they are.
+type Site struct {
+	ID                 int    `json:"id"`
+	Name               string `json:"name"`
+	Subdomain          string `json:"subdomain"`
+	Description        string `json:"description"`
+	External_link      string `json:"external_link"`
+	External_link_text string `json:"external_link_text"`
+	Profile_image      string `json:"profile_image"`
+	Site_collection_id string `json:"site_collection_id"`
+	Status             string `json:"status"`
+	Followers_count    int    `json:"followers_count"`
+	Following_count    int    `json:"following_count"`
+	Media_count        int    `json:"media_count"`
+}
+
 type sitesResponse struct {
-	Sites []struct {
-		ID            int    `json:"id"`
-		Profile_image string `json:"profile_image"`
-	} `json:"sites"`
+	Sites []Site `json:"sites"`
 }
 
 type imageList struct {
@@ -34,84 +65,445 @@ type imageList struct {
 }
 
 type Media struct {
+	Id             string `json:"_id"`
 	Is_video       bool   `json:"is_video"`
 	Video_url      string `json:"video_url"`
 	Responsive_url string `json:"responsive_url"`
 	Upload_date    int    `json:"upload_date"`
+	Capture_date   int    `json:"capture_date"`
+	Caption        string `json:"caption"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	Permalink      string `json:"permalink"`
+	// The uploader's username
+	Perma_subdomain string `json:"perma_subdomain"`
+	// HLS playlist, for videos without a video_url
+	Playback_url string `json:"playback_url"`
+	// nil when the API doesn't say
+	Has_audio *bool `json:"has_audio"`
+	// Longitude and latitude, for media tagged with a location
+	Location_coords []float64 `json:"location_coords"`
+	// The VSCO preset it was edited with, if any
+	Preset *Preset `json:"preset"`
+	// What the camera wrote into the original, for media that kept it
+	Image_meta *ImageMeta `json:"image_meta"`
+}
+
+// ConflictPolicy decides what happens when a file we want to save already exists
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictRename    ConflictPolicy = "rename"
+)
+
+// Options control how a Scraper saves media
+type Options struct {
+	NumWorkers int
+	// Leave modification times alone instead of setting them to the upload date
+	NoMtime bool
+	// Write a .json sidecar with the caption, dates etc. next to each file
+	WriteMetadata bool
+	// Permissions for created directories and files, both still subject to the umask.
+	// Zero means DefaultDirMode and DefaultFileMode.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	// Defaults to ConflictSkip
+	OnConflict ConflictPolicy
+	// Download everything again even if it already exists, overwriting unless OnConflict is ConflictRename
+	Force bool
+	// Print what would be downloaded instead of downloading it
+	DryRun bool
+	// With DryRun, also add up the download size using HEAD requests
+	EstimateSize bool
+	// Refuse to start downloading when the estimated size won't fit on the disk
+	CheckSpace bool
+	// Only print the direct URL of every item, one per line
+	GetURLs bool
+	// Stop starting new downloads once this is used up, nil for no limit
+	Budget *ByteBudget
+	// Remove local media that was deleted from the profile, or move it to trash/ with PruneToTrash
+	Prune        bool
+	PruneToTrash bool
+	// Make the local folder match the profile exactly: download what's new, prune what's gone
+	// and refresh the metadata of everything else
+	Mirror bool
+	// Only download media with these IDs, nil for everything
+	IDs map[string]bool
+	// Never download media with these IDs
+	ExcludeIDs map[string]bool
+	// Widths to download the profile picture at, besides the original
+	ProfilePictureSizes []int
+	// Keep every version of the profile picture under a dated name instead of overwriting it
+	ProfilePictureHistory bool
+	// Reuse user lookups from the on-disk cache for this long, 0 to always look users up
+	SiteCacheTTL time.Duration
+	// How many users of a list to sync at the same time
+	ParallelUsers int
+	// Put user folders in this directory instead of the working directory
+	OutputDir string
+	// Download at most this many new media per user, newest first. 0 for no limit.
+	MaxItems int
+	// Skip media uploaded before this, zero for everything
+	Since time.Time
+	// Stop with an error on media we don't know how to download, instead of skipping it
+	Strict bool
+	// Save the API's JSON of media we don't know how to download to unknown/<id>.json
+	SaveUnknown bool
+	// Which stream of HLS videos to download: QualityBest, QualityWorst or the tallest up to a height like "720"
+	VideoQuality string
+	// Also save the audio track of new videos as .m4a
+	ExtractAudio bool
+	// Also save the poster frame of new videos as a .jpg with the same name
+	VideoPosters bool
+	// Keep one copy of each distinct file in this directory, and hard link downloads to it
+	LinkStore string
+	// Save a small copy of new images (and videos with a poster) in .thumbs/
+	Thumbnails bool
+	// Write an Atom feed of the newest media to feed.xml in the user's folder after syncing
+	WriteFeed bool
+	// Where to record failed downloads and users, nil to not keep track
+	Failures *FailureLog
+	// Holds back new downloads while it's paused, nil to never pause
+	Pause *Pause
+	// What order to download in, one of the Order constants. Empty keeps the order of the profile, which is newest first.
+	Order string
+	// Where to record how each user's sync went, nil to not keep track
+	Stats *StatsLog
+	// Send downloads somewhere else instead of keeping them in OutputDir, like a tar stream. nil keeps them.
+	Offload *Offload
+	// How many media to ask for per API request, between MinPageSize and PageSize. 0 means PageSize.
+	PageSize int
+	// Stop listing at the first page that's all saved already, taking everything older to be saved too.
+	// Pruning needs the whole profile, so this doesn't go with Prune.
+	FastUpdate bool
+	// Only download media uploaded after the newest media already saved, by its file time (or the sync state
+	// with NoMtime), and stop listing there. Like FastUpdate this doesn't go with Prune.
+	NewerThanLocal bool
+	// Keep every API response as it came in <user>/_api/, next to the media
+	SaveJSON bool
+	// Only write metadata: a sidecar for every item on the profile, a manifest listing them and profile.json.
+	// No media is downloaded.
+	NoDownload bool
+	// Write an .xmp sidecar next to each file for photo managers like Lightroom and digiKam, along with the
+	// .json one with WriteMetadata or by itself
+	WriteXMP bool
+	// Keep the location media is tagged with: in the sidecars, and in the EXIF of downloaded JPEGs.
+	// Off by default, since it can tell where someone lives.
+	WriteLocation bool
+	// Add a short slug of the caption to filenames, like vsco5f1a2b3_sunset-at-the-pier.jpg
+	CaptionFilenames bool
+	// Only download media of these types, by the extension of its URL ("jpg", "mp4"). nil for all of them.
+	IncludeTypes map[string]bool
+	// Skip media narrower or shorter than this many pixels, 0 for no limit
+	MinWidth  int
+	MinHeight int
+	// Skip media bigger than this many bytes, by its Content-Length (or by what came in, when there's none).
+	// 0 for no limit.
+	MaxFileSize int64
+	// Wait a random time between these before each download, in the worker making it. Zero for no wait.
+	SleepMin time.Duration
+	SleepMax time.Duration
+	// Start with a few workers and add more while downloads keep getting faster, nil for always NumWorkers
+	AutoWorkers *AutoScaler
 }
 
 type Scraper struct {
-	username     string
-	numWorkers   int
-	id           int
-	profileImage string
+	username string
+	options  Options
+	site     Site
+	// Where media goes, relative to the working directory. Defaults to the username.
+	folder string
+	// Media from many users goes in one folder, so say whose it is in the filename
+	prefixUploader bool
+	// Search for media with the tag in username instead of for the text
+	tagSearch bool
+	// How much pendingMedia has let through so far, for Options.MaxItems
+	pendingCount int
+	// Media skipped because we couldn't tell how to download it
+	unknownCount int
+	// Media from the retry queue, already downloading ahead of the listing
+	retried map[string]bool
+	// Bytes of media downloaded so far
+	written atomic.Int64
+	// Upload date of the newest media saved before the sync, by folder, for Options.NewerThanLocal
+	localNewest map[string]time.Time
+	// The newest media downloaded or found already saved so far, for the sync state
+	newestMu    sync.Mutex
+	newestSaved Media
+	// Media that went over Options.MaxFileSize on earlier runs, by ID with the limit then
+	oversized map[string]int64
+	// Whether the sync left out media it should have got (Options.MaxItems, the download quota), so the
+	// sync state isn't written
+	truncated bool
+	// Whether running out of requests has been logged
+	limitLogged atomic.Bool
+	// Set while only looking at the profile (ListMedia, Diff, the listing BackfillMetadata does), which leaves
+	// the user's folder and the config alone
+	listOnly bool
+	// The sites response from GetUserInfo, until Options.SaveJSON saves it
+	siteResponse []byte
 }
 
 const (
-	PageSize = 100
+	// The default Options.PageSize, and the most VSCO hands out per page
+	PageSize        = 100
+	MinPageSize     = 1
+	DefaultDirMode  = 0755
+	DefaultFileMode = 0666
+
+	// How many pages past the current one to fetch ahead of time
+	pageLookahead = 2
 )
 
-func NewScraper(username string, numWorkers int) *Scraper {
+// writesFiles says whether anything goes to disk, i.e. this isn't a dry run or only listing
+func (scraper *Scraper) writesFiles() bool {
+	return !scraper.options.DryRun && !scraper.options.GetURLs && !scraper.listOnly
+}
+
+func NewScraper(username string, options Options) *Scraper {
 	return &Scraper{
-		username:   username,
-		numWorkers: numWorkers,
+		username: username,
+		options:  withDefaults(options),
+		folder:   username,
 	}
 }
 
+// withDefaults fills in the options left at their zero value that have another default
+func withDefaults(options Options) Options {
+	if options.DirMode == 0 {
+		options.DirMode = DefaultDirMode
+	}
+	if options.FileMode == 0 {
+		options.FileMode = DefaultFileMode
+	}
+	if options.OnConflict == "" {
+		options.OnConflict = ConflictSkip
+	}
+	if options.PageSize == 0 {
+		options.PageSize = PageSize
+	}
+	if options.Mirror {
+		options.Prune = true
+		options.WriteMetadata = true
+	}
+
+	return options
+}
+
 func (scraper *Scraper) GetUserInfo() error {
-	resp, err := client.Get(fmt.Sprintf("https://vsco.co/api/2.0/sites?subdomain=%s", scraper.username))
+	if err := ValidateUsername(scraper.username); err != nil {
+		return err
+	}
+
+	if scraper.options.SiteCacheTTL > 0 {
+		if site, ok := cachedSiteFor(scraper.username, scraper.options.SiteCacheTTL); ok {
+			scraper.site = site
+			return nil
+		}
+	}
+
+	resp, err := client.Get(fmt.Sprintf("%s/sites?subdomain=%s", apiURL, scraper.username))
 	if err != nil {
 		return fmt.Errorf("Failed getting user info for user %s: %w\n", scraper.username, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("Failed to get user info for user %s: %w\n", scraper.username, ErrUserNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Failed to get user info for user %s: Status %s\n", scraper.username, resp.Status)
+		return fmt.Errorf("Failed to get user info for user %s: %w\n", scraper.username, httpclient.NewStatusError(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Failed getting user info for user %s: %w\n", scraper.username, err)
 	}
 
 	var body sitesResponse
-	err = json.NewDecoder(resp.Body).Decode(&body)
+	err = json.Unmarshal(data, &body)
 	if err != nil {
 		return fmt.Errorf("Failed to decode JSON response for user info %s: %w\n", scraper.username, err)
 	}
 
 	if len(body.Sites) < 1 {
-		return fmt.Errorf("Expected site, got %d", len(body.Sites))
+		return fmt.Errorf("Failed to get user info for user %s: %w\n", scraper.username, ErrUserNotFound)
+	}
+
+	// Saved once something is written, see saveSiteResponse
+	scraper.siteResponse = data
+	scraper.site = body.Sites[0]
+
+	if scraper.options.SiteCacheTTL > 0 {
+		cacheSite(scraper.username, scraper.site)
+	}
+
+	return nil
+}
+
+// Site returns the profile fetched by GetUserInfo
+func (scraper *Scraper) Site() Site {
+	return scraper.site
+}
+
+// writeProfile saves the profile details to profile.json in the user's folder
+func (scraper *Scraper) writeProfile(userPath string) error {
+	data, err := json.MarshalIndent(scraper.site, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	scraper.id = body.Sites[0].ID
-	scraper.profileImage = body.Sites[0].Profile_image
+	profilePath := path.Join(userPath, "profile.json")
+	err = os.WriteFile(profilePath, data, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", profilePath, err)
+	}
 
 	return nil
 }
 
+func (scraper *Scraper) mediaPageUrl(page int) string {
+	return fmt.Sprintf("%s/medias?site_id=%d&size=%d&page=%d", apiURL, scraper.site.ID, scraper.options.PageSize, page)
+}
+
 func (scraper *Scraper) fetchImageList() (imageList, error) {
+	return scraper.fetchPages(scraper.mediaPageUrl)
+}
+
+// fetchPages collects the media from every page of a paginated media endpoint
+func (scraper *Scraper) fetchPages(pageUrl func(page int) string) (imageList, error) {
 	var list imageList
 
+	err := scraper.walkPages(pageUrl, func(page imageList) error {
+		list.Media = append(list.Media, page.Media...)
+		list.Total += page.Total
+		return nil
+	})
+	if err != nil {
+		return imageList{}, err
+	}
+
+	return list, nil
+}
+
+// rawPage is one page of a paginated media endpoint, with the raw items kept around so we can tell when the format changes
+type rawPage struct {
+	Media []json.RawMessage `json:"media"`
+	// Search calls them results
+	Results []json.RawMessage `json:"results"`
+	Total   int               `json:"total"`
+	err     error
+	// The response as it came in, for Options.SaveJSON
+	body []byte
+}
+
+func (scraper *Scraper) fetchPage(pageUrl string, page int) rawPage {
+	resp, err := client.Get(pageUrl)
+	if err != nil {
+		return rawPage{err: fmt.Errorf("Failed to get image list for user %s (page %d): %w\n", scraper.username, page, err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return rawPage{err: fmt.Errorf("Failed to get image list for user %s (page %d): %w\n", scraper.username, page, httpclient.NewStatusError(resp))}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return rawPage{err: fmt.Errorf("Failed to get image list for user %s (page %d): %w\n", scraper.username, page, err)}
+	}
+
+	var curPage rawPage
+	err = json.Unmarshal(data, &curPage)
+	if err != nil {
+		return rawPage{err: fmt.Errorf("Failed to decode JSON imagelist response for user %s: %w\n", scraper.username, err)}
+	}
+
+	curPage.Media = append(curPage.Media, curPage.Results...)
+	curPage.body = data
+
+	return curPage
+}
+
+// walkPages hands every page of a paginated media endpoint to onPage as soon as it comes in, stopping at the first error.
+// Once a page comes back full, the next few are fetched while onPage works, at worst costing a request or two past
+// the last page. Until then pages go one at a time, so a profile that fits on one page takes one request.
+func (scraper *Scraper) walkPages(pageUrl func(page int) string, onPage func(page imageList) error) error {
+	shape := make(schemaShape)
+	counts := make(map[string]int)
+
+	var inFlight []chan rawPage
+	nextPage := 0
+	fetchNext := func() {
+		result := make(chan rawPage, 1)
+		go func(page int) {
+			result <- scraper.fetchPage(pageUrl(page), page)
+		}(nextPage)
+
+		inFlight = append(inFlight, result)
+		nextPage++
+	}
+
 	for page := 0; ; page++ {
-		resp, err := client.Get(fmt.Sprintf("https://vsco.co/api/2.0/medias?site_id=%d&size=%d&page=%d", scraper.id, PageSize, page))
-		if err != nil {
-			return imageList{}, fmt.Errorf("Failed to get image list for user %s (page %d): %w\n", scraper.username, page, err)
+		if len(inFlight) == 0 {
+			fetchNext()
 		}
 
-		var curPage imageList
-		err = json.NewDecoder(resp.Body).Decode(&curPage)
-		resp.Body.Close()
+		curPage := <-inFlight[0]
+		inFlight = inFlight[1:]
 
-		if err != nil {
-			return imageList{}, fmt.Errorf("Failed to decode JSON imagelist response for user %s: %w\n", scraper.username, err)
+		if curPage.err != nil {
+			return curPage.err
+		}
+
+		// More pages to come, most likely
+		if len(curPage.Media) >= scraper.options.PageSize {
+			for len(inFlight) < pageLookahead {
+				fetchNext()
+			}
+		}
+		if err := scraper.saveAPIResponse(apiPageName(pageUrl(page), page), curPage.body); err != nil {
+			return err
+		}
+
+		list := imageList{Total: curPage.Total}
+		for _, raw := range curPage.Media {
+			var media Media
+			err := json.Unmarshal(raw, &media)
+			if err != nil {
+				return fmt.Errorf("Failed to decode JSON imagelist response for user %s: %w\n", scraper.username, err)
+			}
+
+			shape.observe(mediaType(media), raw)
+			counts[mediaType(media)]++
+
+			if getCorrectUrl(media) == "" {
+				if err := scraper.unknownMedia(media, raw); err != nil {
+					return err
+				}
+				continue
+			}
+
+			list.Media = append(list.Media, media)
 		}
 
-		list.Media = append(list.Media, curPage.Media...)
-		list.Total += curPage.Total
+		err := onPage(list)
+		if err != nil {
+			return err
+		}
 
 		// No more new pages
-		if len(curPage.Media) < PageSize {
+		if len(curPage.Media) < scraper.options.PageSize {
 			break
 		}
 	}
 
-	return list, nil
+	// A dry run or a listing only warns, it doesn't write anything
+	checkSchemaDrift(shape, counts, scraper.writesFiles(), scraper.options.FileMode)
+
+	return nil
 }
 
 // vsco returns us links that doesn't have https:// in front of it
@@ -124,12 +516,28 @@ func fixUrl(rawUrl string) (fixedUrl string) {
 
 func getCorrectUrl(media Media) (url string) {
 	if media.Is_video {
+		if media.Video_url == "" {
+			return media.Playback_url
+		}
 		return media.Video_url
 	}
 	return media.Responsive_url
 }
 
-func getMediaFilename(media Media) (string, error) {
+func (scraper *Scraper) getMediaFilename(media Media) (string, error) {
+	filename, err := scraper.plainMediaFilename(media)
+	if err != nil {
+		return "", err
+	}
+
+	if scraper.options.CaptionFilenames {
+		filename = withCaptionSlug(filename, media.Caption)
+	}
+	return filename, nil
+}
+
+// plainMediaFilename is the filename of media without its caption, what Options.CaptionFilenames adds to
+func (scraper *Scraper) plainMediaFilename(media Media) (string, error) {
 	mediaUrl := getCorrectUrl(media)
 
 	parsed, err := url.Parse(mediaUrl)
@@ -137,44 +545,231 @@ func getMediaFilename(media Media) (string, error) {
 		return "", fmt.Errorf("Failed to parse image URL for media %s: %w\n", media.Responsive_url, err)
 	}
 
-	return path.Base(parsed.Path), nil
+	filename := path.Base(parsed.Path)
+	if isHLS(mediaUrl) {
+		filename = hlsFilename(media)
+	}
+
+	if scraper.prefixUploader && media.Perma_subdomain != "" {
+		return media.Perma_subdomain + "_" + filename, nil
+	}
+
+	return filename, nil
 }
 
-func SaveMediaToFile(media Media, folderPath string) error {
+func (scraper *Scraper) SaveMediaToFile(media Media, folderPath string) error {
+	return scraper.saveMediaToFile(media, folderPath, nil)
+}
+
+// saveMediaToFile is SaveMediaToFile, passing progress on to httpclient.DownloadFileProgress
+func (scraper *Scraper) saveMediaToFile(media Media, folderPath string, progress func(written int64, total int64)) error {
 	// Determine if we're saving an image or video
 	mediaUrl := getCorrectUrl(media)
 	mediaUrl = fixUrl(mediaUrl)
 
-	imageFile, err := getMediaFilename(media)
+	imageFile, err := scraper.getMediaFilename(media)
 	if err != nil {
 		return err
 	}
 
 	imagePath := path.Join(folderPath, imageFile)
 
-	err = client.DownloadFile(mediaUrl, imagePath)
-	if err != nil {
+	// To keep both, it's downloaded next to what's there first, to see whether it's just a copy
+	downloadPath := imagePath
+	if scraper.options.OnConflict == ConflictRename {
+		downloadPath = path.Join(folderPath, "."+imageFile+".part")
+		defer os.Remove(downloadPath)
+	}
+
+	// Writing over a file in the store would change every copy of it, so start from a new file
+	if scraper.options.LinkStore != "" && downloadPath == imagePath {
+		os.Remove(imagePath)
+	}
+
+	var written int64
+	if isHLS(mediaUrl) {
+		written, err = scraper.downloadHLS(mediaUrl, downloadPath, progress)
+	} else {
+		written, err = client.DownloadFileMax(mediaUrl, downloadPath, scraper.options.FileMode, scraper.options.MaxFileSize, progress)
+		if err == nil {
+			if err = checkDownload(downloadPath, media); err != nil {
+				os.Remove(downloadPath)
+			}
+		}
+	}
+	scraper.addWritten(written)
+	if err != nil && !errors.Is(err, httpclient.ErrNotModified) {
 		return fmt.Errorf("Failed to download image %s: %w\n", mediaUrl, err)
 	}
 
-	// We care about the modification time
-	imageTime := time.Unix(int64(media.Upload_date)/int64(1000), 0)
-	os.Chtimes(imagePath, imageTime, imageTime)
+	if err == nil && downloadPath != imagePath {
+		imagePath, err = placeRenamed(downloadPath, imagePath, scraper.options.FileMode)
+		if err != nil {
+			return fmt.Errorf("Failed to save %s: %w\n", imagePath, err)
+		}
+	}
 
-	return nil
+	// Before linking, the store should have the file as it's kept
+	if location := mediaLocation(media); scraper.options.WriteLocation && location != nil && !media.Is_video && err == nil {
+		err = embedLocation(imagePath, location, scraper.options.FileMode)
+		if err != nil {
+			return fmt.Errorf("Failed to write location into %s: %w\n", imagePath, err)
+		}
+	}
+
+	// We care about the modification time, if we know when it was uploaded. A file in the store shares its
+	// times with every link to it, so the time is set before linking: the store keeps the time of whoever
+	// saved it first, and a link to it never changes the time of the others.
+	var imageTime time.Time
+	if !scraper.options.NoMtime && media.Upload_date != 0 {
+		imageTime = time.Unix(int64(media.Upload_date)/int64(1000), 0)
+	}
+	if !imageTime.IsZero() && (err == nil || !sharedFile(imagePath)) {
+		setFileTimes(imagePath, imageTime)
+	}
+
+	if scraper.options.LinkStore != "" && err == nil {
+		err = scraper.linkToStore(imagePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	savePoster := scraper.options.VideoPosters && media.Is_video && media.Responsive_url != ""
+	if savePoster {
+		written, err = client.DownloadFile(fixUrl(media.Responsive_url), posterPath(imagePath), scraper.options.FileMode)
+		scraper.addWritten(written)
+		if err != nil && !errors.Is(err, httpclient.ErrNotModified) {
+			return fmt.Errorf("Failed to download poster %s: %w\n", media.Responsive_url, err)
+		}
+	}
+
+	if scraper.options.Thumbnails {
+		// The media is saved, a missing thumbnail is made again by the gallery
+		if thumbErr := writeThumbnail(imagePath, scraper.options); thumbErr != nil {
+			log.Print(thumbErr)
+		}
+	}
+
+	extractAudio := scraper.options.ExtractAudio && media.Is_video && hasAudio(media)
+	if extractAudio {
+		err = scraper.extractAudio(imagePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !imageTime.IsZero() {
+		if savePoster {
+			setFileTimes(posterPath(imagePath), imageTime)
+		}
+		if extractAudio {
+			setFileTimes(audioPath(imagePath), imageTime)
+		}
+	}
+
+	if scraper.options.WriteMetadata {
+		err = scraper.writeMetadata(media, imagePath)
+		if err != nil {
+			return err
+		}
+	} else if scraper.options.WriteXMP {
+		err = scraper.writeXMP(media, imagePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scraper.options.Offload.addMedia(imagePath)
+}
+
+// addWritten counts n downloaded bytes against the budget, towards the workers' speed and in the user's stats
+func (scraper *Scraper) addWritten(n int64) {
+	scraper.options.Budget.Add(n)
+	scraper.options.AutoWorkers.Add(n)
+	scraper.written.Add(n)
 }
 
-func stripExistingMedia(mediaList imageList, userPath string) (imageList, error) {
+// placeRenamed moves the download at partPath to filePath, or to "name (n).ext" for the first n that isn't
+// taken, and returns where it went. If it's the same as one of the files already there, it's dropped and
+// that one is returned instead. Names are taken with O_EXCL, so two downloads never end up in one file.
+func placeRenamed(partPath string, filePath string, mode os.FileMode) (string, error) {
+	ext := path.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext)
+
+	candidate := filePath
+	for n := 1; ; n++ {
+		same, err := sameContents(partPath, candidate)
+		if err == nil && same {
+			return candidate, os.Remove(partPath)
+		}
+
+		if errors.Is(err, fs.ErrNotExist) {
+			file, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+			if err == nil {
+				file.Close()
+				return candidate, os.Rename(partPath, candidate)
+			}
+			// Unless another download took it just now, then it's on to the next one
+			if !errors.Is(err, fs.ErrExist) {
+				return "", err
+			}
+		} else if err != nil {
+			return "", err
+		}
+
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
+
+// sameContents tells whether the files at a and b have the same bytes
+func sameContents(a string, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	aData, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	bData, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aData, bData), nil
+}
+
+func (scraper *Scraper) stripExistingMedia(mediaList imageList, userPath string) (imageList, error) {
 	var strippedList imageList
+	var captioned captionedFiles
 
 	for _, media := range mediaList.Media {
-		mediaFilename, err := getMediaFilename(media)
+		mediaFilename, err := scraper.getMediaFilename(media)
 
 		if err != nil {
 			return imageList{}, err
 		}
 
-		if _, exists := os.Stat(path.Join(userPath, mediaFilename)); exists != nil {
+		saved, err := scraper.mediaSaved(path.Join(userPath, mediaFilename))
+		if err != nil {
+			return imageList{}, err
+		}
+		// Saved under another caption, or with or without one before Options.CaptionFilenames was switched
+		if !saved {
+			saved, err = scraper.renameCaptioned(&captioned, userPath, media, mediaFilename)
+			if err != nil {
+				return imageList{}, err
+			}
+		}
+		if !saved {
 			strippedList.Media = append(strippedList.Media, media)
 		}
 	}
@@ -182,15 +777,34 @@ func stripExistingMedia(mediaList imageList, userPath string) (imageList, error)
 	return strippedList, nil
 }
 
-func createUserDirectory(username string) (string, error) {
+// mediaSaved tells whether the media file at filePath is saved already: on disk, or sent off with Options.Offload
+func (scraper *Scraper) mediaSaved(filePath string) (bool, error) {
+	if _, err := os.Stat(filePath); err == nil {
+		return true, nil
+	}
+	return scraper.options.Offload.stored(filePath)
+}
+
+func (scraper *Scraper) userPath() (string, error) {
+	if path.IsAbs(scraper.options.OutputDir) {
+		return path.Join(scraper.options.OutputDir, scraper.folder), nil
+	}
+
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("Could not get cwd: %w\n", err)
 	}
 
-	userPath := path.Join(cwd, username)
+	return path.Join(cwd, scraper.options.OutputDir, scraper.folder), nil
+}
 
-	err = os.MkdirAll(userPath, 0755)
+func (scraper *Scraper) createUserDirectory() (string, error) {
+	userPath, err := scraper.userPath()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(userPath, scraper.options.DirMode)
 
 	if err != nil {
 		return "", fmt.Errorf("Could not create directory %s: %w\n", userPath, err)
@@ -200,117 +814,421 @@ func createUserDirectory(username string) (string, error) {
 }
 
 func (scraper *Scraper) SaveAllMedia() error {
-	imagelist, err := scraper.fetchImageList()
+	userPath, err := scraper.userPath()
 	if err != nil {
 		return err
 	}
 
-	userPath, err := createUserDirectory(scraper.username)
-	if err != nil {
-		return err
+	if scraper.options.NoDownload && !scraper.options.DryRun && !scraper.options.GetURLs {
+		return scraper.saveCatalog(userPath)
 	}
 
-	// Strip our list so we don't save duplicates
-	imagelist, err = stripExistingMedia(imagelist, userPath)
-	if err != nil {
+	// Some failed downloads don't make the profile any less current
+	scraper.newestSaved = Media{}
+	scraper.truncated = false
+	err = scraper.saveMediaPages(scraper.mediaPageUrl, userPath)
+
+	// Out of requests, what's saved stays saved and the next run picks up the rest
+	stopped := client.RequestLimitReached()
+	if errors.Is(err, httpclient.ErrRequestLimit) {
+		scraper.requestLimitReached(log.Print)
+		err = nil
+	}
+
+	if hiddenProfile(err) {
+		return fmt.Errorf("Failed to list media of user %s: %w\n", scraper.username, ErrUserPrivate)
+	}
+	var syncErr *SyncError
+	if err != nil && !errors.As(err, &syncErr) {
 		return err
 	}
 
-	// Dumb concurrency
-	var sem = make(chan int, scraper.numWorkers)
-	var wg sync.WaitGroup
+	if scraper.options.WriteMetadata && !scraper.options.DryRun && !scraper.options.GetURLs {
+		if err := scraper.writeProfile(userPath); err != nil {
+			return err
+		}
+	}
 
-	bar := progressbar.Default(int64(len(imagelist.Media)), fmt.Sprintf("Downloading images from %s...", scraper.username))
-	for _, media := range imagelist.Media {
-		sem <- 1
-		wg.Add(1)
-		go func(media Media) {
-			defer func() {
-				<-sem
-				wg.Done()
-				bar.Add(1)
-			}()
-
-			err := SaveMediaToFile(media, userPath)
-			// Keeps going and logs if one fails (maybe make threshold of failures)
-			if err != nil {
-				log.Print(err)
-			}
-		}(media)
+	if scraper.options.WriteFeed && !scraper.options.DryRun && !scraper.options.GetURLs {
+		if err := scraper.writeFeed(userPath); err != nil {
+			return err
+		}
 	}
 
-	wg.Wait()
+	if err == nil && !stopped && !scraper.truncated && !scraper.options.DryRun && !scraper.options.GetURLs {
+		err = scraper.saveSyncState(userPath)
+	}
 
-	return nil
+	return err
+}
+
+// requestLimitReached says the run is out of requests, the first time
+func (scraper *Scraper) requestLimitReached(print func(v ...any)) {
+	if !scraper.limitLogged.Swap(true) {
+		print(fmt.Sprintf("Request limit reached, stopping. Run again to get the rest of %s.", scraper.username))
+	}
 }
 
-func GetMediaFromUserlist(list string, numWorkers int, saveProfilePictures bool) error {
-	file, err := os.Open(list)
+// saveMediaPages downloads everything on a paginated media endpoint we don't have yet to userPath.
+// Downloading starts as soon as the first page is in, unless the options need the whole list up front.
+func (scraper *Scraper) saveMediaPages(pageUrl func(page int) string, userPath string) error {
+	if scraper.options.GetURLs || scraper.options.DryRun || scraper.options.CheckSpace || scraper.listsWhole() {
+		imagelist, err := scraper.fetchNewPages(pageUrl, userPath)
+		if err != nil {
+			return err
+		}
+		return scraper.saveMediaList(imagelist, userPath)
+	}
+
+	err := os.MkdirAll(userPath, scraper.options.DirMode)
 	if err != nil {
-		return fmt.Errorf("Failed to open file %s: %w\n", list, err)
+		return fmt.Errorf("Could not create directory %s: %w\n", userPath, err)
 	}
 
-	scanner := bufio.NewScanner(file)
+	// We don't know how much there is until the last page, the bar grows as pages come in
+	bar := newMediaProgress(0, fmt.Sprintf("Downloading images from %s...", scraper.username))
 
-	for scanner.Scan() {
-		scraper := NewScraper(scanner.Text(), numWorkers)
+	pool := scraper.newDownloadPool(userPath, bar)
+	scraper.queueRetries(pool)
 
-		err := scraper.GetUserInfo()
+	// Pages are let go once they're queued, all we keep for pruning is the filenames
+	remote := make(map[string]bool)
+	err = scraper.walkPages(pageUrl, func(page imageList) error {
+		saved, err := scraper.pageSaved(page, userPath)
 		if err != nil {
-			continue
+			return err
+		}
+		if saved {
+			return errCaughtUp
 		}
 
-		// We don't stop for just one error
-		if saveProfilePictures {
-			err = scraper.SaveProfilePicture()
-			if err != nil {
-				log.Print(err)
+		if scraper.options.Prune {
+			if err := scraper.addRemoteFiles(remote, page); err != nil {
+				return err
 			}
-		} else {
-			err = scraper.SaveAllMedia()
-			if err != nil {
-				log.Print(err)
+		}
+
+		newer, reached, err := scraper.filterNewerThanLocal(page, userPath)
+		if err != nil {
+			return err
+		}
+
+		pending, err := scraper.pendingMedia(newer, userPath)
+		if err != nil {
+			return err
+		}
+
+		if err := scraper.refreshMetadata(page, pending, userPath); err != nil {
+			return err
+		}
+
+		bar.grow(len(pending.Media))
+		for _, media := range pending.Media {
+			if err := pool.add(media); err != nil {
+				return err
 			}
 		}
+
+		if reached {
+			return errCaughtUp
+		}
+		return nil
+	})
+	if errors.Is(err, errCaughtUp) {
+		err = nil
 	}
 
-	return nil
+	// If the pool stopped, that's why the paging did too
+	if poolErr := pool.wait(); poolErr != nil {
+		var syncErr *SyncError
+		if err == nil || !errors.As(poolErr, &syncErr) {
+			err = poolErr
+		}
+	}
+	scraper.printSummary(pool)
+	if queueErr := scraper.saveRetryQueue(pool); queueErr != nil {
+		log.Print(queueErr)
+	}
+	if oversizedErr := scraper.saveOversized(pool); oversizedErr != nil {
+		log.Print(oversizedErr)
+	}
+
+	return scraper.finishSync(remote, userPath, err)
 }
 
-func (scraper *Scraper) SaveProfilePicture() error {
-	userPath, err := createUserDirectory(scraper.username)
+// saveMediaList downloads everything in imagelist we don't have yet to userPath
+func (scraper *Scraper) saveMediaList(imagelist imageList, userPath string) error {
+	var err error
+
+	if scraper.options.GetURLs {
+		for _, media := range imagelist.Media {
+			fmt.Println(fixUrl(getCorrectUrl(media)))
+		}
+		return nil
+	}
+
+	// Pruning needs everything that's still on the profile
+	remote := make(map[string]bool)
+	if scraper.options.Prune {
+		err = scraper.addRemoteFiles(remote, imagelist)
+		if err != nil {
+			return err
+		}
+	}
+
+	remoteList := imagelist
+	imagelist, _, err = scraper.filterNewerThanLocal(imagelist, userPath)
+	if err != nil {
+		return err
+	}
+	imagelist, err = scraper.pendingMedia(scraper.sortByDate(imagelist), userPath)
 	if err != nil {
 		return err
 	}
 
-	profileFolder := path.Join(userPath, "profile")
-
-	bar := progressbar.Default(1, fmt.Sprintf("Downloading profile picture of %s...", scraper.username))
+	if scraper.options.DryRun {
+		err = scraper.printDryRun(imagelist)
+		if err != nil || !scraper.options.Prune {
+			return err
+		}
+		if _, err := os.Stat(userPath); err != nil {
+			return nil
+		}
+		return scraper.pruneMedia(remote, userPath)
+	}
 
-	err = os.MkdirAll(profileFolder, 0755)
+	err = os.MkdirAll(userPath, scraper.options.DirMode)
 	if err != nil {
-		return fmt.Errorf("Could not create directory %s: %w\n", profileFolder, err)
+		return fmt.Errorf("Could not create directory %s: %w\n", userPath, err)
+	}
+
+	if scraper.options.CheckSpace {
+		err = scraper.checkFreeSpace(imagelist, userPath)
+		if err != nil {
+			return err
+		}
 	}
 
-	u, err := url.Parse(scraper.profileImage)
+	err = scraper.refreshMetadata(remoteList, imagelist, userPath)
 	if err != nil {
-		return fmt.Errorf("Failed to parse profile image URL %s: %w\n", scraper.profileImage, err)
+		return err
+	}
+
+	imagelist = scraper.orderMedia(imagelist)
+
+	bar := newMediaProgress(len(imagelist.Media), fmt.Sprintf("Downloading images from %s...", scraper.username))
+
+	pool := scraper.newDownloadPool(userPath, bar)
+	scraper.queueRetries(pool)
+	for _, media := range imagelist.Media {
+		if pool.add(media) != nil {
+			break
+		}
+	}
+
+	err = pool.wait()
+	scraper.printSummary(pool)
+	if queueErr := scraper.saveRetryQueue(pool); queueErr != nil {
+		log.Print(queueErr)
+	}
+	if oversizedErr := scraper.saveOversized(pool); oversizedErr != nil {
+		log.Print(oversizedErr)
 	}
 
-	// Delete width and height params
-	q := u.Query()
-	q.Del("w")
-	q.Del("h")
+	return scraper.finishSync(remote, userPath, err)
+}
+
+// pendingMedia is the part of list that should be downloaded, i.e. what the ID filters let through and we don't have yet
+func (scraper *Scraper) pendingMedia(list imageList, userPath string) (imageList, error) {
+	var err error
+
+	list = scraper.filterMedia(list, userPath)
 
-	u.RawQuery = q.Encode()
-	fixedURL := u.String()
+	// Strip our list so we don't save duplicates
+	// Names come from the ID, so a file by the name is this media. Only overwriting takes it again.
+	if scraper.options.OnConflict != ConflictOverwrite && !scraper.options.Force {
+		wanted := list
+		list, err = scraper.stripExistingMedia(list, userPath)
+		if err != nil {
+			return imageList{}, err
+		}
+		scraper.noteSaved(wanted, list)
+	}
+
+	// Lists come newest first, and may come a page at a time
+	if scraper.options.MaxItems > 0 {
+		left := max(scraper.options.MaxItems-scraper.pendingCount, 0)
+		if len(list.Media) > left {
+			list.Media = list.Media[:left]
+			scraper.truncated = true
+		}
+		scraper.pendingCount += len(list.Media)
+	}
 
-	err = client.DownloadFile(fixedURL, path.Join(profileFolder, fmt.Sprintf("%s.jpg", scraper.username)))
+	return list, nil
+}
+
+// noteSaved keeps track of the newest media that's saved, out of wanted, leaving out what's still missing
+func (scraper *Scraper) noteSaved(wanted imageList, missing imageList) {
+	skip := make(map[string]bool, len(missing.Media))
+	for _, media := range missing.Media {
+		skip[media.Id] = true
+	}
+
+	for _, media := range wanted.Media {
+		if !skip[media.Id] {
+			scraper.saved(media)
+		}
+	}
+}
+
+// saved records that media is on disk, for the sync state
+func (scraper *Scraper) saved(media Media) {
+	scraper.newestMu.Lock()
+	defer scraper.newestMu.Unlock()
+
+	if media.Upload_date > scraper.newestSaved.Upload_date {
+		scraper.newestSaved = media
+	}
+}
+
+// filterMedia leaves out what the options say not to download, what's already downloading from the retry
+// queue, and what was too big before
+func (scraper *Scraper) filterMedia(list imageList, userPath string) imageList {
+	list = scraper.filterIDs(list)
+	list = scraper.filterSince(list)
+	list = scraper.filterTypes(list)
+	list = scraper.filterResolution(list)
+	list = scraper.filterOversized(list, userPath)
+	return scraper.skipRetried(list)
+}
+
+// filterSince applies Options.Since
+func (scraper *Scraper) filterSince(list imageList) imageList {
+	if scraper.options.Since.IsZero() {
+		return list
+	}
+
+	var filtered imageList
+	for _, media := range list.Media {
+		if !msToTime(media.Upload_date).Before(scraper.options.Since) {
+			filtered.Media = append(filtered.Media, media)
+		}
+	}
+
+	return filtered
+}
+
+// refreshMetadata rewrites the sidecars of the media in list that is already downloaded when mirroring.
+// Whatever is in pending is about to be downloaded and gets a fresh sidecar anyway.
+func (scraper *Scraper) refreshMetadata(list imageList, pending imageList, userPath string) error {
+	if !scraper.options.Mirror {
+		return nil
+	}
+
+	downloading := make(map[string]bool)
+	for _, media := range pending.Media {
+		downloading[media.Id] = true
+	}
+
+	var existing imageList
+	for _, media := range list.Media {
+		if !downloading[media.Id] {
+			existing.Media = append(existing.Media, media)
+		}
+	}
+
+	_, err := scraper.writeExistingMetadata(existing, userPath)
+	return err
+}
+
+// finishSync prunes userPath down to the remote filenames once the downloads are done, and returns downloadErr.
+// Only a SyncError leaves the sync complete enough to go on, with anything else remote can't be trusted.
+func (scraper *Scraper) finishSync(remote map[string]bool, userPath string, downloadErr error) error {
+	var syncErr *SyncError
+	if downloadErr != nil && !errors.As(downloadErr, &syncErr) {
+		return downloadErr
+	}
+
+	if scraper.options.Prune {
+		err := scraper.pruneMedia(remote, userPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return downloadErr
+}
+
+// GetMediaFromUserlist syncs every user in list, see readUserList for the format
+func GetMediaFromUserlist(list string, options Options, saveProfilePictures bool) error {
+	entries, err := readUserList(list, options, saveProfilePictures)
 	if err != nil {
-		return fmt.Errorf("Failed to download profile picture %s: %w\n", scraper.profileImage, err)
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("No users in %s: %w\n", list, ErrNothingToDo)
+	}
+
+	var users errgroup.Group
+	users.SetLimit(max(options.ParallelUsers, 1))
+
+	var mu sync.Mutex
+	var failed UserErrors
+	report := make(userReport)
+
+	for _, entry := range entries {
+		if options.Budget.Exhausted() {
+			log.Print("Download quota reached, skipping the remaining users.")
+			break
+		}
+		if client.RequestLimitReached() {
+			log.Print("Request limit reached, skipping the remaining users.")
+			break
+		}
+
+		scraper := NewScraper(entry.username, entry.options)
+		saveProfilePicture := entry.profilePicture
+
+		// We don't stop for just one error
+		users.Go(func() error {
+			err := scraper.resolveUser()
+			if err == nil {
+				if saveProfilePicture {
+					err = scraper.SaveProfilePicture()
+				} else {
+					err = scraper.SaveAllMedia()
+				}
+			}
+
+			// The user's turn comes again next run
+			if errors.Is(err, httpclient.ErrRequestLimit) {
+				scraper.requestLimitReached(log.Print)
+				return nil
+			}
+
+			if err != nil {
+				telemetry.Error(err)
+				log.Print(err)
+				options.Failures.AddUserError(scraper.username, err)
+
+				mu.Lock()
+				failed = append(failed, err)
+				report.add(scraper.username, err)
+				mu.Unlock()
+			}
+
+			return nil
+		})
 	}
 
-	bar.Add(1)
+	users.Wait()
 
+	options.Stats.Print()
+	report.print()
+
+	if len(failed) > 0 {
+		return failed
+	}
 	return nil
 }
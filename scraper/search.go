@@ -0,0 +1,51 @@
+package vsco
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// NewSearchScraper finds media through VSCO's image search, or the media with a tag, instead of a profile.
+// Everything is saved to search/<query>, or tag/<tag> for tag searches, with the uploader's username in
+// front of each filename.
+func NewSearchScraper(query string, isTag bool, options Options) *Scraper {
+	scraper := NewScraper(query, options)
+	scraper.prefixUploader = true
+	scraper.tagSearch = isTag
+
+	if isTag {
+		scraper.folder = path.Join("tag", folderName(query))
+	} else {
+		scraper.folder = path.Join("search", folderName(query))
+	}
+
+	return scraper
+}
+
+// folderName makes query a single folder name, so a query like "../x" can't put anything outside the
+// output directory. It doesn't start with a dot either, those are left alone as vsco-get's own.
+func folderName(query string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", "\x00", "").Replace(query)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// SaveSearchResults downloads every result for the search
+func (scraper *Scraper) SaveSearchResults() error {
+	folderPath, err := scraper.userPath()
+	if err != nil {
+		return err
+	}
+
+	return scraper.saveMediaPages(func(page int) string {
+		if scraper.tagSearch {
+			return fmt.Sprintf("%s/tags/%s/medias?page=%d&size=%d", apiURL, url.PathEscape(scraper.username), page, scraper.options.PageSize)
+		}
+		return fmt.Sprintf("%s/search/images?query=%s&page=%d&size=%d", apiURL, url.QueryEscape(scraper.username), page, scraper.options.PageSize)
+	}, folderPath)
+}
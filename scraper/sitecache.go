@@ -0,0 +1,75 @@
+package vsco
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cachedSite struct {
+	Site    Site      `json:"site"`
+	Fetched time.Time `json:"fetched"`
+}
+
+var siteCacheMutex sync.Mutex
+
+func siteCachePath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "vsco-get", "sites.json"), nil
+}
+
+func readSiteCache() map[string]cachedSite {
+	cache := make(map[string]cachedSite)
+
+	cachePath, err := siteCachePath()
+	if err != nil {
+		return cache
+	}
+
+	if data, err := os.ReadFile(cachePath); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+
+	return cache
+}
+
+// cachedSiteFor returns the site we looked up for username less than ttl ago
+func cachedSiteFor(username string, ttl time.Duration) (Site, bool) {
+	siteCacheMutex.Lock()
+	defer siteCacheMutex.Unlock()
+
+	entry, ok := readSiteCache()[strings.ToLower(username)]
+	if !ok || time.Since(entry.Fetched) > ttl {
+		return Site{}, false
+	}
+
+	return entry.Site, true
+}
+
+// cacheSite remembers a lookup. Failing to is no big deal, we just look it up again next time.
+func cacheSite(username string, site Site) {
+	siteCacheMutex.Lock()
+	defer siteCacheMutex.Unlock()
+
+	cachePath, err := siteCachePath()
+	if err != nil {
+		return
+	}
+
+	cache := readSiteCache()
+	cache[strings.ToLower(username)] = cachedSite{site, time.Now()}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+
+	os.MkdirAll(filepath.Dir(cachePath), 0755)
+	os.WriteFile(cachePath, data, 0644)
+}
@@ -0,0 +1,57 @@
+package vsco
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSleepInterval reads the delay range for Options.SleepMin and SleepMax, like "2s-5s", "1-3" (seconds) or just "2s"
+func ParseSleepInterval(interval string) (min time.Duration, max time.Duration, err error) {
+	low, high, isRange := strings.Cut(interval, "-")
+	if !isRange {
+		high = low
+	}
+
+	min, minOK := parseDelay(low)
+	max, maxOK := parseDelay(high)
+	if !minOK || !maxOK || min > max {
+		return 0, 0, fmt.Errorf("Invalid sleep interval %q, expected MIN-MAX like 2s-5s\n", interval)
+	}
+	return min, max, nil
+}
+
+// parseDelay reads a duration that isn't negative, taking a bare number to be seconds
+func parseDelay(delay string) (time.Duration, bool) {
+	delay = strings.TrimSpace(delay)
+	if seconds, err := strconv.ParseFloat(delay, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), seconds >= 0
+	}
+
+	duration, err := time.ParseDuration(delay)
+	return duration, err == nil && duration >= 0
+}
+
+// sleepBetween waits a random time between Options.SleepMin and SleepMax before a download, or until ctx is done
+func (scraper *Scraper) sleepBetween(ctx context.Context) {
+	min, max := scraper.options.SleepMin, scraper.options.SleepMax
+	if max <= 0 {
+		return
+	}
+
+	delay := min
+	if max > min {
+		delay += time.Duration(rand.Int63n(int64(max - min + 1)))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,153 @@
+package vsco
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// The most characters of a caption that go in a filename
+const maxSlugLength = 40
+
+// captionSlug makes caption fit for a filename, like "sunset-at-the-pier" for "Sunset at the pier 🌅".
+// Letters and digits are kept (lowercased), everything between them becomes one dash.
+func captionSlug(caption string) string {
+	var slug strings.Builder
+	length := 0
+	dash := false
+	// Whether it was cut short in the middle of a word
+	truncated := false
+
+	for _, r := range caption {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = slug.Len() > 0
+			continue
+		}
+
+		if length >= maxSlugLength {
+			truncated = !dash && !strings.HasSuffix(slug.String(), "-")
+			break
+		}
+		if dash {
+			slug.WriteByte('-')
+			length++
+			dash = false
+		}
+		slug.WriteRune(unicode.ToLower(r))
+		length++
+	}
+
+	// Don't end in a dash or half a word
+	result := strings.TrimSuffix(slug.String(), "-")
+	if truncated {
+		if cut := strings.LastIndexByte(result, '-'); cut > 0 {
+			result = result[:cut]
+		}
+	}
+	return result
+}
+
+// withCaptionSlug adds the slug of caption to filename, before its extension
+func withCaptionSlug(filename string, caption string) string {
+	slug := captionSlug(caption)
+	if slug == "" {
+		return filename
+	}
+
+	ext := path.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "_" + slug + ext
+}
+
+// captionedFiles lists the files in a user's folder by name, read once the first time it's needed
+type captionedFiles struct {
+	names []string
+	read  bool
+}
+
+// savedAs finds the file media was saved to under a name made from plain, the name it has without a caption:
+// plain itself, or plain with any caption slug. It's empty when there isn't one.
+func (files *captionedFiles) savedAs(userPath string, plain string) string {
+	if !files.read {
+		files.read = true
+		entries, _ := os.ReadDir(userPath)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files.names = append(files.names, entry.Name())
+			}
+		}
+	}
+
+	ext := path.Ext(plain)
+	prefix := strings.TrimSuffix(plain, ext) + "_"
+	for _, name := range files.names {
+		if name == plain {
+			return name
+		}
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		slug := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if slug != "" && captionSlug(slug) == slug {
+			return name
+		}
+	}
+	return ""
+}
+
+// withoutCaptionSlug is filename without the caption slug withCaptionSlug added, or filename if it has none
+func withoutCaptionSlug(filename string) string {
+	ext := path.Ext(filename)
+	stem := strings.TrimSuffix(filename, ext)
+	cut := strings.LastIndexByte(stem, '_')
+	if cut < 0 {
+		return filename
+	}
+
+	slug := stem[cut+1:]
+	if slug == "" || captionSlug(slug) != slug {
+		return filename
+	}
+	return stem[:cut] + ext
+}
+
+// renameCaptioned looks for media saved in userPath under another caption than the one it has now, or from
+// before Options.CaptionFilenames was switched, and renames it (and everything kept alongside it) to
+// filename. It tells whether it found it, so it doesn't have to be downloaded again. When nothing is to be
+// written (a dry run, a diff) it's only looked for.
+func (scraper *Scraper) renameCaptioned(files *captionedFiles, userPath string, media Media, filename string) (bool, error) {
+	plain, err := scraper.plainMediaFilename(media)
+	if err != nil {
+		return false, err
+	}
+
+	existing := files.savedAs(userPath, plain)
+	if existing == "" || existing == filename {
+		return false, nil
+	}
+	if !scraper.writesFiles() {
+		return true, nil
+	}
+
+	oldPath, newPath := path.Join(userPath, existing), path.Join(userPath, filename)
+	renames := [][2]string{
+		{oldPath, newPath},
+		{sidecarPath(oldPath), sidecarPath(newPath)},
+		{xmpPath(oldPath), xmpPath(newPath)},
+		{thumbPath(oldPath), thumbPath(newPath)},
+	}
+	if media.Is_video {
+		renames = append(renames,
+			[2]string{posterPath(oldPath), posterPath(newPath)},
+			[2]string{audioPath(oldPath), audioPath(newPath)})
+	}
+
+	for _, rename := range renames {
+		err := os.Rename(rename[0], rename[1])
+		if err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("Failed to rename %s to %s: %w\n", rename[0], rename[1], err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,118 @@
+package vsco
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SyncState is what .vsco-get/state.json remembers about the last sync of a user that went through without errors
+type SyncState struct {
+	LastSync time.Time `json:"last_sync"`
+	// The newest media saved at the time, empty if there was none
+	NewestID     string    `json:"newest_id,omitempty"`
+	NewestUpload time.Time `json:"newest_upload"`
+}
+
+func statePath(userPath string) string {
+	return filepath.Join(stateDir(userPath), "state.json")
+}
+
+// LoadSyncState reads the state of the user folder at userPath, nil if it was never synced without errors
+func LoadSyncState(userPath string) (*SyncState, error) {
+	data, err := os.ReadFile(statePath(userPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read sync state: %w\n", err)
+	}
+
+	var state SyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Failed to read sync state %s: %w\n", statePath(userPath), err)
+	}
+	return &state, nil
+}
+
+// saveSyncState records a finished sync of userPath, with the newest media that was downloaded or already there
+func (scraper *Scraper) saveSyncState(userPath string) error {
+	state := SyncState{LastSync: time.Now()}
+	if scraper.newestSaved.Id != "" {
+		state.NewestID = scraper.newestSaved.Id
+		state.NewestUpload = msToTime(scraper.newestSaved.Upload_date)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(stateDir(userPath), scraper.options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Failed to save sync state: %w\n", err)
+	}
+	err = os.WriteFile(statePath(userPath), data, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to save sync state: %w\n", err)
+	}
+	return nil
+}
+
+// PrintStatus prints when each user folder in dir was last synced and its newest media, least recently synced first
+func PrintStatus(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Could not read directory %s: %w\n", dir, err)
+	}
+
+	type userStatus struct {
+		name  string
+		state *SyncState
+	}
+
+	var users []userStatus
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		state, err := LoadSyncState(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		users = append(users, userStatus{entry.Name(), state})
+	}
+
+	// Never synced comes first
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].state == nil || users[j].state == nil {
+			return users[i].state == nil && users[j].state != nil
+		}
+		return users[i].state.LastSync.Before(users[j].state.LastSync)
+	})
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "User\tLast sync\tNewest upload\tNewest ID\t")
+	for _, user := range users {
+		if user.state == nil {
+			fmt.Fprintf(table, "%s\tnever\t\t\t\n", user.name)
+			continue
+		}
+
+		newestUpload := "-"
+		if !user.state.NewestUpload.IsZero() {
+			newestUpload = user.state.NewestUpload.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(table, "%s\t%s (%s ago)\t%s\t%s\t\n", user.name, user.state.LastSync.Local().Format(time.DateTime),
+			time.Since(user.state.LastSync).Round(time.Minute), newestUpload, user.state.NewestID)
+	}
+
+	return table.Flush()
+}
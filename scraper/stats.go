@@ -0,0 +1,145 @@
+package vsco
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// UserStats is how one user's sync went
+type UserStats struct {
+	Username string
+	Items    int
+	Bytes    int64
+	Failures int
+	Duration time.Duration
+	Finished time.Time
+}
+
+// Speed is the average download speed in bytes per second
+func (stats UserStats) Speed() float64 {
+	if stats.Duration <= 0 {
+		return 0
+	}
+	return float64(stats.Bytes) / stats.Duration.Seconds()
+}
+
+// StatsLog collects the stats of every user synced in a run. Like ByteBudget it's shared by every scraper
+// in the run, and a nil *StatsLog records nothing.
+type StatsLog struct {
+	mu    sync.Mutex
+	users []UserStats
+}
+
+func NewStatsLog() *StatsLog {
+	return &StatsLog{}
+}
+
+func (statsLog *StatsLog) add(stats UserStats) {
+	if statsLog == nil {
+		return
+	}
+
+	statsLog.mu.Lock()
+	statsLog.users = append(statsLog.users, stats)
+	statsLog.mu.Unlock()
+}
+
+func (statsLog *StatsLog) Users() []UserStats {
+	if statsLog == nil {
+		return nil
+	}
+
+	statsLog.mu.Lock()
+	defer statsLog.mu.Unlock()
+	return append([]UserStats(nil), statsLog.users...)
+}
+
+// Print writes a table of every user's stats, with the totals at the bottom
+func (statsLog *StatsLog) Print() {
+	users := statsLog.Users()
+	if len(users) == 0 {
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "User\tItems\tSize\tFailed\tTime\tSpeed\t")
+
+	// Users synced at once overlap, so the total time is from the first start to the last finish rather
+	// than the sum of them
+	var total UserStats
+	var started time.Time
+	for _, stats := range users {
+		printStats(table, stats.Username, stats)
+
+		total.Items += stats.Items
+		total.Bytes += stats.Bytes
+		total.Failures += stats.Failures
+
+		if start := stats.Finished.Add(-stats.Duration); started.IsZero() || start.Before(started) {
+			started = start
+		}
+		if stats.Finished.After(total.Finished) {
+			total.Finished = stats.Finished
+		}
+	}
+	total.Duration = total.Finished.Sub(started)
+	printStats(table, "Total", total)
+
+	table.Flush()
+}
+
+func printStats(table *tabwriter.Writer, name string, stats UserStats) {
+	fmt.Fprintf(table, "%s\t%d\t%s\t%d\t%s\t%s/s\t\n", name, stats.Items, formatBytes(stats.Bytes), stats.Failures,
+		stats.Duration.Round(time.Second), formatBytes(int64(stats.Speed())))
+}
+
+var statsHeader = []string{"time", "username", "items", "bytes", "failures", "seconds", "bytes_per_second"}
+
+// AppendCSV adds a row for every user to the CSV file at path, writing the header first if the file is new,
+// so runs add up to a history
+func (statsLog *StatsLog) AppendCSV(path string, perm os.FileMode) error {
+	users := statsLog.Users()
+	if len(users) == 0 {
+		return nil
+	}
+
+	_, err := os.Stat(path)
+	newFile := errors.Is(err, os.ErrNotExist)
+
+	if perm == 0 {
+		perm = DefaultFileMode
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w\n", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if newFile {
+		writer.Write(statsHeader)
+	}
+	for _, stats := range users {
+		writer.Write([]string{
+			stats.Finished.Format(time.RFC3339),
+			stats.Username,
+			strconv.Itoa(stats.Items),
+			strconv.FormatInt(stats.Bytes, 10),
+			strconv.Itoa(stats.Failures),
+			strconv.FormatFloat(stats.Duration.Seconds(), 'f', 1, 64),
+			strconv.FormatFloat(stats.Speed(), 'f', 0, 64),
+		})
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package vsco
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// fileHash is the SHA-256 of the file at filePath, in hex
+func fileHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// sharedFile tells whether filePath is hard linked from somewhere else, like Options.LinkStore, so changing
+// its times would change them everywhere
+func sharedFile(filePath string) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+	_, links, _ := fileLinks(info)
+	return links > 1
+}
+
+// storePath is where Options.LinkStore keeps the file with this content, like <store>/ab/abcd...1234.jpg
+func (scraper *Scraper) storePath(hash string, ext string) string {
+	return filepath.Join(scraper.options.LinkStore, hash[:2], hash+ext)
+}
+
+// linkToStore makes the freshly downloaded filePath share its data with every other copy of the same file:
+// if the store has it already, filePath becomes a hard link to it, otherwise it's added to the store.
+func (scraper *Scraper) linkToStore(filePath string) error {
+	hash, err := fileHash(filePath)
+	if err != nil {
+		return fmt.Errorf("Failed to hash %s: %w\n", filePath, err)
+	}
+
+	stored := scraper.storePath(hash, filepath.Ext(filePath))
+	err = os.MkdirAll(filepath.Dir(stored), scraper.options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", filepath.Dir(stored), err)
+	}
+
+	err = os.Link(filePath, stored)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("Failed to link %s into the store (it has to be on the same disk): %w\n", filePath, err)
+	}
+
+	// Someone already saved this file, use their copy
+	storedInfo, err := os.Stat(stored)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(storedInfo, info) {
+		return nil
+	}
+
+	// Link next to it first and rename over it, so filePath is never missing
+	tmpPath := filePath + ".link"
+	os.Remove(tmpPath)
+	err = os.Link(stored, tmpPath)
+	if err != nil {
+		return fmt.Errorf("Failed to link %s to %s: %w\n", filePath, stored, err)
+	}
+	err = os.Rename(tmpPath, filePath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to link %s to %s: %w\n", filePath, stored, err)
+	}
+
+	return nil
+}
+
+// CleanStore removes the files in the link store at dir that nothing links to anymore, because every copy of
+// them was pruned or deleted. Until then they still take their space. With Options.DryRun it only tells
+// what it would remove.
+func CleanStore(dir string, options Options) error {
+	var removed int
+	var freed int64
+
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		_, links, ok := fileLinks(info)
+		if !ok {
+			return fmt.Errorf("Can't tell what links to the files in %s on this system\n", dir)
+		}
+		if links > 1 {
+			return nil
+		}
+
+		if !options.DryRun {
+			if err := os.Remove(filePath); err != nil {
+				return err
+			}
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to clean up the store %s: %w\n", dir, err)
+	}
+
+	if options.DryRun {
+		fmt.Printf("Would remove %d files nothing links to anymore, freeing %s\n", removed, formatBytes(freed))
+		return nil
+	}
+
+	// The hash folders left empty
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	fmt.Printf("Removed %d files nothing links to anymore, freeing %s\n", removed, formatBytes(freed))
+	return nil
+}
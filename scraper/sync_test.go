@@ -0,0 +1,577 @@
+package vsco_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/SilverMight/vsco-get/internal/vscotest"
+	vsco "github.com/SilverMight/vsco-get/scraper"
+)
+
+// Where the media of the sample fixture is on the server
+const sampleMedia = "/aws-us-west-2/a1b2c3/1001/"
+
+// newServer starts a fake VSCO for the test and points the scraper at it. The working directory and the config
+// directory are temporary ones, so nothing the scraper writes ends up in the source tree.
+func newServer(t *testing.T) *vscotest.Server {
+	t.Helper()
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	server := vscotest.NewServer()
+	t.Cleanup(server.Close)
+	t.Cleanup(server.Install())
+	return server
+}
+
+// newScraper looks username up, saving into dir with options
+func newScraper(t *testing.T, username string, dir string, options vsco.Options) *vsco.Scraper {
+	t.Helper()
+
+	options.NumWorkers = 2
+	options.OutputDir = dir
+	scraper := vsco.NewScraper(username, options)
+	if err := scraper.GetUserInfo(); err != nil {
+		t.Fatal(err)
+	}
+	return scraper
+}
+
+func syncUser(t *testing.T, username string, dir string, options vsco.Options) error {
+	t.Helper()
+
+	return newScraper(t, username, dir, options).SaveAllMedia()
+}
+
+// files lists the files under dir, relative to it
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var found []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			relative, _ := filepath.Rel(dir, path)
+			found = append(found, filepath.ToSlash(relative))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	sort.Strings(found)
+	return found
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+func readSidecar(t *testing.T, path string) map[string]any {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sidecar map[string]any
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	return sidecar
+}
+
+var sampleFiles = []string{
+	"sample/vsco64b0a2b3.jpg",
+	"sample/vsco64c0a2b3.jpg",
+	"sample/vsco64d0a2b3.jpg",
+	"sample/vsco64e0a2b3.mp4",
+	"sample/vsco64f1a2b3.jpg",
+}
+
+func TestSync(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+
+	if err := syncUser(t, "sample", dir, vsco.Options{WriteMetadata: true, SaveJSON: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := files(t, dir)
+	for _, file := range sampleFiles {
+		if !contains(saved, file) || !contains(saved, file+".json") {
+			t.Errorf("%s or its sidecar is missing, got %v", file, saved)
+		}
+	}
+	for _, file := range []string{"sample/_api/sites.json", "sample/_api/medias-0000.json"} {
+		if !contains(saved, file) {
+			t.Errorf("%s is missing, got %v", file, saved)
+		}
+	}
+
+	// Files get the upload date as their time
+	info, err := os.Stat(filepath.Join(dir, "sample", "vsco64f1a2b3.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.UnixMilli(1693600000000); !info.ModTime().Equal(want) {
+		t.Errorf("Got mtime %v, want the upload date %v", info.ModTime(), want)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "sample", "vsco64c0a2b3.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, _, err := image.Decode(file); err != nil {
+		t.Errorf("Downloaded image doesn't decode: %v", err)
+	}
+
+	sidecar := readSidecar(t, filepath.Join(dir, "sample", "vsco64f1a2b3.jpg.json"))
+	if sidecar["id"] != "64f1a2b3c4d5e6f708192a01" || sidecar["caption"] != "Golden hour at the pier #sunset" {
+		t.Errorf("Got sidecar %v", sidecar)
+	}
+	if sidecar["preset"] != "A6" {
+		t.Errorf("Got preset %v, want A6", sidecar["preset"])
+	}
+	if camera, _ := sidecar["camera"].(map[string]any); camera["model"] != "X100V" {
+		t.Errorf("Got camera %v", sidecar["camera"])
+	}
+	// Only kept with WriteLocation
+	if _, ok := sidecar["location"]; ok {
+		t.Error("The location was written without asking for it")
+	}
+	// The capture date of the third one is 0, so it's unknown
+	if _, ok := readSidecar(t, filepath.Join(dir, "sample", "vsco64d0a2b3.jpg.json"))["capture_date"]; ok {
+		t.Error("An unknown capture date was written")
+	}
+
+	// A profile that fits on one page takes one request to list
+	if listed := server.Requests("/api/2.0/medias"); listed != 1 {
+		t.Errorf("Listing took %d requests, want 1", listed)
+	}
+
+	// Everything's saved, so syncing again downloads nothing
+	downloaded := server.Requests(sampleMedia)
+	if err := syncUser(t, "sample", dir, vsco.Options{WriteMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	if again := server.Requests(sampleMedia) - downloaded; again != 0 {
+		t.Errorf("Syncing again made %d media requests", again)
+	}
+}
+
+func TestSyncPages(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+	server.AddUser("many", 250)
+
+	if err := syncUser(t, "many", dir, vsco.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if saved := files(t, filepath.Join(dir, "many")); len(saved) < 250 {
+		t.Errorf("Saved %d files, want the 250 media", len(saved))
+	}
+
+	// Three pages, with at most a couple of requests past the last one
+	if listed := server.Requests("/api/2.0/medias"); listed < 3 || listed > 5 {
+		t.Errorf("Listing took %d requests", listed)
+	}
+}
+
+func TestSyncFailedDownload(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+	failing := sampleMedia + "64c0a2b3c4d5e6f708192a04/"
+	server.Fail(failing, http.StatusNotFound, 1)
+
+	err := syncUser(t, "sample", dir, vsco.Options{})
+	var syncErr *vsco.SyncError
+	if !errors.As(err, &syncErr) || len(syncErr.Failed) != 1 {
+		t.Fatalf("Got %v, want one failed download", err)
+	}
+
+	saved := files(t, dir)
+	if contains(saved, "sample/vsco64c0a2b3.jpg") {
+		t.Error("The failed download was saved")
+	}
+	for _, file := range sampleFiles {
+		if file != "sample/vsco64c0a2b3.jpg" && !contains(saved, file) {
+			t.Errorf("%s is missing, one failure shouldn't stop the others", file)
+		}
+	}
+
+	// The next sync picks it up
+	if err := syncUser(t, "sample", dir, vsco.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !contains(files(t, dir), "sample/vsco64c0a2b3.jpg") {
+		t.Error("The failed download wasn't retried")
+	}
+}
+
+func TestSyncDiscardsErrorPages(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+	page := bytes.Repeat([]byte("<!DOCTYPE html><html><body>This content is no longer available</body></html>\n"), 10)
+	server.ServeInstead(sampleMedia+"64b0a2b3c4d5e6f708192a05/", "text/html", page)
+
+	err := syncUser(t, "sample", dir, vsco.Options{})
+	if !errors.Is(err, vsco.ErrBadMedia) {
+		t.Errorf("Got %v, want ErrBadMedia", err)
+	}
+
+	// Nothing of it is left, not even a partial download, and it's queued to try again
+	want := []string{".vsco-get/retry.json", "vsco64c0a2b3.jpg", "vsco64d0a2b3.jpg", "vsco64e0a2b3.mp4", "vsco64f1a2b3.jpg"}
+	if saved := files(t, filepath.Join(dir, "sample")); !reflect.DeepEqual(saved, want) {
+		t.Errorf("Got %v, want %v", saved, want)
+	}
+}
+
+func TestSyncLocation(t *testing.T) {
+	newServer(t)
+	dir := t.TempDir()
+
+	if err := syncUser(t, "sample", dir, vsco.Options{WriteMetadata: true, WriteLocation: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "sample", "vsco64f1a2b3.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("Exif\x00\x00")) {
+		t.Error("The location wasn't written to the EXIF")
+	}
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("The image with EXIF doesn't decode: %v", err)
+	}
+
+	sidecar := readSidecar(t, filepath.Join(dir, "sample", "vsco64f1a2b3.jpg.json"))
+	location, _ := sidecar["location"].(map[string]any)
+	if location["latitude"] != 37.7749 || location["longitude"] != -122.4194 {
+		t.Errorf("Got location %v", sidecar["location"])
+	}
+
+	// Media without a location is left as it came
+	other, err := os.ReadFile(filepath.Join(dir, "sample", "vsco64c0a2b3.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(other, []byte("Exif\x00\x00")) {
+		t.Error("EXIF was added to an image without a location")
+	}
+}
+
+func TestSyncExtractAudio(t *testing.T) {
+	newServer(t)
+	dir := t.TempDir()
+
+	if err := syncUser(t, "sample", dir, vsco.Options{ExtractAudio: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "sample", "vsco64e0a2b3.m4a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 8 || string(data[4:8]) != "ftyp" {
+		t.Error("The .m4a isn't an MP4")
+	}
+	for _, file := range files(t, filepath.Join(dir, "sample")) {
+		if filepath.Ext(file) == ".part" {
+			t.Errorf("Left %s behind", file)
+		}
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+	config := os.Getenv("XDG_CONFIG_HOME")
+
+	if err := syncUser(t, "sample", dir, vsco.Options{DryRun: true, WriteMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved := files(t, dir); len(saved) != 0 {
+		t.Errorf("A dry run wrote %v", saved)
+	}
+	if saved := files(t, config); len(saved) != 0 {
+		t.Errorf("A dry run wrote %v to the config directory", saved)
+	}
+	if downloads := server.Requests(sampleMedia); downloads != 0 {
+		t.Errorf("A dry run made %d media requests", downloads)
+	}
+}
+
+func TestSyncPrune(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+
+	if err := syncUser(t, "sample", dir, vsco.Options{WriteMetadata: true, WriteXMP: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The newest post is deleted from the profile
+	user := server.User("sample")
+	user.Media = user.Media[1:]
+
+	if err := syncUser(t, "sample", dir, vsco.Options{Prune: true, PruneToTrash: true, WriteMetadata: true, WriteXMP: true}); err != nil {
+		t.Fatal(err)
+	}
+	saved := files(t, filepath.Join(dir, "sample"))
+	if contains(saved, "vsco64f1a2b3.jpg") {
+		t.Error("Media deleted from the profile wasn't pruned")
+	}
+	if !contains(saved, "trash/vsco64f1a2b3.jpg") {
+		t.Errorf("Pruned media wasn't moved to trash/, got %v", saved)
+	}
+	if !contains(saved, "vsco64c0a2b3.jpg") {
+		t.Error("Media still on the profile was pruned")
+	}
+
+	// Sidecars go with their media
+	for _, file := range []string{"trash/vsco64f1a2b3.jpg.json", "trash/vsco64f1a2b3.xmp", "vsco64c0a2b3.jpg.json", "vsco64c0a2b3.xmp"} {
+		if !contains(saved, file) {
+			t.Errorf("%s is missing, got %v", file, saved)
+		}
+	}
+}
+
+// unknownMedia is media without an image or video URL, with an ID that tries to get out of the folder
+var unknownMedia = json.RawMessage(`{"_id": "../../../escaped", "caption": "", "is_video": false, "upload_date": 1693700000000, "responsive_url": "", "video_url": "", "playback_url": ""}`)
+
+func TestSyncUnknownMedia(t *testing.T) {
+	server := newServer(t)
+	dir := filepath.Join(t.TempDir(), "archive")
+	user := server.User("sample")
+	user.Media = append([]json.RawMessage{unknownMedia}, user.Media...)
+
+	if err := syncUser(t, "sample", dir, vsco.Options{SaveUnknown: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := files(t, filepath.Dir(dir))
+	if !contains(saved, "archive/sample/unknown/unknown-1.json") {
+		t.Errorf("The unknown media wasn't saved in unknown/, got %v", saved)
+	}
+	for _, file := range saved {
+		if filepath.Base(file) == "escaped.json" {
+			t.Errorf("The unknown media's ID put it at %s", file)
+		}
+	}
+
+	// With Strict it stops the sync instead
+	if err := syncUser(t, "sample", dir, vsco.Options{Strict: true}); err == nil {
+		t.Error("Unknown media didn't stop a strict sync")
+	}
+}
+
+func TestListMedia(t *testing.T) {
+	server := newServer(t)
+	dir := filepath.Join(t.TempDir(), "archive")
+	user := server.User("sample")
+	user.Media = append([]json.RawMessage{unknownMedia}, user.Media...)
+
+	scraper := newScraper(t, "sample", dir, vsco.Options{SaveUnknown: true, SaveJSON: true, WriteMetadata: true})
+	items, err := scraper.ListMedia(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 5 {
+		t.Fatalf("Got %d items, want 5", len(items))
+	}
+	if items[0].ID != "64f1a2b3c4d5e6f708192a01" || items[0].Type != "image" || items[1].Type != "video" {
+		t.Errorf("Got %+v first", items[:2])
+	}
+	for i := 1; i < len(items); i++ {
+		if items[i].UploadDate.After(items[i-1].UploadDate) {
+			t.Error("Items aren't newest first")
+		}
+	}
+
+	// Listing writes nothing, not even what SaveUnknown and SaveJSON would keep
+	if saved := files(t, filepath.Dir(dir)); len(saved) != 0 {
+		t.Errorf("Listing wrote %v", saved)
+	}
+
+	// Picked items download like any other
+	userDir := filepath.Join(dir, "picked")
+	os.MkdirAll(userDir, 0755)
+	if err := scraper.SaveMediaToFile(items[2].Media, userDir); err != nil {
+		t.Fatal(err)
+	}
+	if saved := files(t, userDir); !contains(saved, "vsco64d0a2b3.jpg") {
+		t.Errorf("Got %v", saved)
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	newServer(t)
+	dir := t.TempDir()
+
+	scraper := newScraper(t, "sample", dir, vsco.Options{})
+	if err := scraper.SaveFavorites(); err != nil {
+		t.Fatal(err)
+	}
+	if saved := files(t, filepath.Join(dir, "sample", "favorites")); !contains(saved, "vsco64a0a2b3.jpg") {
+		t.Errorf("Got %v", saved)
+	}
+
+	// Not every user has a collection
+	if err := newScraper(t, "empty", dir, vsco.Options{}).SaveFavorites(); err == nil {
+		t.Error("Saved the favorites of a user without any")
+	}
+}
+
+func TestMissingAndPrivateUsers(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+
+	if err := vsco.NewScraper("nobody", vsco.Options{OutputDir: dir}).GetUserInfo(); err == nil {
+		t.Error("Looked up a user that doesn't exist")
+	}
+
+	server.User("sample").Private = true
+	err := syncUser(t, "sample", dir, vsco.Options{})
+	if !errors.Is(err, vsco.ErrUserPrivate) {
+		t.Errorf("Got %v, want ErrUserPrivate", err)
+	}
+
+	if err := syncUser(t, "empty", dir, vsco.Options{}); err != nil {
+		t.Errorf("Syncing a user without media: %v", err)
+	}
+}
+
+func TestSyncCaptionFilenames(t *testing.T) {
+	server := newServer(t)
+	dir := t.TempDir()
+
+	if err := syncUser(t, "sample", dir, vsco.Options{CaptionFilenames: true, WriteMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	captioned := files(t, filepath.Join(dir, "sample"))
+	if !contains(captioned, "vsco64f1a2b3_golden-hour-at-the-pier-sunset.jpg") {
+		t.Fatalf("Got %v", captioned)
+	}
+
+	// Neither a dry run nor a diff renames anything, and both count the files as saved
+	downloaded := server.Requests(sampleMedia)
+	if err := syncUser(t, "sample", dir, vsco.Options{DryRun: true, Prune: true, WriteMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := newScraper(t, "sample", dir, vsco.Options{}).Diff(); err != nil {
+		t.Fatal(err)
+	}
+	if saved := files(t, filepath.Join(dir, "sample")); !reflect.DeepEqual(saved, captioned) {
+		t.Errorf("Got %v, want %v", saved, captioned)
+	}
+
+	// Syncing without captions renames the files back rather than downloading them again
+	if err := syncUser(t, "sample", dir, vsco.Options{Prune: true, WriteMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	saved := files(t, filepath.Join(dir, "sample"))
+	if !contains(saved, "vsco64f1a2b3.jpg") || !contains(saved, "vsco64f1a2b3.jpg.json") || contains(saved, "vsco64f1a2b3_golden-hour-at-the-pier-sunset.jpg") {
+		t.Errorf("Got %v", saved)
+	}
+	if again := server.Requests(sampleMedia) - downloaded; again != 0 {
+		t.Errorf("Made %d media requests for media that's saved", again)
+	}
+}
+
+func TestBackfillMetadata(t *testing.T) {
+	newServer(t)
+	dir := t.TempDir()
+
+	if err := syncUser(t, "sample", dir, vsco.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The folder is found under OutputDir, not the working directory
+	if err := newScraper(t, "sample", dir, vsco.Options{WriteMetadata: true}).BackfillMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	saved := files(t, dir)
+	for _, file := range sampleFiles {
+		if !contains(saved, file+".json") {
+			t.Errorf("No sidecar for %s, got %v", file, saved)
+		}
+	}
+}
+
+func TestSchemaDrift(t *testing.T) {
+	newServer(t)
+	dir := t.TempDir()
+	fingerprint := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "vsco-get", "schema.json")
+
+	if err := syncUser(t, "sample", dir, vsco.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fingerprint); err != nil {
+		t.Fatalf("No fingerprint was recorded: %v", err)
+	}
+
+	// Against a fingerprint without any media types, everything is new
+	if err := os.WriteFile(fingerprint, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Commands that only look warn, but keep the fingerprint and leave no report
+	if err := newScraper(t, "sample", dir, vsco.Options{}).Diff(); err != nil {
+		t.Fatal(err)
+	}
+	if err := newScraper(t, "sample", dir, vsco.Options{WriteMetadata: true}).BackfillMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(fingerprint); string(data) != "{}" {
+		t.Errorf("The fingerprint was changed to %s", data)
+	}
+	if report, err := os.Stat("vsco-get-schema-report.json"); err == nil {
+		t.Errorf("Left %s", report.Name())
+	}
+
+	if err := syncUser(t, "sample", dir, vsco.Options{FileMode: 0600}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(fingerprint); string(data) == "{}" {
+		t.Error("Syncing didn't record the new fingerprint")
+	}
+	report, err := os.Stat("vsco-get-schema-report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && report.Mode().Perm() != 0600 {
+		t.Errorf("Got mode %v for the report, want 0600", report.Mode().Perm())
+	}
+}
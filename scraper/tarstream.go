@@ -0,0 +1,41 @@
+package vsco
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// tarStream is a Destination writing everything to one tar stream
+type tarStream struct {
+	mu     sync.Mutex
+	writer *tar.Writer
+}
+
+// NewTarStream is a Destination writing everything as a tar stream to w
+func NewTarStream(w io.Writer) Destination {
+	return &tarStream{writer: tar.NewWriter(w)}
+}
+
+func (stream *tarStream) Store(name string, file *os.File, info fs.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if err := stream.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(stream.writer, file)
+	return err
+}
+
+func (stream *tarStream) Close() error {
+	return stream.writer.Close()
+}
@@ -0,0 +1,127 @@
+package vsco
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Longest side of a thumbnail, in pixels
+const thumbnailSize = 400
+
+// thumbPath is where the thumbnail of the media at mediaPath goes: .thumbs/<name>.jpg next to it, keeping the
+// extension of the media so abc.jpg and abc.png don't get the same one
+func thumbPath(mediaPath string) string {
+	return filepath.Join(filepath.Dir(mediaPath), ".thumbs", filepath.Base(mediaPath)+".jpg")
+}
+
+// thumbnailSource is the image to make the thumbnail of mediaPath from: itself, or the poster of a video.
+// It's empty if there's nothing to make one from.
+func thumbnailSource(mediaPath string) string {
+	switch strings.ToLower(filepath.Ext(mediaPath)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return mediaPath
+	case ".mp4", ".mov", ".m4v", ".ts":
+		if _, err := os.Stat(posterPath(mediaPath)); err == nil {
+			return posterPath(mediaPath)
+		}
+	}
+	return ""
+}
+
+// writeThumbnail saves a small copy of the media at mediaPath in .thumbs/, if it's an image or a video with a poster
+func writeThumbnail(mediaPath string, options Options) error {
+	source := thumbnailSource(mediaPath)
+	if source == "" {
+		return nil
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to make a thumbnail of %s: %w\n", source, err)
+	}
+
+	thumbFile := thumbPath(mediaPath)
+	err = os.MkdirAll(filepath.Dir(thumbFile), options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", filepath.Dir(thumbFile), err)
+	}
+
+	out, err := os.OpenFile(thumbFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write thumbnail %s: %w\n", thumbFile, err)
+	}
+	defer out.Close()
+
+	err = jpeg.Encode(out, shrink(img, thumbnailSize), &jpeg.Options{Quality: 80})
+	if err != nil {
+		return fmt.Errorf("Failed to write thumbnail %s: %w\n", thumbFile, err)
+	}
+
+	return nil
+}
+
+// shrink scales img down so its longest side is at most size, averaging the pixels that end up in each new one
+func shrink(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	newWidth, newHeight := size, max(height*size/width, 1)
+	if height > width {
+		newWidth, newHeight = max(width*size/height, 1), size
+	}
+
+	sums := make([][4]uint64, newWidth*newHeight)
+	counts := make([]uint64, newWidth*newHeight)
+
+	// JPEGs decode to YCbCr, which is much faster to read directly than through At
+	ycbcr, isYCbCr := img.(*image.YCbCr)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := (y - bounds.Min.Y) * newHeight / height * newWidth
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := row + (x-bounds.Min.X)*newWidth/width
+
+			var r, g, b, a uint32
+			if isYCbCr {
+				c := ycbcr.YCbCrAt(x, y)
+				r8, g8, b8 := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+				r, g, b, a = uint32(r8)<<8, uint32(g8)<<8, uint32(b8)<<8, 0xffff
+			} else {
+				r, g, b, a = img.At(x, y).RGBA()
+			}
+
+			sums[i][0] += uint64(r)
+			sums[i][1] += uint64(g)
+			sums[i][2] += uint64(b)
+			sums[i][3] += uint64(a)
+			counts[i]++
+		}
+	}
+
+	thumb := image.NewRGBA64(image.Rect(0, 0, newWidth, newHeight))
+	for i, sum := range sums {
+		count := max(counts[i], 1)
+		thumb.SetRGBA64(i%newWidth, i/newWidth, color.RGBA64{
+			R: uint16(sum[0] / count),
+			G: uint16(sum[1] / count),
+			B: uint16(sum[2] / count),
+			A: uint16(sum[3] / count),
+		})
+	}
+	return thumb
+}
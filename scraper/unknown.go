@@ -0,0 +1,58 @@
+package vsco
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// unknownMedia deals with an item we can't tell how to download, i.e. one without an image or video URL.
+// It's counted and skipped, or stops the sync with Options.Strict so an archive is never silently incomplete.
+// With Options.SaveUnknown the item is kept as it came from the API, for bug reports.
+func (scraper *Scraper) unknownMedia(media Media, raw json.RawMessage) error {
+	scraper.unknownCount++
+
+	if scraper.options.SaveUnknown && scraper.writesFiles() {
+		err := scraper.saveUnknown(media, raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	if scraper.options.Strict {
+		return fmt.Errorf("Media %s from %s is of a type we don't know how to download (-strict)\n", media.Id, scraper.username)
+	}
+
+	return nil
+}
+
+// saveUnknown writes raw to unknown/<id>.json in the user's folder
+func (scraper *Scraper) saveUnknown(media Media, raw json.RawMessage) error {
+	userPath, err := scraper.userPath()
+	if err != nil {
+		return err
+	}
+
+	unknownPath := path.Join(userPath, "unknown")
+	err = os.MkdirAll(unknownPath, scraper.options.DirMode)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %s: %w\n", unknownPath, err)
+	}
+
+	// The ID comes from the API, don't let it pick a path outside the folder
+	id := media.Id
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		id = "unknown-" + strconv.Itoa(scraper.unknownCount)
+	}
+
+	filePath := path.Join(unknownPath, id+".json")
+	err = os.WriteFile(filePath, raw, scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w\n", filePath, err)
+	}
+
+	return nil
+}
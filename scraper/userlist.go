@@ -0,0 +1,152 @@
+package vsco
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const byteOrderMark = "\ufeff"
+
+// cleanUsername trims what editors leave around a username, returning "" for lines that aren't one
+func cleanUsername(line string) string {
+	line = strings.TrimSpace(strings.TrimPrefix(line, byteOrderMark))
+	if strings.HasPrefix(line, "#") {
+		return ""
+	}
+	return line
+}
+
+// userEntry is one user from a -l list, with the options to sync them with
+type userEntry struct {
+	username       string
+	options        Options
+	profilePicture bool
+}
+
+// readUserList reads a list of usernames, one per line. Blank lines, lines starting with # and repeated users are skipped,
+// so lists saved with a BOM or Windows line endings work too. A .csv list instead has a header row naming its columns:
+// username, and optionally dir, max_items, profile_picture_only and since (YYYY-MM-DD) to override the
+// options for that user. Empty cells keep the options from the command line.
+func readUserList(list string, options Options, saveProfilePictures bool) ([]userEntry, error) {
+	file, err := os.Open(list)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file %s: %w\n", list, err)
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(strings.ToLower(list), ".csv") {
+		return readUserCSV(file, list, options, saveProfilePictures)
+	}
+
+	var entries []userEntry
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		username := cleanUsername(scanner.Text())
+		if username == "" || seen[strings.ToLower(username)] {
+			continue
+		}
+		seen[strings.ToLower(username)] = true
+
+		entries = append(entries, userEntry{username, options, saveProfilePictures})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read file %s: %w\n", list, err)
+	}
+
+	return entries, nil
+}
+
+func readUserCSV(file io.Reader, list string, options Options, saveProfilePictures bool) ([]userEntry, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read header of %s: %w\n", list, err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, byteOrderMark)))
+		switch name {
+		case "username", "dir", "max_items", "profile_picture_only", "since":
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("Unknown column %q in %s\n", name, list)
+		}
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, fmt.Errorf("%s has no username column\n", list)
+	}
+
+	var entries []userEntry
+	seen := make(map[string]bool)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w\n", list, err)
+		}
+
+		cell := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		username := cleanUsername(cell("username"))
+		if username == "" || seen[strings.ToLower(username)] {
+			continue
+		}
+		seen[strings.ToLower(username)] = true
+
+		entry := userEntry{username, options, saveProfilePictures}
+		line, _ := reader.FieldPos(0)
+
+		if dir := cell("dir"); dir != "" {
+			// Relative to the output directory, and offloaded downloads all have to be inside it
+			if options.Offload != nil || !filepath.IsAbs(dir) {
+				dir = filepath.Join(options.OutputDir, dir)
+			}
+			entry.options.OutputDir = dir
+		}
+		if maxItems := cell("max_items"); maxItems != "" {
+			entry.options.MaxItems, err = strconv.Atoi(maxItems)
+			if err != nil || entry.options.MaxItems < 0 {
+				return nil, fmt.Errorf("Invalid max_items %q on line %d of %s\n", maxItems, line, list)
+			}
+		}
+		if profileOnly := cell("profile_picture_only"); profileOnly != "" {
+			entry.profilePicture, err = strconv.ParseBool(profileOnly)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid profile_picture_only %q on line %d of %s\n", profileOnly, line, list)
+			}
+		}
+		if since := cell("since"); since != "" {
+			entry.options.Since, err = time.ParseInLocation(time.DateOnly, since, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid since %q on line %d of %s, expected YYYY-MM-DD\n", since, line, list)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
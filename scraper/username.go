@@ -0,0 +1,56 @@
+package vsco
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// VSCO usernames are letters, numbers, dashes and underscores
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+const maxUsernameLength = 50
+
+// ValidateUsername tells whether username can be a VSCO username, before asking the API about it. The error
+// says what's wrong with it, like being a link to the profile instead.
+func ValidateUsername(username string) error {
+	var problem string
+	switch {
+	case username == "":
+		problem = "it's empty"
+	case strings.Contains(username, "/"):
+		problem = "it's a link, not a username"
+		if linked := profileUsername(username); linked != "" {
+			problem = fmt.Sprintf("it's a link, the username is %q", linked)
+		}
+	case strings.HasPrefix(username, "@"):
+		problem = fmt.Sprintf("leave out the @, the username is %q", strings.TrimPrefix(username, "@"))
+	case len(username) > maxUsernameLength:
+		problem = fmt.Sprintf("it's longer than %d characters", maxUsernameLength)
+	case !usernamePattern.MatchString(username):
+		problem = "usernames only have letters, numbers, - and _"
+	default:
+		return nil
+	}
+
+	return fmt.Errorf("%w %q: %s\n", ErrInvalidUsername, username, problem)
+}
+
+// profileUsername pulls the username out of a profile link like vsco.co/<user>/gallery, "" if it isn't one
+func profileUsername(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || !isVSCOHost(u.Hostname()) {
+		return ""
+	}
+
+	username, _, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if !usernamePattern.MatchString(username) || len(username) > maxUsernameLength {
+		return ""
+	}
+	return username
+}
@@ -0,0 +1,66 @@
+package vsco
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+)
+
+// The ways syncing a user from a -l list can fail, in the order they're reported
+var userFailureKinds = []string{"Invalid", "Not found", "Private", "Rate limited", "Failed"}
+
+func userFailureKind(err error) string {
+	var statusErr *httpclient.StatusError
+	switch {
+	case errors.Is(err, ErrInvalidUsername):
+		return "Invalid"
+	case errors.Is(err, ErrUserNotFound):
+		return "Not found"
+	case errors.Is(err, ErrUserPrivate):
+		return "Private"
+	case errors.As(err, &statusErr) && statusErr.Code == http.StatusTooManyRequests:
+		return "Rate limited"
+	default:
+		return "Failed"
+	}
+}
+
+// hiddenProfile tells whether listing a profile failed with err because VSCO won't show it to us
+func hiddenProfile(err error) bool {
+	var statusErr *httpclient.StatusError
+	var syncErr *SyncError
+	// Failed downloads don't say anything about the profile
+	return errors.As(err, &statusErr) && !errors.As(err, &syncErr) &&
+		(statusErr.Code == http.StatusUnauthorized || statusErr.Code == http.StatusForbidden)
+}
+
+// userReport collects the users from a -l list that couldn't be synced, by how they failed
+type userReport map[string][]string
+
+func (report userReport) add(username string, err error) {
+	kind := userFailureKind(err)
+	report[kind] = append(report[kind], username)
+}
+
+// print lists the users by how they failed, so dead names are easy to clean out of the list
+func (report userReport) print() {
+	if len(report) == 0 {
+		return
+	}
+
+	lines := []string{"Users that couldn't be synced:"}
+	for _, kind := range userFailureKinds {
+		usernames := report[kind]
+		if len(usernames) == 0 {
+			continue
+		}
+		sort.Strings(usernames)
+		lines = append(lines, fmt.Sprintf("  %s (%d): %s", kind, len(usernames), strings.Join(usernames, ", ")))
+	}
+	log.Print(strings.Join(lines, "\n"))
+}
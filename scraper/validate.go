@@ -0,0 +1,47 @@
+package vsco
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Smaller than any real photo or video, but what a "content removed" placeholder or an empty answer comes to
+const minMediaSize = 256
+
+// checkDownload makes sure the file at mediaPath is media and not what the CDN sends instead of it with a
+// 200: an HTML or JSON error page, or a tiny placeholder. Images have to look like an image, videos just
+// can't be text, since not every container is recognized.
+func checkDownload(mediaPath string, media Media) error {
+	file, err := os.Open(mediaPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < minMediaSize {
+		return fmt.Errorf("%w: only %d bytes", ErrBadMedia, info.Size())
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	contentType := http.DetectContentType(head[:n])
+	switch {
+	case strings.HasPrefix(contentType, "text/"), strings.HasPrefix(contentType, "application/json"):
+		return fmt.Errorf("%w: got %s", ErrBadMedia, contentType)
+	case !media.Is_video && !strings.HasPrefix(contentType, "image/"):
+		return fmt.Errorf("%w: got %s for an image", ErrBadMedia, contentType)
+	}
+
+	return nil
+}
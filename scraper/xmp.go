@@ -0,0 +1,92 @@
+package vsco
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// xmpPath is where the XMP sidecar of the media at mediaPath goes. Lightroom only looks for the name
+// without the media's extension, digiKam finds that too.
+func xmpPath(mediaPath string) string {
+	return strings.TrimSuffix(mediaPath, path.Ext(mediaPath)) + ".xmp"
+}
+
+// xmlText escapes s to go in an XML attribute or element
+func xmlText(s string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
+
+// newXMP is the XMP packet for media: caption, uploader, dates, link, location and camera, in the fields
+// photo managers read on import
+func (scraper *Scraper) newXMP(media Media) string {
+	metadata := scraper.newMetadata(media)
+
+	// Capture time is when the photo was taken, fall back to when it went up
+	taken := metadata.UploadDate
+	if metadata.CaptureDate != nil {
+		taken = *metadata.CaptureDate
+	}
+
+	var xmp strings.Builder
+	xmp.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	xmp.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	xmp.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	xmp.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	xmp.WriteString("    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n")
+	xmp.WriteString("    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"\n")
+	xmp.WriteString("    xmlns:exif=\"http://ns.adobe.com/exif/1.0/\"\n")
+	xmp.WriteString("    xmlns:photoshop=\"http://ns.adobe.com/photoshop/1.0/\"\n")
+	xmp.WriteString("    xmlns:tiff=\"http://ns.adobe.com/tiff/1.0/\"")
+	if !taken.IsZero() {
+		date := xmlText(taken.Format(time.RFC3339))
+		fmt.Fprintf(&xmp, "\n    exif:DateTimeOriginal=\"%s\"\n    photoshop:DateCreated=\"%s\"\n    xmp:CreateDate=\"%s\"", date, date, date)
+	}
+	fmt.Fprintf(&xmp, "\n    dc:identifier=\"%s\"", xmlText(metadata.ID))
+	if metadata.Permalink != "" {
+		fmt.Fprintf(&xmp, "\n    dc:source=\"%s\"", xmlText(metadata.Permalink))
+	}
+	if metadata.Location != nil {
+		fmt.Fprintf(&xmp, "\n    exif:GPSLatitude=\"%s\"\n    exif:GPSLongitude=\"%s\"",
+			xmpCoordinate(metadata.Location.Latitude, 'N', 'S'), xmpCoordinate(metadata.Location.Longitude, 'E', 'W'))
+	}
+	if camera := metadata.Camera; camera != nil {
+		for _, field := range []struct{ name, value string }{
+			{"tiff:Make", camera.Make},
+			{"tiff:Model", camera.Model},
+			{"xmp:CreatorTool", camera.Software},
+		} {
+			if field.value != "" {
+				fmt.Fprintf(&xmp, "\n    %s=\"%s\"", field.name, xmlText(field.value))
+			}
+		}
+	}
+	xmp.WriteString(">\n")
+
+	if metadata.Caption != "" {
+		fmt.Fprintf(&xmp, "   <dc:description>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n    </rdf:Alt>\n   </dc:description>\n", xmlText(metadata.Caption))
+	}
+	fmt.Fprintf(&xmp, "   <dc:creator>\n    <rdf:Seq>\n     <rdf:li>%s</rdf:li>\n    </rdf:Seq>\n   </dc:creator>\n", xmlText(metadata.Username))
+
+	xmp.WriteString("  </rdf:Description>\n")
+	xmp.WriteString(" </rdf:RDF>\n")
+	xmp.WriteString("</x:xmpmeta>\n")
+	xmp.WriteString("<?xpacket end=\"w\"?>\n")
+
+	return xmp.String()
+}
+
+// writeXMP writes the XMP sidecar of the media at mediaPath
+func (scraper *Scraper) writeXMP(media Media, mediaPath string) error {
+	err := os.WriteFile(xmpPath(mediaPath), []byte(scraper.newXMP(media)), scraper.options.FileMode)
+	if err != nil {
+		return fmt.Errorf("Failed to write XMP metadata for %s: %w\n", mediaPath, err)
+	}
+
+	return nil
+}
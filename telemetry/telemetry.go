@@ -0,0 +1,140 @@
+// Package telemetry keeps opt-in, aggregate usage counts in a local file.
+// Nothing is ever sent anywhere, users can attach the file to bug reports if they want to.
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/SilverMight/vsco-get/httpclient"
+)
+
+type stats struct {
+	Runs     int            `json:"runs"`
+	Features map[string]int `json:"features"`
+	Errors   map[string]int `json:"errors"`
+}
+
+var (
+	mu      sync.Mutex
+	enabled bool
+	current = stats{Features: map[string]int{}, Errors: map[string]int{}}
+)
+
+// DefaultPath is where the stats are kept unless told otherwise
+func DefaultPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "vsco-get", "usage.json"), nil
+}
+
+// Enable turns on recording for this run, nothing is recorded otherwise
+func Enable() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	enabled = true
+	current.Runs++
+}
+
+// Feature counts a use of a flag or command
+func Feature(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if enabled {
+		current.Features[name]++
+	}
+}
+
+// Error counts an error by its class, never its message (which may contain usernames or paths)
+func Error(err error) {
+	if err == nil {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if enabled {
+		current.Errors[Classify(err)]++
+	}
+}
+
+// Classify names the kind of error err is, like "network" or "rate_limited"
+func Classify(err error) string {
+	var statusErr *httpclient.StatusError
+	var netErr net.Error
+	var pathErr *os.PathError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &statusErr) && statusErr.Code == http.StatusTooManyRequests:
+		return "rate_limited"
+	case errors.As(err, &statusErr):
+		return "http"
+	// Before network errors, since the syscall.Errno in a PathError passes for a net.Error
+	case errors.As(err, &pathErr):
+		return "filesystem"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "network_timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return "decode"
+	default:
+		return "other"
+	}
+}
+
+// Save merges the counts recorded since the last Save into the stats file
+func Save(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !enabled {
+		return nil
+	}
+
+	total := stats{Features: map[string]int{}, Errors: map[string]int{}}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &total)
+	}
+	// A hand-edited file can have null for either
+	if total.Features == nil {
+		total.Features = make(map[string]int)
+	}
+	if total.Errors == nil {
+		total.Errors = make(map[string]int)
+	}
+
+	total.Runs += current.Runs
+	for name, count := range current.Features {
+		total.Features[name] += count
+	}
+	for class, count := range current.Errors {
+		total.Errors[class] += count
+	}
+
+	current = stats{Features: map[string]int{}, Errors: map[string]int{}}
+
+	data, err := json.MarshalIndent(total, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,43 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vsco-get", "usage.json")
+	Enable()
+
+	// Counts are added to what's there, even if it's been edited down to nulls
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"runs": 2, "features": null, "errors": null}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Feature("watch")
+	Feature("watch")
+	Error(errors.New("something"))
+	if err := Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved stats
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	want := stats{Runs: 3, Features: map[string]int{"watch": 2}, Errors: map[string]int{Classify(errors.New("something")): 1}}
+	if !reflect.DeepEqual(saved, want) {
+		t.Errorf("Got %+v, want %+v", saved, want)
+	}
+}